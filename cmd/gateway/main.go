@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/sneha4175/gateway-pro/internal/admin"
+	"github.com/sneha4175/gateway-pro/internal/clientip"
 	"github.com/sneha4175/gateway-pro/internal/config"
 	"github.com/sneha4175/gateway-pro/internal/middleware"
 	"github.com/sneha4175/gateway-pro/internal/proxy"
@@ -112,9 +114,22 @@ func main() {
 		}
 	}()
 
+	ln, err := net.Listen("tcp", cfg.Server.Addr)
+	if err != nil {
+		log.Fatalw("proxy server failed", "err", err)
+	}
+	if cfg.Server.ProxyProtocol {
+		// Listener is bound once, so trusted_proxies changes here need a restart
+		resolver, err := clientip.New(cfg.Server.TrustedProxies)
+		if err != nil {
+			log.Fatalw("invalid trusted_proxies", "err", err)
+		}
+		ln = clientip.ProxyProtocolListener(ln, resolver)
+	}
+
 	go func() {
-		log.Infow("proxy server listening", "addr", cfg.Server.Addr)
-		if err := mainSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Infow("proxy server listening", "addr", cfg.Server.Addr, "proxy_protocol", cfg.Server.ProxyProtocol)
+		if err := mainSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Fatalw("proxy server failed", "err", err)
 		}
 	}()
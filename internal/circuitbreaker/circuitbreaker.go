@@ -4,7 +4,6 @@ package circuitbreaker
 
 import (
 	"errors"
-	"fmt"
 	"sync"
 	"time"
 
@@ -35,15 +34,37 @@ func (s state) String() string {
 }
 
 // Breaker is a single circuit breaker for one upstream backend.
+//
+// While closed it trips when the failure percentage over the rolling window
+// reaches failure_threshold (once min_requests calls have been seen), or
+// after consecutive_failures failures in a row. Which responses count as
+// failures is configurable: transport errors always do, as do the status
+// codes in failure_status_codes (default 5xx) and calls slower than
+// slow_call_threshold. Each trip that follows soon after the circuit closed
+// doubles the open duration, up to max_open_duration.
 type Breaker struct {
 	mu sync.Mutex
-	cfg config.CircuitBreakerConfig
 
-	state     state
-	openAt    time.Time
+	minRequests  int
+	threshold    int // percent
+	consecutive  int // 0 disables
+	window       time.Duration
+	slowCall     time.Duration // 0 disables
+	failureCodes []config.StatusRange
+	openDuration time.Duration
+	maxOpen      time.Duration
+	halfOpenReqs int
+	now          func() time.Time
 
-	// Rolling window for the closed state
-	window []observation
+	state    state
+	openAt   time.Time
+	openFor  time.Duration // current, backed-off open duration
+	trips    int           // trips since the circuit last stayed closed
+	closedAt time.Time
+
+	// Rolling window and failure streak for the closed state
+	observations []observation
+	streak       int
 
 	// Counters for half-open state
 	halfOpenTotal    int
@@ -55,26 +76,28 @@ type observation struct {
 	success bool
 }
 
-const rollingWindow = 10 * time.Second
-
 // New creates a Breaker from config. Returns nil (no-op) if cfg is nil.
-func New(cfg *config.CircuitBreakerConfig) *Breaker {
+func New(cfg *config.CircuitBreakerConfig) (*Breaker, error) {
 	if cfg == nil {
-		return nil
-	}
-	if cfg.MinRequests == 0 {
-		cfg.MinRequests = 20
-	}
-	if cfg.FailureThreshold == 0 {
-		cfg.FailureThreshold = 50
+		return nil, nil
 	}
-	if cfg.OpenDurationSeconds == 0 {
-		cfg.OpenDurationSeconds = 30
+	s, err := cfg.Settings()
+	if err != nil {
+		return nil, err
 	}
-	if cfg.HalfOpenRequests == 0 {
-		cfg.HalfOpenRequests = 5
-	}
-	return &Breaker{cfg: *cfg}
+	return &Breaker{
+		minRequests:  s.MinRequests,
+		threshold:    s.FailureThreshold,
+		consecutive:  s.ConsecutiveFailures,
+		window:       s.Window,
+		slowCall:     s.SlowCallThreshold,
+		failureCodes: s.FailureStatusCodes,
+		openDuration: s.OpenDuration,
+		maxOpen:      s.MaxOpenDuration,
+		halfOpenReqs: s.HalfOpenRequests,
+		now:          time.Now,
+		openFor:      s.OpenDuration,
+	}, nil
 }
 
 // Allow returns nil if a request should proceed, ErrCircuitOpen otherwise.
@@ -89,13 +112,13 @@ func (b *Breaker) Allow() error {
 	case stateClosed:
 		return nil
 	case stateOpen:
-		if time.Since(b.openAt) > time.Duration(b.cfg.OpenDurationSeconds)*time.Second {
+		if b.now().Sub(b.openAt) > b.openFor {
 			b.transitionTo(stateHalfOpen)
 			return nil
 		}
 		return ErrCircuitOpen
 	case stateHalfOpen:
-		if b.halfOpenTotal < b.cfg.HalfOpenRequests {
+		if b.halfOpenTotal < b.halfOpenReqs {
 			b.halfOpenTotal++
 			return nil
 		}
@@ -104,6 +127,33 @@ func (b *Breaker) Allow() error {
 	return nil
 }
 
+// Record classifies an upstream response by its status code (0 for a
+// transport error) and latency, and records a success or failure.
+func (b *Breaker) Record(status int, latency time.Duration) {
+	if b.IsFailure(status, latency) {
+		b.RecordFailure()
+	} else {
+		b.RecordSuccess()
+	}
+}
+
+// IsFailure reports whether a response with this status (0 for a transport
+// error) and latency counts as a failure.
+func (b *Breaker) IsFailure(status int, latency time.Duration) bool {
+	if b == nil {
+		return status == 0 || status >= 500
+	}
+	if status == 0 || (b.slowCall > 0 && latency > b.slowCall) {
+		return true
+	}
+	for _, r := range b.failureCodes {
+		if status >= r.Lo && status <= r.Hi {
+			return true
+		}
+	}
+	return false
+}
+
 // RecordSuccess must be called when an upstream request succeeds.
 func (b *Breaker) RecordSuccess() {
 	if b == nil {
@@ -117,7 +167,7 @@ func (b *Breaker) RecordSuccess() {
 		b.record(true)
 	case stateHalfOpen:
 		// All probes succeeded → close the circuit
-		if b.halfOpenTotal-b.halfOpenFailures >= b.cfg.HalfOpenRequests {
+		if b.halfOpenTotal-b.halfOpenFailures >= b.halfOpenReqs {
 			b.transitionTo(stateClosed)
 		}
 	}
@@ -142,6 +192,20 @@ func (b *Breaker) RecordFailure() {
 	}
 }
 
+// Release hands back a half-open probe that Allow granted to a request whose
+// outcome says nothing about the backend, such as a client hanging up.
+func (b *Breaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == stateHalfOpen && b.halfOpenTotal > 0 {
+		b.halfOpenTotal--
+	}
+}
+
 // State returns a human-readable state string.
 func (b *Breaker) State() string {
 	if b == nil {
@@ -153,46 +217,68 @@ func (b *Breaker) State() string {
 }
 
 func (b *Breaker) record(success bool) {
-	now := time.Now()
-	b.window = append(b.window, observation{at: now, success: success})
+	now := b.now()
+	b.observations = append(b.observations, observation{at: now, success: success})
+	if success {
+		b.streak = 0
+	} else {
+		b.streak++
+	}
 	// Evict observations outside the rolling window
-	cutoff := now.Add(-rollingWindow)
+	cutoff := now.Add(-b.window)
 	i := 0
-	for i < len(b.window) && b.window[i].at.Before(cutoff) {
+	for i < len(b.observations) && b.observations[i].at.Before(cutoff) {
 		i++
 	}
-	b.window = b.window[i:]
+	b.observations = b.observations[i:]
 }
 
 func (b *Breaker) maybeTrip() {
-	total := len(b.window)
-	if total < b.cfg.MinRequests {
+	if b.consecutive > 0 && b.streak >= b.consecutive {
+		b.transitionTo(stateOpen)
+		return
+	}
+	total := len(b.observations)
+	if total < b.minRequests {
 		return
 	}
 	failures := 0
-	for _, o := range b.window {
+	for _, o := range b.observations {
 		if !o.success {
 			failures++
 		}
 	}
 	pct := failures * 100 / total
-	if pct >= b.cfg.FailureThreshold {
+	if pct >= b.threshold {
 		b.transitionTo(stateOpen)
 	}
 }
 
 func (b *Breaker) transitionTo(s state) {
-	_ = fmt.Sprintf("circuit breaker: %s → %s", b.state, s) // keep fmt import happy
-	b.state = s
-	if s == stateOpen {
-		b.openAt = time.Now()
-		b.window = b.window[:0]
-	}
-	if s == stateHalfOpen {
+	now := b.now()
+	switch s {
+	case stateOpen:
+		// A backend that stayed healthy for as long as it was last open
+		// starts over; one that fails again sooner waits twice as long.
+		if b.state == stateClosed && now.Sub(b.closedAt) >= b.openFor {
+			b.trips = 0
+		}
+		b.openFor = b.openDuration
+		for i := 0; i < b.trips && b.openFor < b.maxOpen; i++ {
+			b.openFor *= 2
+		}
+		b.openFor = min(b.openFor, b.maxOpen)
+		b.trips++
+		b.openAt = now
+		b.observations = b.observations[:0]
+		b.streak = 0
+	case stateHalfOpen:
 		b.halfOpenTotal = 0
 		b.halfOpenFailures = 0
+	case stateClosed:
+		b.closedAt = now
+		b.observations = b.observations[:0]
+		b.streak = 0
 	}
-	if s == stateClosed {
-		b.window = b.window[:0]
-	}
+	b.state = s
 }
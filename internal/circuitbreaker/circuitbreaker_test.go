@@ -0,0 +1,201 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(t *testing.T, cfg config.CircuitBreakerConfig) (*Breaker, *clock) {
+	t.Helper()
+	b, err := New(&cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c := &clock{t: time.Unix(1_700_000_000, 0)}
+	b.now = c.now
+	return b, c
+}
+
+// reopen lets the open period pass and fails the first probe.
+func reopen(b *Breaker, c *clock) {
+	c.advance(b.openFor + time.Millisecond)
+	b.Allow()
+	b.RecordFailure()
+}
+
+// recoverBreaker lets the open period pass and sends good probes until the
+// circuit closes.
+func recoverBreaker(b *Breaker, c *clock) {
+	c.advance(b.openFor + time.Millisecond)
+	for b.State() != "closed" && b.Allow() == nil {
+		b.RecordSuccess()
+	}
+}
+
+func TestBreaker_FailureRateOverWindow(t *testing.T) {
+	b, c := newTestBreaker(t, config.CircuitBreakerConfig{MinRequests: 4, FailureThreshold: 50, Window: "1m"})
+	b.RecordFailure()
+	b.RecordSuccess()
+	b.RecordSuccess()
+	if b.State() != "closed" {
+		t.Fatalf("tripped below min_requests")
+	}
+	c.advance(30 * time.Second) // still inside the 1m window
+	b.RecordFailure()
+	if b.State() != "open" {
+		t.Fatalf("state = %s after 2 of 4 calls failed within the window, want open", b.State())
+	}
+
+	// Failures older than the window no longer count
+	b, c = newTestBreaker(t, config.CircuitBreakerConfig{MinRequests: 3, FailureThreshold: 50, Window: "5s"})
+	b.RecordFailure()
+	b.RecordFailure()
+	c.advance(6 * time.Second)
+	b.RecordSuccess()
+	b.RecordSuccess()
+	b.RecordFailure()
+	if b.State() != "closed" {
+		t.Fatalf("state = %s, want closed: only 1 of 3 calls in the window failed", b.State())
+	}
+}
+
+func TestBreaker_ConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(t, config.CircuitBreakerConfig{MinRequests: 100, ConsecutiveFailures: 3})
+	b.RecordFailure()
+	b.RecordFailure()
+	b.RecordSuccess() // breaks the streak
+	b.RecordFailure()
+	b.RecordFailure()
+	if b.State() != "closed" {
+		t.Fatal("tripped before 3 failures in a row")
+	}
+	b.RecordFailure()
+	if b.State() != "open" {
+		t.Fatalf("state = %s after 3 failures in a row, want open despite min_requests", b.State())
+	}
+}
+
+func TestBreaker_IsFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.CircuitBreakerConfig
+		status  int
+		latency time.Duration
+		want    bool
+	}{
+		{"5xx by default", config.CircuitBreakerConfig{}, 503, 0, true},
+		{"4xx is fine by default", config.CircuitBreakerConfig{}, 429, 0, false},
+		{"transport error", config.CircuitBreakerConfig{FailureStatusCodes: []string{"429"}}, 0, 0, true},
+		{"listed code", config.CircuitBreakerConfig{FailureStatusCodes: []string{"5xx", "429"}}, 429, 0, true},
+		{"class", config.CircuitBreakerConfig{FailureStatusCodes: []string{"5xx", "429"}}, 599, 0, true},
+		{"unlisted code", config.CircuitBreakerConfig{FailureStatusCodes: []string{"429"}}, 500, 0, false},
+		{"slow call", config.CircuitBreakerConfig{SlowCallThreshold: "1s"}, 200, 1500 * time.Millisecond, true},
+		{"fast call", config.CircuitBreakerConfig{SlowCallThreshold: "1s"}, 200, 900 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newTestBreaker(t, tt.cfg)
+			if got := b.IsFailure(tt.status, tt.latency); got != tt.want {
+				t.Fatalf("IsFailure(%d, %v) = %v, want %v", tt.status, tt.latency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreaker_SlowCallsTrip(t *testing.T) {
+	b, _ := newTestBreaker(t, config.CircuitBreakerConfig{MinRequests: 4, FailureThreshold: 50, SlowCallThreshold: "200ms"})
+	for _, latency := range []time.Duration{50, 300, 80, 250} {
+		b.Record(200, latency*time.Millisecond)
+	}
+	if b.State() != "open" {
+		t.Fatalf("state = %s after half the calls were slow, want open", b.State())
+	}
+}
+
+func TestBreaker_OpenDurationBackoff(t *testing.T) {
+	b, c := newTestBreaker(t, config.CircuitBreakerConfig{
+		ConsecutiveFailures: 1, OpenDurationSeconds: 10, HalfOpenRequests: 1, MaxOpenDuration: "35s",
+	})
+	b.RecordFailure()
+	want := []time.Duration{10 * time.Second}
+	// Each failed probe doubles the open duration, up to the maximum
+	for i := 0; i < 3; i++ {
+		c.advance(b.openFor - time.Millisecond)
+		if b.Allow() == nil {
+			t.Fatalf("trip %d: allowed before the %v open duration passed", i+1, b.openFor)
+		}
+		reopen(b, c)
+		want = append(want, min(want[len(want)-1]*2, 35*time.Second))
+		if b.openFor != want[len(want)-1] {
+			t.Fatalf("open durations = ..%v, want %v", b.openFor, want)
+		}
+	}
+
+	// Recovering and failing again right away keeps the backed-off duration
+	recoverBreaker(b, c)
+	if b.State() != "closed" {
+		t.Fatalf("state = %s after a good probe, want closed", b.State())
+	}
+	c.advance(time.Second)
+	b.RecordFailure()
+	if b.openFor != 35*time.Second {
+		t.Fatalf("open duration = %v after a quick relapse, want it kept at 35s", b.openFor)
+	}
+
+	// Staying closed for as long as it was last open starts over
+	recoverBreaker(b, c)
+	c.advance(40 * time.Second)
+	b.RecordFailure()
+	if b.openFor != 10*time.Second {
+		t.Fatalf("open duration = %v after a long recovery, want the base 10s", b.openFor)
+	}
+}
+
+func TestBreaker_ReleaseReturnsProbe(t *testing.T) {
+	b, c := newTestBreaker(t, config.CircuitBreakerConfig{
+		ConsecutiveFailures: 1, OpenDurationSeconds: 10, HalfOpenRequests: 1,
+	})
+	b.RecordFailure()
+	c.advance(b.openFor + time.Millisecond)
+	b.Allow() // moves to half-open
+	b.Allow() // takes the only probe
+	if b.Allow() == nil {
+		t.Fatal("expected the probes to be used up")
+	}
+
+	b.Release()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow after Release: %v", err)
+	}
+	b.RecordSuccess()
+	if b.State() != "closed" {
+		t.Fatalf("state = %s after a good probe, want closed", b.State())
+	}
+	b.Release() // no-op outside half-open
+}
+
+func TestNew_Errors(t *testing.T) {
+	for _, cfg := range []config.CircuitBreakerConfig{
+		{FailureThreshold: 101},
+		{ConsecutiveFailures: -1},
+		{Window: "soon"},
+		{SlowCallThreshold: "-1s"},
+		{FailureStatusCodes: []string{"4xy"}},
+		{FailureStatusCodes: []string{"700"}},
+		{OpenDurationSeconds: 60, MaxOpenDuration: "30s"},
+	} {
+		if _, err := New(&cfg); err == nil {
+			t.Errorf("New(%+v): expected error", cfg)
+		}
+	}
+	if b, err := New(nil); b != nil || err != nil {
+		t.Errorf("New(nil) = %v, %v; want a nil breaker", b, err)
+	}
+}
@@ -0,0 +1,157 @@
+// Package clientip resolves the real client address of a request.
+// X-Forwarded-For is only believed when the request arrived from a trusted
+// proxy, and then only up to the first hop that is not itself trusted, so a
+// client cannot choose its own identity by sending the header.
+// The resolved address is stored in the request context once and shared by
+// the rate limiter, the ip_hash balancer and the access log.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver extracts the client IP given a set of trusted proxy networks.
+// A nil or empty Resolver trusts nobody and always returns the TCP peer.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New parses trusted proxy CIDRs. Bare addresses are treated as /32 or /128.
+func New(cidrs []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			addr, err := netip.ParseAddr(c)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", c, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", c, err)
+		}
+		r.trusted = append(r.trusted, p.Masked())
+	}
+	return r, nil
+}
+
+// Trusted reports whether ip (with or without a port) belongs to a trusted proxy.
+func (res *Resolver) Trusted(ip string) bool {
+	if res == nil || len(res.trusted) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(host(ip))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent r.
+//
+// If the TCP peer is untrusted it is the client. Otherwise X-Forwarded-For is
+// walked from right to left, skipping trusted hops, and the first untrusted
+// entry is the client. If every hop is trusted the leftmost one is used.
+// X-Real-IP is honoured only from a trusted peer without X-Forwarded-For.
+func (res *Resolver) ClientIP(r *http.Request) string {
+	peer := host(r.RemoteAddr)
+	if !res.Trusted(peer) {
+		return peer
+	}
+
+	hops := forwardedHops(r.Header)
+	if len(hops) == 0 {
+		if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); validIP(xri) {
+			return xri
+		}
+		return peer
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !validIP(hops[i]) {
+			// Garbage in the chain: stop trusting anything further left.
+			return peer
+		}
+		if !res.Trusted(hops[i]) {
+			return hops[i]
+		}
+		peer = hops[i]
+	}
+	return peer
+}
+
+// forwardedHops flattens every X-Forwarded-For header into its entries.
+func forwardedHops(h http.Header) []string {
+	var hops []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, host(hop))
+			}
+		}
+	}
+	return hops
+}
+
+// ---------------------------------------------------------------------------
+// Request context
+// ---------------------------------------------------------------------------
+
+type ctxKey struct{}
+
+type resolved struct {
+	ip          string
+	trustedPeer bool
+}
+
+// WithClientIP resolves r's client IP and returns a request carrying it.
+func (res *Resolver) WithClientIP(r *http.Request) *http.Request {
+	v := resolved{ip: res.ClientIP(r), trustedPeer: res.Trusted(r.RemoteAddr)}
+	return r.WithContext(context.WithValue(r.Context(), ctxKey{}, v))
+}
+
+// FromRequest returns the client IP stored by WithClientIP, or the TCP peer
+// address if the request was never resolved.
+func FromRequest(r *http.Request) string {
+	if v, ok := r.Context().Value(ctxKey{}).(resolved); ok {
+		return v.ip
+	}
+	return host(r.RemoteAddr)
+}
+
+// FromTrustedProxy reports whether r's TCP peer is a trusted proxy, i.e.
+// whether its X-Forwarded-For may be passed on to the backend.
+func FromTrustedProxy(r *http.Request) bool {
+	v, ok := r.Context().Value(ctxKey{}).(resolved)
+	return ok && v.trustedPeer
+}
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+// host strips an optional port (and IPv6 brackets) from addr.
+func host(addr string) string {
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		return h
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func validIP(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
@@ -0,0 +1,178 @@
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func mustResolver(t *testing.T, cidrs ...string) *Resolver {
+	t.Helper()
+	res, err := New(cidrs)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return res
+}
+
+func TestClientIP(t *testing.T) {
+	res := mustResolver(t, "10.0.0.0/8", "192.168.1.1")
+
+	cases := []struct {
+		name   string
+		remote string
+		xff    []string
+		xri    string
+		want   string
+	}{
+		{"untrusted peer ignores XFF", "203.0.113.7:5000", []string{"1.1.1.1"}, "", "203.0.113.7"},
+		{"trusted peer without XFF", "10.0.0.5:5000", nil, "", "10.0.0.5"},
+		{"trusted peer uses X-Real-IP", "10.0.0.5:5000", nil, "198.51.100.2", "198.51.100.2"},
+		{"single trusted hop", "10.0.0.5:5000", []string{"198.51.100.2"}, "", "198.51.100.2"},
+		{"spoofed leftmost entry skipped", "10.0.0.5:5000", []string{"6.6.6.6, 198.51.100.2"}, "", "198.51.100.2"},
+		{"chain of trusted proxies", "10.0.0.5:5000", []string{"198.51.100.2, 192.168.1.1, 10.1.2.3"}, "", "198.51.100.2"},
+		{"multiple XFF headers", "10.0.0.5:5000", []string{"198.51.100.2", "10.1.2.3"}, "", "198.51.100.2"},
+		{"all hops trusted", "10.0.0.5:5000", []string{"10.9.9.9, 10.1.1.1"}, "", "10.9.9.9"},
+		{"garbage hop stops the walk", "10.0.0.5:5000", []string{"198.51.100.2, not-an-ip"}, "", "10.0.0.5"},
+		{"ipv6 peer", "[2001:db8::1]:443", nil, "", "2001:db8::1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remote
+			for _, v := range tc.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tc.xri != "" {
+				r.Header.Set("X-Real-IP", tc.xri)
+			}
+			if got := res.ClientIP(r); got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNilResolverTrustsNobody(t *testing.T) {
+	var res *Resolver
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.5:5000"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := res.ClientIP(r); got != "10.0.0.5" {
+		t.Errorf("expected peer address, got %s", got)
+	}
+}
+
+func TestNew_RejectsInvalidCIDR(t *testing.T) {
+	if _, err := New([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected error for invalid prefix")
+	}
+	if _, err := New([]string{"proxy.internal"}); err == nil {
+		t.Error("expected error for hostname")
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	res := mustResolver(t, "10.0.0.0/8")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.5:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.2")
+
+	if got := FromRequest(r); got != "10.0.0.5" {
+		t.Errorf("unresolved request should fall back to peer, got %s", got)
+	}
+	if FromTrustedProxy(r) {
+		t.Error("unresolved request must not be treated as from a trusted proxy")
+	}
+
+	r = res.WithClientIP(r)
+	if got := FromRequest(r); got != "198.51.100.2" {
+		t.Errorf("expected resolved client, got %s", got)
+	}
+	if !FromTrustedProxy(r) {
+		t.Error("expected peer to be trusted")
+	}
+}
+
+func TestReadProxyHeader_V1(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("PROXY TCP4 198.51.100.2 10.0.0.1 40000 8080\r\nGET / HTTP/1.1\r\n"))
+	addr, err := readProxyHeader(br)
+	if err != nil {
+		t.Fatalf("readProxyHeader: %v", err)
+	}
+	if addr.String() != "198.51.100.2:40000" {
+		t.Errorf("unexpected addr %s", addr)
+	}
+	rest, _ := br.ReadString('\n')
+	if rest != "GET / HTTP/1.1\r\n" {
+		t.Errorf("header not fully consumed, next line %q", rest)
+	}
+}
+
+func TestReadProxyHeader_V2(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+	buf.WriteByte(0x21) // v2, PROXY
+	buf.WriteByte(0x11) // AF_INET, STREAM
+	_ = binary.Write(&buf, binary.BigEndian, uint16(12))
+	buf.Write(net.ParseIP("198.51.100.2").To4())
+	buf.Write(net.ParseIP("10.0.0.1").To4())
+	_ = binary.Write(&buf, binary.BigEndian, uint16(40000))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(8080))
+	buf.WriteString("GET /")
+
+	br := bufio.NewReader(&buf)
+	addr, err := readProxyHeader(br)
+	if err != nil {
+		t.Fatalf("readProxyHeader: %v", err)
+	}
+	if addr.String() != "198.51.100.2:40000" {
+		t.Errorf("unexpected addr %s", addr)
+	}
+	rest, _ := br.ReadString('/')
+	if rest != "GET /" {
+		t.Errorf("header not fully consumed, got %q", rest)
+	}
+}
+
+func TestReadProxyHeader_RejectsMissingHeader(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+	if _, err := readProxyHeader(br); err == nil {
+		t.Error("expected error for plain HTTP on a PROXY protocol connection")
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ln := ProxyProtocolListener(inner, mustResolver(t, "127.0.0.1"))
+	defer ln.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = c.Write([]byte("PROXY TCP4 198.51.100.2 127.0.0.1 40000 8080\r\nhello"))
+	}()
+
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer c.Close()
+	if got := c.RemoteAddr().String(); got != "198.51.100.2:40000" {
+		t.Errorf("expected client address from header, got %s", got)
+	}
+	buf := make([]byte, 5)
+	if _, err := c.Read(buf); err != nil || string(buf) != "hello" {
+		t.Errorf("expected payload after header, got %q (%v)", buf, err)
+	}
+}
@@ -0,0 +1,160 @@
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// PROXY protocol (v1 text and v2 binary) listener
+//
+// Load balancers that terminate TCP (AWS NLB, HAProxy) prepend a header with
+// the original client address. The header is only parsed on connections
+// from trusted proxies; anyone else could use it to spoof their address.
+// ---------------------------------------------------------------------------
+
+// How long a trusted peer has to send its PROXY header.
+const proxyHeaderTimeout = 5 * time.Second
+
+var (
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	errProxyHeader   = errors.New("invalid PROXY protocol header")
+)
+
+// ProxyProtocolListener wraps ln so that connections from trusted proxies
+// report the client address from their PROXY protocol header as RemoteAddr.
+func ProxyProtocolListener(ln net.Listener, res *Resolver) net.Listener {
+	return &proxyListener{Listener: ln, res: res}
+}
+
+type proxyListener struct {
+	net.Listener
+	res *Resolver
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.res.Trusted(c.RemoteAddr().String()) {
+		return c, nil
+	}
+	return &proxyConn{Conn: c, br: bufio.NewReader(c)}, nil
+}
+
+// proxyConn parses the header lazily, on the first Read or RemoteAddr call,
+// so a slow proxy cannot stall the accept loop.
+type proxyConn struct {
+	net.Conn
+	br     *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.br)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader consumes a v1 or v2 header and returns the source address
+// it carries, or nil for LOCAL / UNKNOWN connections (health checks).
+func readProxyHeader(br *bufio.Reader) (net.Addr, error) {
+	sig, err := br.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(br)
+	}
+	prefix, err := br.Peek(6)
+	if err == nil && string(prefix) == "PROXY " {
+		return readProxyV1(br)
+	}
+	return nil, errProxyHeader
+}
+
+// readProxyV1 parses "PROXY TCP4 <src> <dst> <sport> <dport>\r\n".
+func readProxyV1(br *bufio.Reader) (net.Addr, error) {
+	line, err := br.ReadSlice('\n')
+	if err != nil || len(line) > 107 || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errProxyHeader
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 parses the binary header defined in section 2.2 of the spec.
+func readProxyV2(br *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, errProxyHeader
+	}
+	verCmd, fam := hdr[12], hdr[13]
+	length := int(binary.BigEndian.Uint16(hdr[14:16]))
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: version %d", errProxyHeader, verCmd>>4)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, errProxyHeader
+	}
+	if verCmd&0x0f == 0 { // LOCAL
+		return nil, nil
+	}
+
+	switch fam >> 4 {
+	case 1: // AF_INET
+		if length < 12 {
+			return nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 2: // AF_INET6
+		if length < 36 {
+			return nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default: // AF_UNSPEC / AF_UNIX: keep the real peer
+		return nil, nil
+	}
+}
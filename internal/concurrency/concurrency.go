@@ -0,0 +1,385 @@
+// Package concurrency caps the number of requests in flight to a route or a
+// backend. The cap is either fixed or adapts to observed latency (AIMD or a
+// gradient algorithm in the style of Netflix concurrency-limits); requests
+// over the cap wait in a bounded priority queue and are shed when it is full
+// or their wait expires.
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// ErrShed is returned when a request is rejected to protect the upstream.
+var ErrShed = errors.New("request shed: concurrency limit reached")
+
+// Priority orders queued requests; lower values are served first.
+type Priority int
+
+const (
+	PriorityHigh Priority = iota
+	PriorityNormal
+	PriorityLow
+	numPriorities
+)
+
+// ParsePriority maps a header value to a Priority, defaulting to normal.
+func ParsePriority(s string) Priority {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "high", "critical":
+		return PriorityHigh
+	case "low", "background":
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+var (
+	limitGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Name:      "concurrency_limit",
+		Help:      "Current concurrency limit (adaptive limits move over time).",
+	}, []string{"route", "backend"})
+
+	inflightGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Name:      "concurrency_inflight",
+		Help:      "Requests currently holding a concurrency slot.",
+	}, []string{"route", "backend"})
+
+	queuedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Name:      "concurrency_queued",
+		Help:      "Requests waiting for a concurrency slot.",
+	}, []string{"route", "backend"})
+
+	shedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Name:      "concurrency_shed_total",
+		Help:      "Requests rejected by the concurrency limiter.",
+	}, []string{"route", "backend", "reason"})
+)
+
+// Limiter is a concurrency limiter for one route or backend.
+// A nil *Limiter admits everything.
+type Limiter struct {
+	mu       sync.Mutex
+	limit    float64
+	minLimit float64
+	maxLimit float64
+	inflight int
+	algo     algorithm
+
+	waiters  [numPriorities]list.List // of *waiter, FIFO per priority
+	queued   int
+	maxQueue int
+	maxWait  time.Duration
+
+	route, backend string
+	closed         atomic.Bool // metrics removed; see Close
+}
+
+type waiter struct {
+	ready   chan struct{}
+	elem    *list.Element
+	prio    Priority
+	granted bool
+	evicted bool
+}
+
+// New builds a Limiter from config; backend is "" for a route-level limiter.
+// Returns nil (no limit) if cfg is nil.
+func New(cfg *config.ConcurrencyConfig, route, backend string) (*Limiter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.Limit <= 0 {
+		return nil, fmt.Errorf("concurrency.limit must be positive, got %d", cfg.Limit)
+	}
+
+	l := &Limiter{
+		limit:    float64(cfg.Limit),
+		minLimit: float64(max(cfg.MinLimit, 1)),
+		maxLimit: float64(cfg.MaxLimit),
+		maxQueue: cfg.MaxQueue,
+		route:    route,
+		backend:  backend,
+	}
+	if l.maxLimit < l.limit {
+		l.maxLimit = l.limit
+	}
+	if cfg.MaxWait != "" {
+		d, err := time.ParseDuration(cfg.MaxWait)
+		if err != nil {
+			return nil, fmt.Errorf("concurrency.max_wait %q: %w", cfg.MaxWait, err)
+		}
+		l.maxWait = d
+	}
+
+	switch cfg.Mode {
+	case "", "fixed":
+		l.algo = fixedLimit{}
+	case "aimd":
+		threshold := time.Second
+		if cfg.LatencyThreshold != "" {
+			d, err := time.ParseDuration(cfg.LatencyThreshold)
+			if err != nil {
+				return nil, fmt.Errorf("concurrency.latency_threshold %q: %w", cfg.LatencyThreshold, err)
+			}
+			threshold = d
+		}
+		l.algo = &aimdLimit{threshold: threshold, backoff: 0.9}
+	case "gradient":
+		l.algo = &gradientLimit{smoothing: 0.2}
+	default:
+		return nil, fmt.Errorf("unknown concurrency.mode %q", cfg.Mode)
+	}
+
+	l.publish()
+	return l, nil
+}
+
+// Acquire takes a slot, waiting up to max_wait in the queue if necessary.
+// The returned Token must be released with Done once the upstream call ends.
+func (l *Limiter) Acquire(ctx context.Context, prio Priority) (*Token, error) {
+	if l == nil {
+		return nil, nil
+	}
+	if prio < 0 || prio >= numPriorities {
+		prio = PriorityNormal
+	}
+
+	l.mu.Lock()
+	if l.queued == 0 && l.inflight < int(l.limit) {
+		l.inflight++
+		l.publish()
+		l.mu.Unlock()
+		return l.token(), nil
+	}
+	if l.maxQueue <= 0 || l.maxWait <= 0 {
+		l.mu.Unlock()
+		return nil, l.shed("limit")
+	}
+	if l.queued >= l.maxQueue && !l.evictBelow(prio) {
+		l.mu.Unlock()
+		return nil, l.shed("queue_full")
+	}
+	w := &waiter{ready: make(chan struct{}), prio: prio}
+	w.elem = l.waiters[prio].PushBack(w)
+	l.queued++
+	l.publish()
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.maxWait)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case w.granted:
+		return l.token(), nil
+	case w.evicted:
+		return nil, l.shed("evicted")
+	default:
+		l.waiters[prio].Remove(w.elem)
+		l.queued--
+		l.publish()
+		return nil, l.shed("timeout")
+	}
+}
+
+// evictBelow drops the newest waiter with a lower priority than prio to make
+// room in a full queue. Caller must hold l.mu.
+func (l *Limiter) evictBelow(prio Priority) bool {
+	for p := numPriorities - 1; p > prio; p-- {
+		if e := l.waiters[p].Back(); e != nil {
+			w := l.waiters[p].Remove(e).(*waiter)
+			w.evicted = true
+			l.queued--
+			close(w.ready)
+			return true
+		}
+	}
+	return false
+}
+
+// release frees a slot, feeds the sample (if any) to the limit algorithm
+// and hands freed slots to queued requests, highest priority first.
+func (l *Limiter) release(rtt time.Duration, dropped, sample bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if sample {
+		l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.algo.next(l.limit, rtt, l.inflight, dropped)))
+	}
+	l.inflight--
+
+	for p := PriorityHigh; p < numPriorities && l.inflight < int(l.limit); {
+		e := l.waiters[p].Front()
+		if e == nil {
+			p++
+			continue
+		}
+		w := l.waiters[p].Remove(e).(*waiter)
+		w.granted = true
+		l.queued--
+		l.inflight++
+		close(w.ready)
+	}
+	l.publish()
+}
+
+// Limit returns the current concurrency limit.
+func (l *Limiter) Limit() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Close removes the limiter's metrics once its route or backend is gone.
+// Requests still holding or waiting for a slot finish normally, without
+// publishing them again. Safe to call on a nil Limiter.
+func (l *Limiter) Close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed.Store(true)
+	labels := prometheus.Labels{"route": l.route, "backend": l.backend}
+	limitGauge.Delete(labels)
+	inflightGauge.Delete(labels)
+	queuedGauge.Delete(labels)
+	shedTotal.DeletePartialMatch(labels)
+}
+
+func (l *Limiter) shed(reason string) error {
+	if !l.closed.Load() {
+		shedTotal.WithLabelValues(l.route, l.backend, reason).Inc()
+	}
+	return ErrShed
+}
+
+// publish exports the current state. Caller must hold l.mu.
+func (l *Limiter) publish() {
+	if l.closed.Load() {
+		return
+	}
+	limitGauge.WithLabelValues(l.route, l.backend).Set(math.Floor(l.limit))
+	inflightGauge.WithLabelValues(l.route, l.backend).Set(float64(l.inflight))
+	queuedGauge.WithLabelValues(l.route, l.backend).Set(float64(l.queued))
+}
+
+func (l *Limiter) token() *Token {
+	return &Token{l: l, start: time.Now()}
+}
+
+// Token is a held concurrency slot.
+type Token struct {
+	l     *Limiter
+	start time.Time
+	once  sync.Once
+}
+
+// Done releases the slot. dropped marks the call as failed or overloaded
+// (5xx, transport error), which adaptive limits treat as congestion.
+// Safe to call on a nil Token and more than once.
+func (t *Token) Done(dropped bool) {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() { t.l.release(time.Since(t.start), dropped, true) })
+}
+
+// Release frees the slot without feeding a sample to the limit algorithm,
+// for a request that never reached the backend (shed further down, refused
+// by a circuit breaker). Safe to call on a nil Token and more than once.
+func (t *Token) Release() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() { t.l.release(0, false, false) })
+}
+
+// ---------------------------------------------------------------------------
+// Limit algorithms
+// ---------------------------------------------------------------------------
+
+// algorithm computes the next limit from one completed request.
+// inflight includes the request being released.
+type algorithm interface {
+	next(limit float64, rtt time.Duration, inflight int, dropped bool) float64
+}
+
+type fixedLimit struct{}
+
+func (fixedLimit) next(limit float64, _ time.Duration, _ int, _ bool) float64 { return limit }
+
+// aimdLimit grows the limit by one while it is being used and latency is
+// below threshold, and cuts it multiplicatively on slow or failed calls.
+type aimdLimit struct {
+	threshold time.Duration
+	backoff   float64
+}
+
+func (a *aimdLimit) next(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if dropped || rtt > a.threshold {
+		return limit * a.backoff
+	}
+	if float64(inflight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// gradientLimit compares a long-term latency baseline against the latest
+// sample: when latency rises above the baseline the limit shrinks in
+// proportion, otherwise it grows by a queue allowance of sqrt(limit).
+type gradientLimit struct {
+	smoothing float64
+	longRTT   float64 // EWMA in seconds
+}
+
+const gradientLongWindow = 600 // samples
+
+func (g *gradientLimit) next(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	sample := rtt.Seconds()
+	if g.longRTT == 0 {
+		g.longRTT = sample
+	} else {
+		g.longRTT += (sample - g.longRTT) * 2 / (gradientLongWindow + 1)
+	}
+	if dropped {
+		return limit * 0.9
+	}
+	// Don't grow a limit nobody is using.
+	if float64(inflight) < limit/2 {
+		return limit
+	}
+	gradient := 1.0
+	if sample > 0 {
+		gradient = math.Max(0.5, math.Min(1, g.longRTT/sample))
+	}
+	target := limit*gradient + math.Sqrt(limit)
+	return limit*(1-g.smoothing) + target*g.smoothing
+}
@@ -0,0 +1,232 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+func mustLimiter(t *testing.T, cfg config.ConcurrencyConfig) *Limiter {
+	t.Helper()
+	l, err := New(&cfg, "/test", "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return l
+}
+
+func TestNilLimiterAdmitsEverything(t *testing.T) {
+	var l *Limiter
+	tok, err := l.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("expected nil limiter to admit, got %v", err)
+	}
+	tok.Done(false) // must not panic
+}
+
+func TestFixedLimit_ShedsWithoutQueue(t *testing.T) {
+	l := mustLimiter(t, config.ConcurrencyConfig{Limit: 2})
+	ctx := context.Background()
+
+	a, _ := l.Acquire(ctx, PriorityNormal)
+	b, _ := l.Acquire(ctx, PriorityNormal)
+	if _, err := l.Acquire(ctx, PriorityNormal); !errors.Is(err, ErrShed) {
+		t.Fatalf("expected ErrShed at limit, got %v", err)
+	}
+
+	a.Done(false)
+	c, err := l.Acquire(ctx, PriorityNormal)
+	if err != nil {
+		t.Fatalf("expected slot after release, got %v", err)
+	}
+	b.Done(false)
+	c.Done(false)
+}
+
+func TestQueue_GrantsOnRelease(t *testing.T) {
+	l := mustLimiter(t, config.ConcurrencyConfig{Limit: 1, MaxQueue: 1, MaxWait: "1s"})
+	ctx := context.Background()
+
+	held, _ := l.Acquire(ctx, PriorityNormal)
+	got := make(chan error, 1)
+	go func() {
+		tok, err := l.Acquire(ctx, PriorityNormal)
+		tok.Done(false)
+		got <- err
+	}()
+
+	waitQueued(t, l, 1)
+	held.Done(false)
+	if err := <-got; err != nil {
+		t.Fatalf("expected queued request to be granted, got %v", err)
+	}
+}
+
+func TestQueue_TimesOut(t *testing.T) {
+	l := mustLimiter(t, config.ConcurrencyConfig{Limit: 1, MaxQueue: 1, MaxWait: "20ms"})
+	ctx := context.Background()
+
+	held, _ := l.Acquire(ctx, PriorityNormal)
+	defer held.Done(false)
+
+	start := time.Now()
+	if _, err := l.Acquire(ctx, PriorityNormal); !errors.Is(err, ErrShed) {
+		t.Fatalf("expected ErrShed after max_wait, got %v", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("expected request to wait for max_wait before being shed")
+	}
+	if l.queued != 0 {
+		t.Errorf("expected timed-out waiter to leave the queue, queued=%d", l.queued)
+	}
+}
+
+func TestQueue_PriorityOrderAndEviction(t *testing.T) {
+	l := mustLimiter(t, config.ConcurrencyConfig{Limit: 1, MaxQueue: 1, MaxWait: "1s"})
+	ctx := context.Background()
+
+	held, _ := l.Acquire(ctx, PriorityNormal)
+
+	low := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(ctx, PriorityLow)
+		low <- err
+	}()
+	waitQueued(t, l, 1)
+
+	// Queue is full: a high-priority request displaces the low one.
+	high := make(chan error, 1)
+	go func() {
+		tok, err := l.Acquire(ctx, PriorityHigh)
+		tok.Done(false)
+		high <- err
+	}()
+	if err := <-low; !errors.Is(err, ErrShed) {
+		t.Fatalf("expected low-priority waiter to be evicted, got %v", err)
+	}
+
+	// But a low-priority request cannot displace anyone.
+	waitQueued(t, l, 1)
+	if _, err := l.Acquire(ctx, PriorityLow); !errors.Is(err, ErrShed) {
+		t.Fatalf("expected low-priority request to be shed on a full queue, got %v", err)
+	}
+
+	held.Done(false)
+	if err := <-high; err != nil {
+		t.Fatalf("expected high-priority waiter to be granted, got %v", err)
+	}
+}
+
+func TestAIMD_AdaptsToLatency(t *testing.T) {
+	a := &aimdLimit{threshold: 100 * time.Millisecond, backoff: 0.9}
+
+	if got := a.next(10, 10*time.Millisecond, 8, false); got != 11 {
+		t.Errorf("expected additive increase under load, got %v", got)
+	}
+	if got := a.next(10, 10*time.Millisecond, 2, false); got != 10 {
+		t.Errorf("expected no increase while under-utilised, got %v", got)
+	}
+	if got := a.next(10, 200*time.Millisecond, 8, false); got != 9 {
+		t.Errorf("expected multiplicative decrease on slow call, got %v", got)
+	}
+	if got := a.next(10, 10*time.Millisecond, 8, true); got != 9 {
+		t.Errorf("expected multiplicative decrease on dropped call, got %v", got)
+	}
+}
+
+func TestGradient_ShrinksWhenLatencyRises(t *testing.T) {
+	g := &gradientLimit{smoothing: 0.2}
+	limit := 20.0
+	for i := 0; i < 100; i++ {
+		limit = g.next(limit, 10*time.Millisecond, int(limit), false)
+	}
+	steady := limit
+
+	for i := 0; i < 20; i++ {
+		limit = g.next(limit, 100*time.Millisecond, int(limit), false)
+	}
+	if limit >= steady {
+		t.Errorf("expected limit to fall when latency rises: steady=%.1f now=%.1f", steady, limit)
+	}
+}
+
+func TestLimiter_ClampsAdaptiveLimit(t *testing.T) {
+	l := mustLimiter(t, config.ConcurrencyConfig{Mode: "aimd", Limit: 4, MinLimit: 2, MaxLimit: 5, LatencyThreshold: "1ms"})
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		tok, _ := l.Acquire(ctx, PriorityNormal)
+		time.Sleep(2 * time.Millisecond) // slower than threshold
+		tok.Done(false)
+	}
+	if got := l.Limit(); got != 2 {
+		t.Errorf("expected limit clamped at min_limit 2, got %d", got)
+	}
+}
+
+func TestToken_ReleaseTakesNoSample(t *testing.T) {
+	l := mustLimiter(t, config.ConcurrencyConfig{Mode: "aimd", Limit: 4, MinLimit: 1, LatencyThreshold: "1ms"})
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		tok, _ := l.Acquire(ctx, PriorityNormal)
+		time.Sleep(2 * time.Millisecond) // slower than threshold
+		tok.Release()
+	}
+	if got := l.Limit(); got != 4 {
+		t.Errorf("expected released slots to leave the limit at 4, got %d", got)
+	}
+	if _, err := l.Acquire(ctx, PriorityNormal); err != nil {
+		t.Errorf("expected released slots to be free again, got %v", err)
+	}
+}
+
+func TestLimiter_CloseRemovesMetrics(t *testing.T) {
+	before, shedBefore := testutil.CollectAndCount(limitGauge), testutil.CollectAndCount(shedTotal)
+	l, err := New(&config.ConcurrencyConfig{Limit: 1}, "/test", "http://gone")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	tok, _ := l.Acquire(context.Background(), PriorityNormal)
+	if _, err := l.Acquire(context.Background(), PriorityNormal); !errors.Is(err, ErrShed) {
+		t.Fatalf("expected ErrShed at limit, got %v", err)
+	}
+	if n, m := testutil.CollectAndCount(limitGauge), testutil.CollectAndCount(shedTotal); n != before+1 || m != shedBefore+1 {
+		t.Fatalf("limit and shed series = %d, %d; want %d, %d", n, m, before+1, shedBefore+1)
+	}
+
+	l.Close()
+	tok.Done(false) // finishes without publishing again
+	if n, m := testutil.CollectAndCount(limitGauge), testutil.CollectAndCount(shedTotal); n != before || m != shedBefore {
+		t.Fatalf("limit and shed series = %d, %d after Close; want %d, %d", n, m, before, shedBefore)
+	}
+}
+
+func TestNew_RejectsBadConfig(t *testing.T) {
+	for _, cfg := range []config.ConcurrencyConfig{
+		{Limit: 0},
+		{Limit: 1, Mode: "bogus"},
+		{Limit: 1, MaxWait: "soon"},
+	} {
+		if _, err := New(&cfg, "/test", ""); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		q := l.queued
+		l.mu.Unlock()
+		if q == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued requests", n)
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +25,8 @@ type Config struct {
 	Logging LoggingConfig `yaml:"logging"`
 	Auth    AuthConfig    `yaml:"auth"`
 	Tracing TracingConfig `yaml:"tracing"`
+
+	HealthEvents HealthEventsConfig `yaml:"health_events"`
 }
 
 type AuthConfig struct {
@@ -37,10 +42,29 @@ type TracingConfig struct {
 	ServiceName string `yaml:"service_name"`
 }
 
+// HealthEventsConfig sends backend health state changes (active check
+// transitions and outlier ejections) outside the process. Events are always
+// logged.
+type HealthEventsConfig struct {
+	// URLs that receive each event as a JSON POST
+	Webhooks []string `yaml:"webhooks"`
+}
+
 type ServerConfig struct {
 	Addr                string `yaml:"addr"`
 	ReadTimeoutSeconds  int    `yaml:"read_timeout_seconds"`
 	WriteTimeoutSeconds int    `yaml:"write_timeout_seconds"`
+
+	// CIDRs (or bare IPs) of load balancers in front of the gateway. Only
+	// these peers may set X-Forwarded-For / X-Real-IP or a PROXY header.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// Expect a PROXY protocol v1/v2 header on connections from trusted proxies.
+	ProxyProtocol bool `yaml:"proxy_protocol"`
+
+	// Where this gateway runs, for routes with locality.zone_aware
+	Zone   string `yaml:"zone"`
+	Region string `yaml:"region"`
 }
 
 type AdminConfig struct {
@@ -59,15 +83,47 @@ type RouteConfig struct {
 	// Upstream backends
 	Backends []BackendConfig `yaml:"backends"`
 
-	// Load-balancing algorithm: round_robin | least_conn | weighted | ip_hash
+	// Optional source that replaces Backends at runtime, e.g. DNS
+	Discovery *DiscoveryConfig `yaml:"discovery,omitempty"`
+
+	// Load-balancing algorithm: round_robin | least_conn | weighted | ip_hash |
+	// ring_hash | maglev | p2c | peak_ewma
 	LBAlgorithm string `yaml:"lb_algorithm"`
 
+	// Hash key and tuning for ring_hash and maglev
+	Hash *HashConfig `yaml:"hash,omitempty"`
+
+	// Optional cookie-based session affinity on top of lb_algorithm
+	Sticky *StickyConfig `yaml:"sticky,omitempty"`
+
+	// Optional zone preference and priority failover between backend tiers
+	Locality *LocalityConfig `yaml:"locality,omitempty"`
+
+	// Percentage of backends that must be available; below it the route
+	// ignores health and uses every backend. 0 (default) disables.
+	PanicThreshold int `yaml:"panic_threshold,omitempty"`
+
 	// Optional per-route rate limiting
 	RateLimit *RateLimitConfig `yaml:"rate_limit,omitempty"`
 
 	// Optional circuit breaker
 	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
 
+	// Optional cap on in-flight requests for the whole route
+	Concurrency *ConcurrencyConfig `yaml:"concurrency,omitempty"`
+
+	// Optional cap on in-flight requests to each backend of the route
+	BackendConcurrency *ConcurrencyConfig `yaml:"backend_concurrency,omitempty"`
+
+	// Passive ejection of misbehaving backends; defaults apply when omitted
+	OutlierDetection *OutlierDetectionConfig `yaml:"outlier_detection,omitempty"`
+
+	// Active health checking; defaults apply when omitted
+	HealthCheck *HealthCheckConfig `yaml:"health_check,omitempty"`
+
+	// Optional traffic ramp-up for recovered and newly added backends
+	SlowStart *SlowStartConfig `yaml:"slow_start,omitempty"`
+
 	// Request timeout
 	TimeoutSeconds int `yaml:"timeout_seconds"`
 
@@ -78,26 +134,75 @@ type RouteConfig struct {
 type BackendConfig struct {
 	URL    string `yaml:"url"`
 	Weight int    `yaml:"weight"` // used by weighted algorithm; default 1
+
+	// Locality labels, used when the route sets locality
+	Zone     string `yaml:"zone,omitempty"`
+	Region   string `yaml:"region,omitempty"`
+	Priority int    `yaml:"priority,omitempty"` // 0 is the first choice; higher values are failover tiers
 }
 
 type RateLimitConfig struct {
-	// Algorithm: token_bucket | sliding_window
+	// Algorithm: token_bucket | sliding_window | gcra
+	// gcra needs redis_url; in-process it is equivalent to token_bucket.
 	Algorithm string `yaml:"algorithm"`
 
 	// Requests per second (token_bucket) or per window (sliding_window)
 	Rate int `yaml:"rate"`
 
-	// Burst size for token_bucket
+	// Burst size for token_bucket and gcra; defaults to rate
 	Burst int `yaml:"burst"`
 
 	// Window duration for sliding_window, e.g. "1m"
 	Window string `yaml:"window"`
 
-	// Key: ip | user | api_key
+	// Key: ip | user | api_key | header:<name> | cookie:<name> | query:<name> |
+	// claim:<name> | path:<n> | route | method, or several joined with "+"
+	// (e.g. "claim:tenant_id+method"). user is the JWT subject and needs
+	// auth on the route
 	KeyBy string `yaml:"key_by"`
 
+	// When a key source is absent: anonymous (shared bucket) | reject (400) | skip (no limit)
+	OnMissingKey string `yaml:"on_missing_key,omitempty"`
+
 	// Optional Redis URL for distributed limiting; if empty, in-process
 	RedisURL string `yaml:"redis_url,omitempty"`
+
+	// What to do while Redis is unreachable: open (allow) | closed (reject with 503) |
+	// local (in-process limiter enforcing this instance's share of rate/burst)
+	OnRedisError string `yaml:"on_redis_error,omitempty"`
+
+	// Number of gateway replicas sharing the Redis limit; sizes the local fallback. Default 1.
+	Instances int `yaml:"instances,omitempty"`
+
+	// Maximum keys tracked by an in-process limiter before the least recently
+	// seen are evicted. Default 1000000.
+	MaxKeys int `yaml:"max_keys,omitempty"`
+
+	// Quota headers sent on every response: legacy (X-RateLimit-*) | ietf (RateLimit-*) | none
+	Headers string `yaml:"headers,omitempty"`
+
+	// Tokens one request consumes unless a rule in costs matches. Default 1.
+	Cost int `yaml:"cost,omitempty"`
+
+	// Per-endpoint weights; the first matching rule wins
+	Costs []CostRule `yaml:"costs,omitempty"`
+
+	// Response header a backend may set to report the request's actual
+	// cost (e.g. "X-Request-Cost"); the difference is charged or refunded
+	CostHeader string `yaml:"cost_header,omitempty"`
+}
+
+// CostRule weights requests matching Method and Path.
+type CostRule struct {
+	// HTTP method; empty matches any
+	Method string `yaml:"method,omitempty"`
+
+	// Glob over the request path ("/v1/*/search"); a trailing "/**"
+	// matches the whole subtree
+	Path string `yaml:"path"`
+
+	// Tokens a matching request consumes
+	Cost int `yaml:"cost"`
 }
 
 type CircuitBreakerConfig struct {
@@ -112,6 +217,418 @@ type CircuitBreakerConfig struct {
 
 	// Number of probe requests in half-open state
 	HalfOpenRequests int `yaml:"half_open_requests"`
+
+	// Length of the rolling window failure_threshold applies to. Default "10s".
+	Window string `yaml:"window,omitempty"`
+
+	// Failures in a row that trip the breaker, whatever min_requests says.
+	// Default 0 (off).
+	ConsecutiveFailures int `yaml:"consecutive_failures,omitempty"`
+
+	// Calls slower than this count as failures, e.g. "2s". Default: off.
+	SlowCallThreshold string `yaml:"slow_call_threshold,omitempty"`
+
+	// Upstream status codes that count as failures, as codes ("429") or
+	// classes ("5xx"). Transport errors always do. Default ["5xx"].
+	FailureStatusCodes []string `yaml:"failure_status_codes,omitempty"`
+
+	// The open duration doubles with each trip that follows a recovery
+	// sooner than the last open duration, up to this. Default "300s".
+	MaxOpenDuration string `yaml:"max_open_duration,omitempty"`
+}
+
+// HealthCheckConfig tunes the active health checks of a route's backends.
+type HealthCheckConfig struct {
+	// Type: http (default) | tcp (connect) | tls (connect + handshake) |
+	// grpc (grpc.health.v1.Health/Check)
+	Type string `yaml:"type,omitempty"`
+
+	// Port to probe instead of the backend URL's port
+	Port int `yaml:"port,omitempty"`
+
+	// Service name sent in the gRPC health request; empty checks the whole server
+	GRPCService string `yaml:"grpc_service,omitempty"`
+
+	// TLS settings for tls, grpc and https checks
+	TLSServerName string `yaml:"tls_server_name,omitempty"`
+	TLSSkipVerify bool   `yaml:"tls_skip_verify,omitempty"`
+
+	// HTTP request path and method. Defaults "/health" and "GET".
+	Path   string `yaml:"path,omitempty"`
+	Method string `yaml:"method,omitempty"`
+
+	// Extra HTTP request headers; "Host" overrides the Host header (and the
+	// :authority of gRPC checks)
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Time between checks and per-check timeout. Defaults "10s" and "3s".
+	Interval string `yaml:"interval,omitempty"`
+	Timeout  string `yaml:"timeout,omitempty"`
+
+	// Maximum random delay before each check, so backends and routes are
+	// not probed in lockstep. Default: a tenth of the interval.
+	Jitter string `yaml:"jitter,omitempty"`
+
+	// Healthy HTTP status codes or ranges, e.g. ["200-299", "304"]. Default: anything below 500.
+	ExpectedStatuses []string `yaml:"expected_statuses,omitempty"`
+
+	// The response body must contain this substring and/or match this regexp
+	ExpectedBody      string `yaml:"expected_body,omitempty"`
+	ExpectedBodyRegex string `yaml:"expected_body_regex,omitempty"`
+
+	// Consecutive passes or failures needed to flip a backend. Default 1 each.
+	HealthyThreshold   int `yaml:"healthy_threshold,omitempty"`
+	UnhealthyThreshold int `yaml:"unhealthy_threshold,omitempty"`
+
+	// Probe results kept per backend for the admin API. Default 20; negative disables.
+	HistorySize int `yaml:"history_size,omitempty"`
+}
+
+// HashConfig tunes the consistent-hashing balancers.
+type HashConfig struct {
+	// What to hash: ip (default) | header:<name> | cookie:<name> |
+	// query:<name> | path. Requests without the value use the client IP.
+	Key string `yaml:"key,omitempty"`
+
+	// ring_hash: ring points per unit of backend weight. Default 100.
+	VirtualNodes int `yaml:"virtual_nodes,omitempty"`
+
+	// maglev: lookup table size; must be prime and well above the number of
+	// backends. Default 65537.
+	TableSize int `yaml:"table_size,omitempty"`
+}
+
+// LocalityConfig groups a route's backends into tiers by priority and, when
+// zone_aware is set, by distance from the gateway (server.zone, then
+// server.region). lb_algorithm runs within each tier.
+type LocalityConfig struct {
+	// Prefer backends in the gateway's zone, then its region
+	ZoneAware bool `yaml:"zone_aware"`
+
+	// Percentage of a tier's backends (by weight) that must be healthy for it
+	// to take all of its traffic; below that its share shrinks in proportion
+	// and the rest spills to the next tier. Default 70.
+	FailoverThreshold int `yaml:"failover_threshold,omitempty"`
+}
+
+// DiscoveryConfig keeps a route's backends in sync with an external source.
+// Static backends, if any, serve until the first successful lookup.
+// Exactly one source must be set.
+type DiscoveryConfig struct {
+	DNS        *DNSDiscoveryConfig        `yaml:"dns,omitempty"`
+	Kubernetes *KubernetesDiscoveryConfig `yaml:"kubernetes,omitempty"`
+	Consul     *ConsulDiscoveryConfig     `yaml:"consul,omitempty"`
+	File       *FileDiscoveryConfig       `yaml:"file,omitempty"`
+}
+
+// DNSDiscoveryConfig resolves backends from A/AAAA or SRV records and
+// re-resolves them when their TTL expires.
+type DNSDiscoveryConfig struct {
+	// Hostname for A/AAAA records, or an SRV name such as
+	// _http._tcp.orders.internal
+	Name string `yaml:"name"`
+
+	// a (default: A and AAAA records) | srv
+	Type string `yaml:"type,omitempty"`
+
+	// Backend port for A/AAAA records; SRV records carry their own
+	Port int `yaml:"port,omitempty"`
+
+	// Backend URL scheme; default http
+	Scheme string `yaml:"scheme,omitempty"`
+
+	// Longest time between lookups; a shorter TTL re-resolves sooner.
+	// Default 30s.
+	Interval string `yaml:"interval,omitempty"`
+
+	// DNS server as host[:port]; default the first nameserver in
+	// /etc/resolv.conf
+	Server string `yaml:"server,omitempty"`
+
+	// Per-query timeout; default 5s
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// KubernetesDiscoveryConfig watches the EndpointSlices of a Service and
+// routes to its ready endpoints. In a cluster the defaults use the pod's
+// service account, which needs get, list and watch on endpointslices.
+type KubernetesDiscoveryConfig struct {
+	// Service name
+	Service string `yaml:"service"`
+
+	// Default: the gateway pod's namespace, or "default" outside a cluster
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Service port name or number; default the first port
+	Port string `yaml:"port,omitempty"`
+
+	// Backend URL scheme; default http
+	Scheme string `yaml:"scheme,omitempty"`
+
+	// API server URL; default https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT
+	APIServer string `yaml:"api_server,omitempty"`
+
+	// Bearer token and CA bundle; default the service account's
+	TokenFile string `yaml:"token_file,omitempty"`
+	CAFile    string `yaml:"ca_file,omitempty"`
+}
+
+// ConsulDiscoveryConfig follows the healthy instances of a Consul service.
+type ConsulDiscoveryConfig struct {
+	// Service name
+	Service string `yaml:"service"`
+
+	// Consul HTTP API address; default $CONSUL_HTTP_ADDR or
+	// http://127.0.0.1:8500
+	Address string `yaml:"address,omitempty"`
+
+	// Default: the agent's datacenter
+	Datacenter string `yaml:"datacenter,omitempty"`
+
+	// Only instances with this tag
+	Tag string `yaml:"tag,omitempty"`
+
+	// ACL token; default $CONSUL_HTTP_TOKEN
+	Token string `yaml:"token,omitempty"`
+
+	// Backend URL scheme; default http
+	Scheme string `yaml:"scheme,omitempty"`
+
+	// Longest time a blocking query waits for a change; default 5m
+	Wait string `yaml:"wait,omitempty"`
+}
+
+// FileDiscoveryConfig reads backends from a file, reloaded when it changes.
+// The file holds a JSON or YAML list of backends with the same fields as
+// backends in this config (url, weight, zone, region, priority).
+type FileDiscoveryConfig struct {
+	Path string `yaml:"path"`
+}
+
+// StickyConfig pins clients to a backend with a signed cookie set on the
+// first response. Requests fall back to lb_algorithm, and the cookie is
+// rewritten, when the pinned backend is unhealthy, ejected or removed.
+type StickyConfig struct {
+	// Cookie name. Default "GW_STICKY".
+	Cookie string `yaml:"cookie,omitempty"`
+
+	// HMAC key for the cookie signature; share it across replicas. Empty
+	// uses a random per-process key, so cookies do not survive restarts.
+	Secret string `yaml:"secret,omitempty"`
+
+	// Cookie lifetime, e.g. "1h". Default: a session cookie.
+	TTL string `yaml:"ttl,omitempty"`
+
+	// Cookie attributes. Path defaults to "/", same_site to "lax".
+	Path     string `yaml:"path,omitempty"`
+	Secure   bool   `yaml:"secure,omitempty"`
+	SameSite string `yaml:"same_site,omitempty"` // lax | strict | none
+}
+
+// SlowStartConfig ramps a backend's share of traffic up over a window after
+// it recovers from a failed health check or ejection, or is added to the
+// route by a reload. Backends present at startup start at full weight.
+type SlowStartConfig struct {
+	// Length of the ramp, e.g. "30s". Required.
+	Window string `yaml:"window"`
+
+	// Share of its weight a backend starts with, in percent. Default 10.
+	MinWeightPercent int `yaml:"min_weight_percent,omitempty"`
+
+	// Shape of the ramp: the share grows as (elapsed/window)^(1/aggression).
+	// Default 1 (linear); larger values ramp up faster at first.
+	Aggression float64 `yaml:"aggression,omitempty"`
+}
+
+// OutlierDetectionConfig tunes passive outlier detection. Zero values use the
+// defaults; a negative threshold disables that check.
+type OutlierDetectionConfig struct {
+	// Consecutive 5xx responses (or transport errors) that eject a backend. Default 5.
+	Consecutive5xx int `yaml:"consecutive_5xx,omitempty"`
+
+	// Consecutive 502/503/504 responses or transport errors that eject a backend. Default 5.
+	ConsecutiveGatewayFailure int `yaml:"consecutive_gateway_failure,omitempty"`
+
+	// How often success rate and latency are compared across the pool and
+	// ejections are lifted. Default "10s".
+	Interval string `yaml:"interval,omitempty"`
+
+	// Ejection time; multiplied by the number of times the backend has been
+	// ejected recently. Default "30s".
+	BaseEjectionTime string `yaml:"base_ejection_time,omitempty"`
+
+	// Upper bound on a single ejection. Default "300s".
+	MaxEjectionTime string `yaml:"max_ejection_time,omitempty"`
+
+	// Maximum share of the pool that may be ejected at once. Default 10; at
+	// least one backend can always be ejected, and never the last one.
+	MaxEjectionPercent int `yaml:"max_ejection_percent,omitempty"`
+
+	// Backends with at least success_rate_request_volume requests in an
+	// interval are compared once success_rate_minimum_hosts of them qualify.
+	// Defaults 5 and 100.
+	SuccessRateMinimumHosts  int `yaml:"success_rate_minimum_hosts,omitempty"`
+	SuccessRateRequestVolume int `yaml:"success_rate_request_volume,omitempty"`
+
+	// A backend whose success rate is below mean - factor*stddev is
+	// ejected. Default 1.9.
+	SuccessRateStdevFactor float64 `yaml:"success_rate_stdev_factor,omitempty"`
+
+	// A backend whose mean latency exceeds factor times the pool median is
+	// ejected, using the same host and volume minimums. 0 (default) disables.
+	LatencyFactor float64 `yaml:"latency_factor,omitempty"`
+}
+
+type ConcurrencyConfig struct {
+	// Mode: fixed | aimd | gradient (adaptive modes move the limit with latency)
+	Mode string `yaml:"mode"`
+
+	// Concurrent requests allowed; the starting point for adaptive modes
+	Limit int `yaml:"limit"`
+
+	// Bounds for adaptive modes; default 1 and limit
+	MinLimit int `yaml:"min_limit"`
+	MaxLimit int `yaml:"max_limit"`
+
+	// Requests over the limit wait up to max_wait (e.g. "50ms") in a queue
+	// of max_queue entries; 0 sheds immediately
+	MaxQueue int    `yaml:"max_queue"`
+	MaxWait  string `yaml:"max_wait"`
+
+	// aimd: responses slower than this count as overload, e.g. "500ms"
+	LatencyThreshold string `yaml:"latency_threshold"`
+
+	// Request header carrying the priority class: high | normal | low.
+	// Only honoured from server.trusted_proxies, as clients could set it
+	// themselves
+	PriorityHeader string `yaml:"priority_header"`
+
+	// Claim of the validated JWT carrying the priority class; takes
+	// precedence over priority_header
+	PriorityClaim string `yaml:"priority_claim"`
+}
+
+// keysOnUser reports whether a key_by expression has a user part.
+func keysOnUser(keyBy string) bool {
+	for _, part := range strings.Split(keyBy, "+") {
+		if strings.TrimSpace(part) == "user" {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticates reports whether JWTs are validated on every path under
+// prefix.
+func (a *AuthConfig) authenticates(prefix string) bool {
+	if !a.Enabled {
+		return false
+	}
+	for _, skip := range a.SkipPaths {
+		if strings.HasPrefix(prefix, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CircuitBreakerSettings is a CircuitBreakerConfig with its defaults applied
+// and its durations and status codes parsed.
+type CircuitBreakerSettings struct {
+	MinRequests         int
+	FailureThreshold    int // percent
+	ConsecutiveFailures int // 0 disables
+	Window              time.Duration
+	SlowCallThreshold   time.Duration // 0 disables
+	FailureStatusCodes  []StatusRange
+	OpenDuration        time.Duration
+	MaxOpenDuration     time.Duration
+	HalfOpenRequests    int
+}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct{ Lo, Hi int }
+
+// Settings checks c and resolves its defaults. Both config validation and
+// circuitbreaker.New go through it, so a config that loads builds breakers.
+func (c *CircuitBreakerConfig) Settings() (CircuitBreakerSettings, error) {
+	s := CircuitBreakerSettings{
+		MinRequests:         c.MinRequests,
+		FailureThreshold:    c.FailureThreshold,
+		ConsecutiveFailures: c.ConsecutiveFailures,
+		OpenDuration:        time.Duration(c.OpenDurationSeconds) * time.Second,
+		HalfOpenRequests:    c.HalfOpenRequests,
+	}
+	if s.MinRequests == 0 {
+		s.MinRequests = 20
+	}
+	if s.FailureThreshold == 0 {
+		s.FailureThreshold = 50
+	}
+	if s.OpenDuration == 0 {
+		s.OpenDuration = 30 * time.Second
+	}
+	if s.HalfOpenRequests == 0 {
+		s.HalfOpenRequests = 5
+	}
+	if s.FailureThreshold < 0 || s.FailureThreshold > 100 {
+		return s, fmt.Errorf("circuit_breaker.failure_threshold %d: must be between 0 and 100", c.FailureThreshold)
+	}
+	if s.ConsecutiveFailures < 0 {
+		return s, fmt.Errorf("circuit_breaker.consecutive_failures %d: must not be negative", c.ConsecutiveFailures)
+	}
+
+	var err error
+	if s.Window, err = ParseDuration("circuit_breaker.window", c.Window, 10*time.Second); err != nil {
+		return s, err
+	}
+	if s.SlowCallThreshold, err = ParseDuration("circuit_breaker.slow_call_threshold", c.SlowCallThreshold, 0); err != nil {
+		return s, err
+	}
+	if s.MaxOpenDuration, err = ParseDuration("circuit_breaker.max_open_duration", c.MaxOpenDuration, max(300*time.Second, s.OpenDuration)); err != nil {
+		return s, err
+	}
+	if s.MaxOpenDuration < s.OpenDuration {
+		return s, fmt.Errorf("circuit_breaker.max_open_duration %q: shorter than open_duration_seconds", c.MaxOpenDuration)
+	}
+	codes := c.FailureStatusCodes
+	if len(codes) == 0 {
+		codes = []string{"5xx"}
+	}
+	for _, code := range codes {
+		r, err := parseStatusRange(code)
+		if err != nil {
+			return s, err
+		}
+		s.FailureStatusCodes = append(s.FailureStatusCodes, r)
+	}
+	return s, nil
+}
+
+// parseStatusRange parses a status code such as "429" or a class such as "5xx".
+func parseStatusRange(s string) (StatusRange, error) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+		lo := int(s[0]-'0') * 100
+		return StatusRange{lo, lo + 99}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 100 || n > 599 {
+		return StatusRange{}, fmt.Errorf("circuit_breaker.failure_status_codes %q: expected a status code or a class such as 5xx", s)
+	}
+	return StatusRange{n, n}, nil
+}
+
+// ParseDuration parses an optional duration field, returning def if it is
+// empty. Errors name the field.
+func ParseDuration(field, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s %q: must be a positive duration", field, s)
+	}
+	return d, nil
 }
 
 // ---------------------------------------------------------------------------
@@ -235,8 +752,8 @@ func validate(cfg *Config) error {
 		if r.PathPrefix == "" {
 			return fmt.Errorf("route[%d]: path_prefix is required", i)
 		}
-		if len(r.Backends) == 0 {
-			return fmt.Errorf("route %q: at least one backend required", r.PathPrefix)
+		if len(r.Backends) == 0 && r.Discovery == nil {
+			return fmt.Errorf("route %q: at least one backend or discovery required", r.PathPrefix)
 		}
 		for j := range r.Backends {
 			if r.Backends[j].Weight == 0 {
@@ -249,6 +766,47 @@ func validate(cfg *Config) error {
 		if r.TimeoutSeconds == 0 {
 			r.TimeoutSeconds = 30
 		}
+		if rl := r.RateLimit; rl != nil {
+			switch rl.Algorithm {
+			case "":
+				rl.Algorithm = "token_bucket"
+			case "token_bucket", "sliding_window", "gcra":
+			default:
+				return fmt.Errorf("route %q: unknown rate_limit.algorithm %q", r.PathPrefix, rl.Algorithm)
+			}
+			if rl.Burst == 0 {
+				rl.Burst = rl.Rate
+			}
+			switch rl.OnMissingKey {
+			case "":
+				rl.OnMissingKey = "anonymous"
+			case "anonymous", "reject", "skip":
+			default:
+				return fmt.Errorf("route %q: unknown rate_limit.on_missing_key %q", r.PathPrefix, rl.OnMissingKey)
+			}
+			switch rl.OnRedisError {
+			case "":
+				rl.OnRedisError = "open"
+			case "open", "closed", "local":
+			default:
+				return fmt.Errorf("route %q: unknown rate_limit.on_redis_error %q", r.PathPrefix, rl.OnRedisError)
+			}
+			if keysOnUser(rl.KeyBy) && !cfg.Auth.authenticates(r.PathPrefix) {
+				return fmt.Errorf("route %q: rate_limit.key_by %q keys on the JWT subject, which needs auth.enabled without a skip_paths entry for the route", r.PathPrefix, rl.KeyBy)
+			}
+			switch rl.Headers {
+			case "":
+				rl.Headers = "legacy"
+			case "legacy", "ietf", "none":
+			default:
+				return fmt.Errorf("route %q: unknown rate_limit.headers %q", r.PathPrefix, rl.Headers)
+			}
+		}
+		if cb := r.CircuitBreaker; cb != nil {
+			if _, err := cb.Settings(); err != nil {
+				return fmt.Errorf("route %q: %w", r.PathPrefix, err)
+			}
+		}
 	}
 
 	if cfg.Auth.Enabled {
@@ -257,6 +815,13 @@ func validate(cfg *Config) error {
 		}
 	}
 
+	for i, u := range cfg.HealthEvents.Webhooks {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("health_events.webhooks[%d] %q: want an http or https URL", i, u)
+		}
+	}
+
 	if cfg.Tracing.Enabled {
 		if cfg.Tracing.ServiceName == "" {
 			cfg.Tracing.ServiceName = "gateway-pro"
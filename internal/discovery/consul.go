@@ -0,0 +1,252 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+// ---------------------------------------------------------------------------
+// Consul discovery
+//
+// Follows a service's instances in the Consul health API with blocking
+// queries, so changes arrive as soon as Consul sees them. Instances with a
+// critical check (including maintenance mode) are left out; the others get
+// their registered passing or warning weight, as Consul's DNS interface does.
+// ---------------------------------------------------------------------------
+
+const (
+	defaultConsulAddr = "http://127.0.0.1:8500"
+	defaultConsulWait = 5 * time.Minute
+	maxConsulRetry    = 30 * time.Second
+)
+
+// Consul keeps a route's backends in sync with a Consul service.
+// A nil *Consul does nothing.
+type Consul struct {
+	service    string
+	addr       string
+	datacenter string
+	tag        string
+	token      string
+	scheme     string
+	wait       time.Duration
+	pace       time.Duration // least time between queries
+	client     *http.Client
+	route      string
+	log        *zap.SugaredLogger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewConsul validates cfg. Watching starts with Start.
+func NewConsul(cfg *config.ConsulDiscoveryConfig, route string, log *zap.SugaredLogger) (*Consul, error) {
+	if cfg.Service == "" {
+		return nil, errors.New("discovery.consul.service is required")
+	}
+	c := &Consul{
+		service:    cfg.Service,
+		addr:       cfg.Address,
+		datacenter: cfg.Datacenter,
+		tag:        cfg.Tag,
+		token:      cfg.Token,
+		scheme:     cfg.Scheme,
+		pace:       minRefresh,
+		route:      route,
+		log:        log,
+	}
+	if c.addr == "" {
+		c.addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if c.addr == "" {
+		c.addr = defaultConsulAddr
+	} else if !strings.Contains(c.addr, "://") {
+		c.addr = "http://" + c.addr
+	}
+	c.addr = strings.TrimSuffix(c.addr, "/")
+	if _, err := url.Parse(c.addr); err != nil {
+		return nil, fmt.Errorf("discovery.consul.address %q: %w", cfg.Address, err)
+	}
+	if c.token == "" {
+		c.token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if c.scheme == "" {
+		c.scheme = "http"
+	}
+	var err error
+	if c.wait, err = config.ParseDuration("discovery.consul.wait", cfg.Wait, defaultConsulWait); err != nil {
+		return nil, err
+	}
+	// Consul holds a blocking query for up to wait plus wait/16 of jitter
+	c.client = &http.Client{Timeout: c.wait + c.wait/16 + 10*time.Second}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// Start watches in the background until Stop, calling update with every
+// backend set that differs from the previous one. A failed query keeps the
+// last set; an empty answer is passed on, since it means no instance is
+// healthy.
+func (c *Consul) Start(update func([]config.BackendConfig)) {
+	if c == nil {
+		return
+	}
+	go func() {
+		var last []config.BackendConfig
+		var index uint64
+		backoff := time.Second
+		for {
+			started := time.Now()
+			backends, next, err := c.query(index)
+			wait := time.Duration(0)
+			if err != nil {
+				discoveryErrors.WithLabelValues(c.route).Inc()
+				c.log.Warnw("consul discovery failed, keeping previous backends",
+					"route", c.route, "service", c.service, "err", err, "retry_in", backoff)
+				wait, backoff = backoff, min(2*backoff, maxConsulRetry)
+			} else {
+				backoff = time.Second
+				// A lower index means Consul's state was reset: start over
+				if next < index {
+					next = 0
+				}
+				index = next
+				if (last == nil || !slices.Equal(backends, last)) && c.ctx.Err() == nil {
+					c.log.Infow("consul discovery updated backends", "route", c.route, "service", c.service, "backends", len(backends))
+					discoveredBackends.WithLabelValues(c.route).Set(float64(len(backends)))
+					update(backends)
+					last = backends
+				}
+				// Don't spin if Consul answers blocking queries at once
+				wait = c.pace - time.Since(started)
+			}
+
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop ends the watch. Safe to call more than once.
+func (c *Consul) Stop() {
+	if c == nil {
+		return
+	}
+	c.cancel()
+}
+
+// consulEntry is an element of /v1/health/service, only the fields used here.
+type consulEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Meta    map[string]string `json:"Meta"`
+		Weights *struct {
+			Passing int `json:"Passing"`
+			Warning int `json:"Warning"`
+		} `json:"Weights"`
+	} `json:"Service"`
+	Checks []struct {
+		Status string `json:"Status"` // passing | warning | critical | maintenance
+	} `json:"Checks"`
+}
+
+// query runs one blocking query from index and returns the backends sorted
+// by URL with the index to block on next.
+func (c *Consul) query(index uint64) ([]config.BackendConfig, uint64, error) {
+	q := url.Values{}
+	if c.datacenter != "" {
+		q.Set("dc", c.datacenter)
+	}
+	if c.tag != "" {
+		q.Set("tag", c.tag)
+	}
+	if index > 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", c.wait.String())
+	}
+	u := c.addr + "/v1/health/service/" + url.PathEscape(c.service) + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, 0, fmt.Errorf("consul: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	next, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: bad X-Consul-Index %q", resp.Header.Get("X-Consul-Index"))
+	}
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("consul: decode response: %w", err)
+	}
+
+	backends := make([]config.BackendConfig, 0, len(entries))
+	for _, e := range entries {
+		weight, ok := e.weight()
+		if !ok {
+			continue
+		}
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		backends = append(backends, config.BackendConfig{
+			URL:    c.scheme + "://" + net.JoinHostPort(addr, strconv.Itoa(e.Service.Port)),
+			Weight: weight,
+			Zone:   e.Service.Meta["zone"],
+			Region: e.Service.Meta["region"],
+		})
+	}
+	return sortBackends(backends), next, nil
+}
+
+// weight returns the instance's weight for its worst check status, and
+// false if it should get no traffic.
+func (e consulEntry) weight() (int, bool) {
+	passing, warning := 1, 1
+	if w := e.Service.Weights; w != nil {
+		passing, warning = w.Passing, w.Warning
+	}
+	weight := passing
+	for _, ch := range e.Checks {
+		switch ch.Status {
+		case "passing":
+		case "warning":
+			weight = warning
+		default:
+			return 0, false
+		}
+	}
+	return weight, weight > 0
+}
@@ -0,0 +1,188 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+// ---------------------------------------------------------------------------
+// Consul stand-in: /v1/health/service with blocking queries
+// ---------------------------------------------------------------------------
+
+type fakeConsul struct {
+	url string
+
+	mu      sync.Mutex
+	index   uint64
+	entries []any
+	fail    bool
+	changed chan struct{} // closed and replaced on every change
+	queries []consulQuery
+}
+
+type consulQuery struct{ index, wait, dc, tag string }
+
+func newFakeConsul(t *testing.T, entries ...any) *fakeConsul {
+	t.Helper()
+	c := &fakeConsul{index: 7, entries: entries, changed: make(chan struct{})}
+	srv := httptest.NewServer(http.HandlerFunc(c.serve))
+	t.Cleanup(srv.Close)
+	c.url = srv.URL
+	return c
+}
+
+func (c *fakeConsul) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/health/service/orders" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("X-Consul-Token") != "s3cret" {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	c.mu.Lock()
+	c.queries = append(c.queries, consulQuery{q.Get("index"), q.Get("wait"), q.Get("dc"), q.Get("tag")})
+	index, changed := c.index, c.changed
+	c.mu.Unlock()
+
+	// Block while the caller is up to date
+	if want, _ := strconv.ParseUint(q.Get("index"), 10, 64); want >= index {
+		wait, _ := time.ParseDuration(q.Get("wait"))
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail {
+		http.Error(w, "No cluster leader", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	json.NewEncoder(w).Encode(c.entries)
+}
+
+func (c *fakeConsul) set(fail bool, entries ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index++
+	c.fail, c.entries = fail, entries
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsul) seen() []consulQuery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.queries)
+}
+
+// instance is a health API entry; weights are omitted when passing is 0.
+func instance(node, addr string, port, passing, warning int, zone string, statuses ...string) map[string]any {
+	svc := map[string]any{"Address": addr, "Port": port, "Meta": map[string]string{"zone": zone}}
+	if passing > 0 {
+		svc["Weights"] = map[string]int{"Passing": passing, "Warning": warning}
+	}
+	var checks []any
+	for _, s := range statuses {
+		checks = append(checks, map[string]string{"Status": s})
+	}
+	return map[string]any{"Node": map[string]string{"Address": node}, "Service": svc, "Checks": checks}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestConsul_Watch(t *testing.T) {
+	old := minRefresh
+	minRefresh = 10 * time.Millisecond
+	t.Cleanup(func() { minRefresh = old })
+
+	consul := newFakeConsul(t,
+		instance("10.0.0.1", "", 8080, 3, 1, "eu-1a", "passing", "passing"),
+		instance("10.0.0.2", "10.1.0.2", 8080, 3, 1, "eu-1b", "passing", "warning"),
+		instance("10.0.0.3", "", 8080, 0, 0, "", "warning"),
+		instance("10.0.0.4", "", 8080, 0, 0, "", "passing", "critical"),
+		instance("10.0.0.5", "", 8080, 0, 0, "", "maintenance"),
+	)
+	c, err := NewConsul(&config.ConsulDiscoveryConfig{
+		Service: "orders", Address: consul.url, Datacenter: "eu", Tag: "v2", Token: "s3cret", Wait: "2s",
+	}, "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewConsul: %v", err)
+	}
+	t.Cleanup(c.Stop)
+
+	updates := make(chan []config.BackendConfig, 10)
+	c.Start(func(bs []config.BackendConfig) { updates <- bs })
+	next := func() []config.BackendConfig {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(3 * time.Second):
+			t.Fatal("no update")
+			return nil
+		}
+	}
+
+	want := []config.BackendConfig{
+		{URL: "http://10.0.0.1:8080", Weight: 3, Zone: "eu-1a"},
+		{URL: "http://10.0.0.3:8080", Weight: 1},
+		{URL: "http://10.1.0.2:8080", Weight: 1, Zone: "eu-1b"},
+	}
+	if got := next(); !slices.Equal(got, want) {
+		t.Fatalf("backends = %+v\nwant %+v", got, want)
+	}
+
+	// A failing agent keeps the last set: no update
+	consul.set(true)
+	time.Sleep(50 * time.Millisecond)
+	consul.set(false, instance("10.0.0.9", "", 9090, 0, 0, ""))
+	if got := urls(next()); !slices.Equal(got, []string{"http://10.0.0.9:9090"}) {
+		t.Fatalf("after change = %v", got)
+	}
+
+	qs := consul.seen()
+	if first := qs[0]; first != (consulQuery{"", "", "eu", "v2"}) {
+		t.Errorf("first query = %+v, want no index and dc, tag set", first)
+	}
+	if second := qs[1]; second.index != "7" || second.wait != "2s" {
+		t.Errorf("second query = %+v, want a blocking query from index 7", second)
+	}
+}
+
+func TestConsul_Errors(t *testing.T) {
+	for _, cfg := range []config.ConsulDiscoveryConfig{
+		{},
+		{Service: "orders", Wait: "forever"},
+	} {
+		if _, err := NewConsul(&cfg, "/test", zap.NewNop().Sugar()); err == nil {
+			t.Errorf("NewConsul(%+v): expected error", cfg)
+		}
+	}
+
+	t.Setenv("CONSUL_HTTP_TOKEN", "")
+	consul := newFakeConsul(t)
+	c, err := NewConsul(&config.ConsulDiscoveryConfig{Service: "orders", Address: consul.url}, "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	if _, _, err := c.query(0); err == nil {
+		t.Fatal("expected an error without the ACL token")
+	}
+}
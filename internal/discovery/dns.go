@@ -0,0 +1,375 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ---------------------------------------------------------------------------
+// DNS discovery
+//
+// Resolves a hostname's A and AAAA records, or an SRV name's targets, into
+// backends and re-resolves when the shortest TTL expires (at most every
+// interval). A failed or empty answer keeps the last good backend set, so a
+// DNS outage does not empty the route.
+// ---------------------------------------------------------------------------
+
+var (
+	discoveredBackends = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Name:      "discovery_backends",
+		Help:      "Backends in a route's last discovered set.",
+	}, []string{"route"})
+
+	discoveryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Name:      "discovery_errors_total",
+		Help:      "Failed backend discovery attempts; the last good set stays in use.",
+	}, []string{"route"})
+)
+
+const (
+	defaultDNSInterval = 30 * time.Second
+	defaultDNSTimeout  = 5 * time.Second
+	defaultResolvConf  = "/etc/resolv.conf"
+)
+
+// minRefresh bounds how often a low TTL can make us re-resolve.
+var minRefresh = time.Second
+
+// DNS keeps a route's backends in sync with DNS records.
+// A nil *DNS does nothing.
+type DNS struct {
+	name     string
+	srv      bool
+	port     int
+	scheme   string
+	server   string
+	interval time.Duration
+	timeout  time.Duration
+	route    string
+	log      *zap.SugaredLogger
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewDNS validates cfg. Resolution starts with Start.
+func NewDNS(cfg *config.DNSDiscoveryConfig, route string, log *zap.SugaredLogger) (*DNS, error) {
+	d := &DNS{
+		name:   fqdn(cfg.Name),
+		port:   cfg.Port,
+		scheme: cfg.Scheme,
+		server: cfg.Server,
+		route:  route,
+		log:    log,
+		stop:   make(chan struct{}),
+	}
+	if cfg.Name == "" {
+		return nil, errors.New("discovery.dns.name is required")
+	}
+	switch cfg.Type {
+	case "", "a":
+		if d.port <= 0 || d.port > 65535 {
+			return nil, fmt.Errorf("discovery.dns.port %d: required for A/AAAA records", cfg.Port)
+		}
+	case "srv":
+		d.srv = true
+	default:
+		return nil, fmt.Errorf("discovery.dns.type %q: expected a or srv", cfg.Type)
+	}
+	if d.scheme == "" {
+		d.scheme = "http"
+	}
+	if d.server == "" {
+		d.server = systemNameserver(defaultResolvConf)
+	} else if _, _, err := net.SplitHostPort(d.server); err != nil {
+		d.server = net.JoinHostPort(d.server, "53")
+	}
+	var err error
+	if d.interval, err = config.ParseDuration("discovery.dns.interval", cfg.Interval, defaultDNSInterval); err != nil {
+		return nil, err
+	}
+	if d.timeout, err = config.ParseDuration("discovery.dns.timeout", cfg.Timeout, defaultDNSTimeout); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Start resolves in the background until Stop, calling update with every
+// backend set that differs from the previous one.
+func (d *DNS) Start(update func([]config.BackendConfig)) {
+	if d == nil {
+		return
+	}
+	go func() {
+		var last []config.BackendConfig
+		for {
+			backends, ttl, err := d.Resolve(context.Background()) // queries time out on their own
+
+			wait := d.interval
+			if err != nil {
+				discoveryErrors.WithLabelValues(d.route).Inc()
+				d.log.Warnw("dns discovery failed, keeping previous backends",
+					"route", d.route, "name", d.name, "err", err)
+				wait = min(wait, d.timeout)
+			} else {
+				wait = max(min(wait, ttl), minRefresh)
+				if !slices.Equal(backends, last) && !d.stopped() {
+					d.log.Infow("dns discovery updated backends", "route", d.route, "name", d.name, "backends", len(backends))
+					discoveredBackends.WithLabelValues(d.route).Set(float64(len(backends)))
+					update(backends)
+					last = backends
+				}
+			}
+
+			select {
+			case <-d.stop:
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop ends background resolution. Safe to call more than once.
+func (d *DNS) Stop() {
+	if d == nil {
+		return
+	}
+	d.once.Do(func() { close(d.stop) })
+}
+
+// stopped reports whether Stop was called, so that a lookup that was in
+// flight does not publish its result afterwards.
+func (d *DNS) stopped() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Resolve looks the name up once and returns the backends sorted by URL,
+// with the shortest TTL among the records used.
+func (d *DNS) Resolve(ctx context.Context) ([]config.BackendConfig, time.Duration, error) {
+	var backends []config.BackendConfig
+	var ttl uint32
+	if d.srv {
+		m, err := d.query(ctx, d.name, dnsmessage.TypeSRV)
+		if err != nil {
+			return nil, 0, err
+		}
+		ttl = minTTL(m.answers, dnsmessage.TypeSRV)
+		for _, rr := range m.answers {
+			if rr.typ != dnsmessage.TypeSRV {
+				continue
+			}
+			ips, ipTTL := m.addresses(rr.srv.target)
+			if len(ips) == 0 {
+				if ips, ipTTL, err = d.lookupIP(ctx, rr.srv.target); err != nil {
+					return nil, 0, fmt.Errorf("srv target %s: %w", rr.srv.target, err)
+				}
+			}
+			ttl = min(ttl, ipTTL)
+			for _, ip := range ips {
+				backends = append(backends, config.BackendConfig{
+					URL:      d.url(ip, int(rr.srv.port)),
+					Weight:   max(int(rr.srv.weight), 1),
+					Priority: int(rr.srv.priority),
+				})
+			}
+		}
+	} else {
+		ips, ipTTL, err := d.lookupIP(ctx, d.name)
+		if err != nil {
+			return nil, 0, err
+		}
+		ttl = ipTTL
+		for _, ip := range ips {
+			backends = append(backends, config.BackendConfig{URL: d.url(ip, d.port), Weight: 1})
+		}
+	}
+	if len(backends) == 0 {
+		return nil, 0, fmt.Errorf("%s: no records", d.name)
+	}
+	return sortBackends(backends), time.Duration(ttl) * time.Second, nil
+}
+
+// sortBackends sorts bs by URL and drops duplicates.
+func sortBackends(bs []config.BackendConfig) []config.BackendConfig {
+	slices.SortFunc(bs, func(a, b config.BackendConfig) int { return strings.Compare(a.URL, b.URL) })
+	return slices.CompactFunc(bs, func(a, b config.BackendConfig) bool { return a.URL == b.URL })
+}
+
+func (d *DNS) url(ip net.IP, port int) string {
+	return d.scheme + "://" + net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// lookupIP returns the A and AAAA addresses of name. Either lookup may fail
+// as long as the other returns addresses.
+func (d *DNS) lookupIP(ctx context.Context, name string) ([]net.IP, uint32, error) {
+	var ips []net.IP
+	var ttl uint32
+	var firstErr error
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		m, err := d.query(ctx, name, typ)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		n := len(ips)
+		for _, rr := range m.answers {
+			if rr.typ == typ {
+				ips = append(ips, rr.ip)
+			}
+		}
+		if t := minTTL(m.answers, typ); len(ips) > n && (n == 0 || t < ttl) {
+			ttl = t
+		}
+	}
+	if len(ips) == 0 {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: no records", name)
+		}
+		return nil, 0, firstErr
+	}
+	return ips, ttl, nil
+}
+
+// addresses returns the addresses of name in the additional section.
+func (m *message) addresses(name string) ([]net.IP, uint32) {
+	var ips []net.IP
+	var used []record
+	for _, rr := range m.additional {
+		if (rr.typ == dnsmessage.TypeA || rr.typ == dnsmessage.TypeAAAA) && rr.name == name {
+			ips = append(ips, rr.ip)
+			used = append(used, rr)
+		}
+	}
+	return ips, minTTL(used, 0)
+}
+
+// minTTL returns the shortest TTL among recs of type typ (any type if 0).
+func minTTL(recs []record, typ dnsmessage.Type) uint32 {
+	ttl := uint32(0)
+	found := false
+	for _, rr := range recs {
+		if (typ == 0 || rr.typ == typ) && (!found || rr.ttl < ttl) {
+			ttl, found = rr.ttl, true
+		}
+	}
+	return ttl
+}
+
+// query sends one question over UDP, retrying over TCP if the answer was
+// truncated.
+func (d *DNS) query(ctx context.Context, name string, typ dnsmessage.Type) (*message, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	id := uint16(rand.N(1 << 16))
+	q, err := buildQuery(id, name, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := d.exchange(ctx, "udp", q, id)
+	if err == nil && m.truncated {
+		m, err = d.exchange(ctx, "tcp", q, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch m.rcode {
+	case dnsmessage.RCodeSuccess:
+		return m, nil
+	case dnsmessage.RCodeNameError:
+		return nil, fmt.Errorf("%s: no such host", name)
+	default:
+		return nil, fmt.Errorf("%s: server %s answered with rcode %d", name, d.server, m.rcode)
+	}
+}
+
+func (d *DNS) exchange(ctx context.Context, network string, q []byte, id uint16) (*message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		msg := binary.BigEndian.AppendUint16(nil, uint16(len(q)))
+		if _, err := conn.Write(append(msg, q...)); err != nil {
+			return nil, err
+		}
+		var n [2]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(n[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+		m, err := parseMessage(buf)
+		if err == nil && m.id != id {
+			err = errors.New("dns: response id mismatch")
+		}
+		return m, err
+	}
+
+	if _, err := conn.Write(q); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray or spoofed answers to other queries
+		if m, err := parseMessage(buf[:n]); err == nil && m.id == id {
+			return m, nil
+		}
+	}
+}
+
+// systemNameserver returns the first nameserver in resolv.conf, or the
+// local resolver if there is none.
+func systemNameserver(path string) string {
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
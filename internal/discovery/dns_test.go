@@ -0,0 +1,337 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ---------------------------------------------------------------------------
+// DNS stub: answers from an in-memory zone over UDP and TCP on one port
+// ---------------------------------------------------------------------------
+
+type zoneKey struct {
+	name string
+	typ  dnsmessage.Type
+}
+
+type zoneAnswer struct {
+	answers    []record
+	additional []record
+	rcode      dnsmessage.RCode
+	truncate   bool // over UDP, answer with TC set and no records
+}
+
+type dnsStub struct {
+	addr string
+	mu   sync.Mutex
+	zone map[zoneKey]zoneAnswer
+}
+
+func newDNSStub(t *testing.T) *dnsStub {
+	t.Helper()
+	s := &dnsStub{zone: map[zoneKey]zoneAnswer{}}
+	var pc net.PacketConn
+	var ln net.Listener
+	for i := 0; ln == nil && i < 10; i++ {
+		var err error
+		if pc, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatalf("listen udp: %v", err)
+		}
+		if ln, err = net.Listen("tcp", pc.LocalAddr().String()); err != nil {
+			pc.Close()
+		}
+	}
+	if ln == nil {
+		t.Fatal("no port free for both udp and tcp")
+	}
+	t.Cleanup(func() { pc.Close(); ln.Close() })
+	s.addr = pc.LocalAddr().String()
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.answer(buf[:n], true); resp != nil {
+				pc.WriteTo(resp, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var n [2]byte
+			if _, err := io.ReadFull(c, n[:]); err == nil {
+				q := make([]byte, binary.BigEndian.Uint16(n[:]))
+				if _, err := io.ReadFull(c, q); err == nil {
+					resp := s.answer(q, false)
+					c.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+				}
+			}
+			c.Close()
+		}
+	}()
+	return s
+}
+
+func (s *dnsStub) set(name string, typ dnsmessage.Type, a zoneAnswer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zone[zoneKey{fqdn(name), typ}] = a
+}
+
+func (s *dnsStub) answer(q []byte, udp bool) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(q)
+	if err != nil {
+		return nil
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	a := s.zone[zoneKey{fqdn(question.Name.String()), question.Type}]
+	s.mu.Unlock()
+
+	if a.truncate && udp {
+		a.answers, a.additional = nil, nil
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID: h.ID, Response: true, RecursionDesired: true, RecursionAvailable: true,
+		RCode: a.rcode, Truncated: a.truncate && udp,
+	})
+	// Compress names against the question, as real servers do
+	b.EnableCompression()
+	_ = b.StartQuestions()
+	_ = b.Question(question)
+	_ = b.StartAnswers()
+	for _, rr := range a.answers {
+		appendRecord(&b, rr)
+	}
+	_ = b.StartAdditionals()
+	for _, rr := range a.additional {
+		appendRecord(&b, rr)
+	}
+	resp, _ := b.Finish()
+	return resp
+}
+
+func appendRecord(b *dnsmessage.Builder, rr record) {
+	h := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(fqdn(rr.name)), Class: dnsmessage.ClassINET, TTL: rr.ttl}
+	switch rr.typ {
+	case dnsmessage.TypeA:
+		var r dnsmessage.AResource
+		copy(r.A[:], rr.ip.To4())
+		_ = b.AResource(h, r)
+	case dnsmessage.TypeAAAA:
+		var r dnsmessage.AAAAResource
+		copy(r.AAAA[:], rr.ip.To16())
+		_ = b.AAAAResource(h, r)
+	case dnsmessage.TypeSRV:
+		_ = b.SRVResource(h, dnsmessage.SRVResource{
+			Priority: rr.srv.priority, Weight: rr.srv.weight, Port: rr.srv.port,
+			Target: dnsmessage.MustNewName(fqdn(rr.srv.target)),
+		})
+	}
+}
+
+func a(name, ip string, ttl uint32) record {
+	typ := dnsmessage.TypeA
+	if net.ParseIP(ip).To4() == nil {
+		typ = dnsmessage.TypeAAAA
+	}
+	return record{name: name, typ: typ, ttl: ttl, ip: net.ParseIP(ip)}
+}
+
+func srv(name, target string, prio, weight, port uint16, ttl uint32) record {
+	return record{name: name, typ: dnsmessage.TypeSRV, ttl: ttl, srv: srvData{prio, weight, port, target}}
+}
+
+func newTestDNS(t *testing.T, stub *dnsStub, cfg config.DNSDiscoveryConfig) *DNS {
+	t.Helper()
+	cfg.Server = stub.addr
+	cfg.Timeout = "1s"
+	d, err := NewDNS(&cfg, "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewDNS: %v", err)
+	}
+	t.Cleanup(d.Stop)
+	return d
+}
+
+func urls(bs []config.BackendConfig) []string {
+	var out []string
+	for _, b := range bs {
+		out = append(out, b.URL)
+	}
+	return out
+}
+
+// ---------------------------------------------------------------------------
+
+func TestDNS_AddressRecords(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.set("orders.internal", dnsmessage.TypeA, zoneAnswer{answers: []record{
+		a("orders.internal", "10.0.0.2", 60), a("orders.internal", "10.0.0.1", 60),
+	}})
+	stub.set("orders.internal", dnsmessage.TypeAAAA, zoneAnswer{answers: []record{a("orders.internal", "fd00::1", 20)}})
+	d := newTestDNS(t, stub, config.DNSDiscoveryConfig{Name: "orders.internal", Port: 8080})
+
+	bs, ttl, err := d.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://[fd00::1]:8080"}
+	if got := urls(bs); !slices.Equal(got, want) {
+		t.Fatalf("backends = %v, want %v", got, want)
+	}
+	if ttl != 20*time.Second {
+		t.Fatalf("ttl = %v, want the shortest record TTL 20s", ttl)
+	}
+}
+
+func TestDNS_SRVRecords(t *testing.T) {
+	stub := newDNSStub(t)
+	name := "_http._tcp.orders.internal"
+	stub.set(name, dnsmessage.TypeSRV, zoneAnswer{
+		answers: []record{
+			srv(name, "a.orders.internal", 0, 3, 9001, 120),
+			srv(name, "dr.orders.internal", 1, 0, 9002, 120),
+		},
+		additional: []record{a("a.orders.internal", "10.0.0.1", 90)},
+	})
+	// No glue for the DR target: looked up separately
+	stub.set("dr.orders.internal", dnsmessage.TypeA, zoneAnswer{answers: []record{a("dr.orders.internal", "10.9.0.1", 45)}})
+	d := newTestDNS(t, stub, config.DNSDiscoveryConfig{Name: name, Type: "srv"})
+
+	bs, ttl, err := d.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := []config.BackendConfig{
+		{URL: "http://10.0.0.1:9001", Weight: 3},
+		{URL: "http://10.9.0.1:9002", Weight: 1, Priority: 1},
+	}
+	if !slices.Equal(bs, want) {
+		t.Fatalf("backends = %+v, want %+v", bs, want)
+	}
+	if ttl != 45*time.Second {
+		t.Fatalf("ttl = %v, want 45s", ttl)
+	}
+}
+
+func TestDNS_TruncatedRetriesOverTCP(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.set("big.internal", dnsmessage.TypeA, zoneAnswer{truncate: true, answers: []record{a("big.internal", "10.0.0.7", 60)}})
+	d := newTestDNS(t, stub, config.DNSDiscoveryConfig{Name: "big.internal", Port: 80, Scheme: "https"})
+
+	bs, _, err := d.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := urls(bs); !slices.Equal(got, []string{"https://10.0.0.7:80"}) {
+		t.Fatalf("backends = %v", got)
+	}
+}
+
+func TestDNS_Errors(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.set("gone.internal", dnsmessage.TypeA, zoneAnswer{rcode: dnsmessage.RCodeNameError})
+	stub.set("gone.internal", dnsmessage.TypeAAAA, zoneAnswer{rcode: dnsmessage.RCodeNameError})
+	if _, _, err := newTestDNS(t, stub, config.DNSDiscoveryConfig{Name: "gone.internal", Port: 80}).Resolve(context.Background()); err == nil {
+		t.Error("expected an error for NXDOMAIN")
+	}
+	if _, _, err := newTestDNS(t, stub, config.DNSDiscoveryConfig{Name: "empty.internal", Port: 80}).Resolve(context.Background()); err == nil {
+		t.Error("expected an error for an empty answer")
+	}
+
+	for _, cfg := range []config.DNSDiscoveryConfig{
+		{},
+		{Name: "x.internal"},
+		{Name: "x.internal", Port: 80, Type: "mx"},
+		{Name: "x.internal", Port: 80, Interval: "soon"},
+	} {
+		if _, err := NewDNS(&cfg, "/test", zap.NewNop().Sugar()); err == nil {
+			t.Errorf("NewDNS(%+v): expected error", cfg)
+		}
+	}
+}
+
+func TestParseMessage_Malformed(t *testing.T) {
+	stub := &dnsStub{zone: map[zoneKey]zoneAnswer{}}
+	stub.set("svc.internal", dnsmessage.TypeSRV, zoneAnswer{
+		answers:    []record{srv("svc.internal", "a.svc.internal", 1, 1, 80, 30)},
+		additional: []record{a("a.svc.internal", "10.0.0.1", 30)},
+	})
+	q, err := buildQuery(7, "svc.internal", dnsmessage.TypeSRV)
+	if err != nil {
+		t.Fatalf("buildQuery: %v", err)
+	}
+	resp := stub.answer(q, false)
+	if m, err := parseMessage(resp); err != nil || len(m.answers) != 1 || len(m.additional) != 1 {
+		t.Fatalf("parseMessage: %+v, %v", m, err)
+	}
+	for n := 0; n < len(resp); n++ {
+		if _, err := parseMessage(resp[:n]); err == nil {
+			t.Errorf("expected an error for the message cut to %d bytes", n)
+		}
+	}
+
+	// An answer whose name points at itself
+	loop := []byte{0, 7, 0x81, 0x80, 0, 0, 0, 1, 0, 0, 0, 0, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 30, 0, 4, 10, 0, 0, 1}
+	if _, err := parseMessage(loop); err == nil {
+		t.Error("expected an error for a compression pointer loop")
+	}
+}
+
+func TestDNS_StartFollowsTTL(t *testing.T) {
+	old := minRefresh
+	minRefresh = 10 * time.Millisecond
+	t.Cleanup(func() { minRefresh = old })
+
+	stub := newDNSStub(t)
+	stub.set("svc.internal", dnsmessage.TypeA, zoneAnswer{answers: []record{a("svc.internal", "10.0.0.1", 0)}})
+	d := newTestDNS(t, stub, config.DNSDiscoveryConfig{Name: "svc.internal", Port: 80, Interval: "1h"})
+
+	updates := make(chan []string, 10)
+	d.Start(func(bs []config.BackendConfig) { updates <- urls(bs) })
+	next := func() []string {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(2 * time.Second):
+			t.Fatal("no update; the 0s TTL should trigger re-resolution long before the 1h interval")
+			return nil
+		}
+	}
+	if got := next(); !slices.Equal(got, []string{"http://10.0.0.1:80"}) {
+		t.Fatalf("first update = %v", got)
+	}
+
+	// A failing server keeps the last set: no empty update
+	stub.set("svc.internal", dnsmessage.TypeA, zoneAnswer{rcode: 2})
+	time.Sleep(50 * time.Millisecond)
+	stub.set("svc.internal", dnsmessage.TypeA, zoneAnswer{answers: []record{
+		a("svc.internal", "10.0.0.1", 0), a("svc.internal", "10.0.0.2", 0),
+	}})
+	if got := next(); !slices.Equal(got, []string{"http://10.0.0.1:80", "http://10.0.0.2:80"}) {
+		t.Fatalf("second update = %v", got)
+	}
+}
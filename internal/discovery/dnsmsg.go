@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ---------------------------------------------------------------------------
+// DNS messages for A, AAAA and SRV (RFC 2782) lookups, packed and parsed
+// with x/net's dnsmessage. The standard library resolver does not expose
+// TTLs, which the refresh loop needs.
+// ---------------------------------------------------------------------------
+
+type srvData struct {
+	priority, weight, port uint16
+	target                 string
+}
+
+// record is a parsed resource record; ip is set for A and AAAA, srv for SRV.
+type record struct {
+	name string
+	typ  dnsmessage.Type
+	ttl  uint32
+	ip   net.IP
+	srv  srvData
+}
+
+type message struct {
+	id         uint16
+	rcode      dnsmessage.RCode
+	truncated  bool
+	answers    []record
+	additional []record
+}
+
+// fqdn lower-cases name and adds the trailing dot.
+func fqdn(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// buildQuery returns a recursive query for name.
+func buildQuery(id uint16, name string, typ dnsmessage.Type) ([]byte, error) {
+	n, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, fmt.Errorf("dns: invalid name %q", name)
+	}
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: n, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	b, err := q.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("dns: invalid name %q: %w", name, err)
+	}
+	return b, nil
+}
+
+func parseMessage(b []byte) (*message, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(b)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{id: h.ID, rcode: h.RCode, truncated: h.Truncated}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+	if m.answers, err = readRecords(&p, p.AnswerHeader, p.SkipAnswer); err != nil {
+		return nil, err
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return nil, err
+	}
+	if m.additional, err = readRecords(&p, p.AdditionalHeader, p.SkipAdditional); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readRecords reads the A, AAAA and SRV records of one section, using next
+// and skip of that section, and skips the others.
+func readRecords(p *dnsmessage.Parser, next func() (dnsmessage.ResourceHeader, error), skip func() error) ([]record, error) {
+	var recs []record
+	for {
+		h, err := next()
+		if err == dnsmessage.ErrSectionDone {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r := record{name: fqdn(h.Name.String()), typ: h.Type, ttl: h.TTL}
+		switch h.Type {
+		case dnsmessage.TypeA:
+			a, err := p.AResource()
+			if err != nil {
+				return nil, err
+			}
+			r.ip = net.IP(a.A[:])
+		case dnsmessage.TypeAAAA:
+			aaaa, err := p.AAAAResource()
+			if err != nil {
+				return nil, err
+			}
+			r.ip = net.IP(aaaa.AAAA[:])
+		case dnsmessage.TypeSRV:
+			s, err := p.SRVResource()
+			if err != nil {
+				return nil, err
+			}
+			r.srv = srvData{s.Priority, s.Weight, s.Port, fqdn(s.Target.String())}
+		default:
+			if err := skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		recs = append(recs, r)
+	}
+}
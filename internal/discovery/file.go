@@ -0,0 +1,166 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ---------------------------------------------------------------------------
+// File discovery
+//
+// Reads backends from a JSON (or YAML) list written by a deploy tool and
+// reloads it when the file changes. The directory is watched rather than the
+// file, so tools that replace the file atomically (write and rename) and
+// Kubernetes ConfigMap volumes are picked up too. A file that is missing,
+// malformed or empty keeps the last good set.
+// ---------------------------------------------------------------------------
+
+// fileDebounce lets a writer finish before the file is read.
+var fileDebounce = 200 * time.Millisecond
+
+// File keeps a route's backends in sync with a file.
+// A nil *File does nothing.
+type File struct {
+	path  string
+	route string
+	log   *zap.SugaredLogger
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewFile validates cfg. Watching starts with Start.
+func NewFile(cfg *config.FileDiscoveryConfig, route string, log *zap.SugaredLogger) (*File, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("discovery.file.path is required")
+	}
+	if fi, err := os.Stat(filepath.Dir(cfg.Path)); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("discovery.file.path %q: directory does not exist", cfg.Path)
+	}
+	return &File{path: cfg.Path, route: route, log: log, stop: make(chan struct{})}, nil
+}
+
+// Start reads the file and then rereads it on every change until Stop,
+// calling update with every backend set that differs from the previous one.
+func (f *File) Start(update func([]config.BackendConfig)) {
+	if f == nil {
+		return
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = fsw.Add(filepath.Dir(f.path)); err != nil {
+			fsw.Close()
+		}
+	}
+	if err != nil {
+		discoveryErrors.WithLabelValues(f.route).Inc()
+		f.log.Warnw("file discovery cannot watch for changes, reading the file once",
+			"route", f.route, "path", f.path, "err", err)
+		fsw = nil
+	}
+
+	go func() {
+		var last []config.BackendConfig
+		reload := func() {
+			backends, err := f.Read()
+			if err != nil {
+				discoveryErrors.WithLabelValues(f.route).Inc()
+				f.log.Warnw("file discovery failed, keeping previous backends", "route", f.route, "path", f.path, "err", err)
+				return
+			}
+			if !slices.Equal(backends, last) && !f.stopped() {
+				f.log.Infow("file discovery updated backends", "route", f.route, "path", f.path, "backends", len(backends))
+				discoveredBackends.WithLabelValues(f.route).Set(float64(len(backends)))
+				update(backends)
+				last = backends
+			}
+		}
+		reload()
+		if fsw == nil {
+			return
+		}
+		defer fsw.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-f.stop:
+				return
+			case _, ok := <-fsw.Events:
+				if !ok {
+					return
+				}
+				// Any change in the directory may be a rename onto the file
+				// or a ConfigMap symlink swap; reading is cheap
+				debounce = time.After(fileDebounce)
+			case err, ok := <-fsw.Errors:
+				if !ok {
+					return
+				}
+				f.log.Warnw("fsnotify error", "route", f.route, "path", f.path, "err", err)
+			case <-debounce:
+				debounce = nil
+				reload()
+			}
+		}
+	}()
+}
+
+// Stop ends watching. Safe to call more than once.
+func (f *File) Stop() {
+	if f == nil {
+		return
+	}
+	f.once.Do(func() { close(f.stop) })
+}
+
+// stopped reports whether Stop was called; select may still pick a pending
+// debounce after it.
+func (f *File) stopped() bool {
+	select {
+	case <-f.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Read parses the file and returns its backends sorted by URL. Weights
+// default to 1.
+func (f *File) Read() ([]config.BackendConfig, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	var backends []config.BackendConfig
+	// YAML is a superset of JSON, so either format parses
+	if err := yaml.Unmarshal(data, &backends); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", f.path, err)
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("%s: no backends", f.path)
+	}
+	for i, b := range backends {
+		if u, err := url.Parse(b.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("%s: backend %d: invalid url %q", f.path, i, b.URL)
+		}
+		if b.Weight < 0 {
+			return nil, fmt.Errorf("%s: backend %s: weight must not be negative", f.path, b.URL)
+		}
+		if b.Weight == 0 {
+			backends[i].Weight = 1
+		}
+	}
+	return sortBackends(backends), nil
+}
@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	// Write and rename, as deploy tools do
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFile_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.json")
+	writeFile(t, path, `[
+		{"url": "http://10.0.0.2:8080", "weight": 2, "zone": "eu-1b"},
+		{"url": "http://10.0.0.1:8080"}
+	]`)
+	f, err := NewFile(&config.FileDiscoveryConfig{Path: path}, "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	t.Cleanup(f.Stop)
+
+	updates := make(chan []config.BackendConfig, 10)
+	f.Start(func(bs []config.BackendConfig) { updates <- bs })
+	next := func() []config.BackendConfig {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(2 * time.Second):
+			t.Fatal("no update")
+			return nil
+		}
+	}
+
+	want := []config.BackendConfig{
+		{URL: "http://10.0.0.1:8080", Weight: 1},
+		{URL: "http://10.0.0.2:8080", Weight: 2, Zone: "eu-1b"},
+	}
+	if got := next(); !slices.Equal(got, want) {
+		t.Fatalf("backends = %+v, want %+v", got, want)
+	}
+
+	// A broken file keeps the last set; the next good one replaces it
+	writeFile(t, path, `[{"url": `)
+	time.Sleep(3 * fileDebounce)
+	select {
+	case u := <-updates:
+		t.Fatalf("unexpected update %v from a malformed file", u)
+	default:
+	}
+	writeFile(t, path, "- url: http://10.0.0.3:8080\n") // YAML works too
+	if got := urls(next()); !slices.Equal(got, []string{"http://10.0.0.3:8080"}) {
+		t.Fatalf("after rewrite = %v", got)
+	}
+}
+
+func TestFile_NoUpdatesAfterStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.json")
+	writeFile(t, path, `[{"url": "http://10.0.0.1:8080"}]`)
+	f, err := NewFile(&config.FileDiscoveryConfig{Path: path}, "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	updates := make(chan []config.BackendConfig, 10)
+	f.Start(func(bs []config.BackendConfig) { updates <- bs })
+	select {
+	case <-updates:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no first update")
+	}
+
+	// A change that is still being debounced when the provider stops
+	writeFile(t, path, `[{"url": "http://10.0.0.2:8080"}]`)
+	f.Stop()
+	time.Sleep(3 * fileDebounce)
+	select {
+	case u := <-updates:
+		t.Fatalf("update %v after Stop", u)
+	default:
+	}
+}
+
+func TestFile_Read(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"empty":        `[]`,
+		"no scheme":    `[{"url": "10.0.0.1:8080"}]`,
+		"negative":     `[{"url": "http://10.0.0.1:8080", "weight": -1}]`,
+		"not a list":   `{"url": "http://10.0.0.1:8080"}`,
+		"missing file": "",
+	} {
+		path := filepath.Join(dir, name)
+		if data != "" {
+			writeFile(t, path, data)
+		}
+		if _, err := (&File{path: path}).Read(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	for _, cfg := range []config.FileDiscoveryConfig{{}, {Path: "/nonexistent/dir/backends.json"}} {
+		if _, err := NewFile(&cfg, "/test", zap.NewNop().Sugar()); err == nil {
+			t.Errorf("NewFile(%+v): expected error", cfg)
+		}
+	}
+}
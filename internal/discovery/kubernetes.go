@@ -0,0 +1,381 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+// ---------------------------------------------------------------------------
+// Kubernetes EndpointSlice discovery
+//
+// Lists the EndpointSlices of a Service, then watches them, so pods are added
+// and removed as soon as the API server reports it. Only ready endpoints
+// become backends, labelled with their zone for locality-aware routing. When
+// every endpoint carries topology hints and some are meant for the gateway's
+// zone, only those are used, as kube-proxy does.
+// ---------------------------------------------------------------------------
+
+const (
+	serviceAccountDir  = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceNameLabel   = "kubernetes.io/service-name"
+	watchTimeoutSecs   = 300
+	maxKubernetesRetry = 30 * time.Second
+)
+
+// errGone means the watch's resource version has expired and the slices
+// must be listed again.
+var errGone = errors.New("resource version too old")
+
+// Kubernetes keeps a route's backends in sync with the EndpointSlices of a
+// Service. A nil *Kubernetes does nothing.
+type Kubernetes struct {
+	service   string
+	namespace string
+	port      string
+	scheme    string
+	zone      string // the gateway's zone, for topology hints
+	api       string
+	tokenFile string
+	client    *http.Client
+	route     string
+	log       *zap.SugaredLogger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewKubernetes validates cfg and prepares the API client; zone is the
+// gateway's own zone, if known. Watching starts with Start.
+func NewKubernetes(cfg *config.KubernetesDiscoveryConfig, zone, route string, log *zap.SugaredLogger) (*Kubernetes, error) {
+	if cfg.Service == "" {
+		return nil, errors.New("discovery.kubernetes.service is required")
+	}
+	k := &Kubernetes{
+		service:   cfg.Service,
+		namespace: cfg.Namespace,
+		port:      cfg.Port,
+		scheme:    cfg.Scheme,
+		zone:      zone,
+		api:       strings.TrimSuffix(cfg.APIServer, "/"),
+		tokenFile: cfg.TokenFile,
+		route:     route,
+		log:       log,
+	}
+	if k.scheme == "" {
+		k.scheme = "http"
+	}
+	if k.tokenFile == "" {
+		k.tokenFile = serviceAccountDir + "/token"
+	}
+	if k.namespace == "" {
+		k.namespace = "default"
+		if ns, err := os.ReadFile(serviceAccountDir + "/namespace"); err == nil {
+			k.namespace = strings.TrimSpace(string(ns))
+		}
+	}
+	if k.api == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("discovery.kubernetes.api_server: required outside a cluster")
+		}
+		k.api = "https://" + net.JoinHostPort(host, port)
+	}
+
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	caFile := cfg.CAFile
+	if caFile == "" {
+		caFile = serviceAccountDir + "/ca.crt"
+	}
+	if pem, err := os.ReadFile(caFile); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("discovery.kubernetes.ca_file %q: no certificates", caFile)
+		}
+		tlsCfg.RootCAs = pool
+	} else if cfg.CAFile != "" {
+		return nil, fmt.Errorf("discovery.kubernetes.ca_file: %w", err)
+	}
+	// No overall timeout: watches stream for minutes
+	k.client = &http.Client{Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		TLSClientConfig:       tlsCfg,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}}
+	k.ctx, k.cancel = context.WithCancel(context.Background())
+	return k, nil
+}
+
+// Start lists and watches in the background until Stop, calling update with
+// every backend set that differs from the previous one. An empty set is
+// passed on: it means the Service has no ready endpoints.
+func (k *Kubernetes) Start(update func([]config.BackendConfig)) {
+	if k == nil {
+		return
+	}
+	go func() {
+		var last []config.BackendConfig
+		emit := func(set map[string]endpointSlice) {
+			bs := k.backends(set)
+			if last != nil && slices.Equal(bs, last) || k.ctx.Err() != nil {
+				return
+			}
+			k.log.Infow("kubernetes discovery updated backends", "route", k.route, "service", k.namespace+"/"+k.service, "backends", len(bs))
+			discoveredBackends.WithLabelValues(k.route).Set(float64(len(bs)))
+			update(bs)
+			last = bs
+		}
+
+		backoff := time.Second
+		for {
+			err := k.run(emit, func() { backoff = time.Second })
+			if k.ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, errGone) {
+				discoveryErrors.WithLabelValues(k.route).Inc()
+				k.log.Warnw("kubernetes discovery failed, keeping previous backends",
+					"route", k.route, "service", k.namespace+"/"+k.service, "err", err, "retry_in", backoff)
+				select {
+				case <-k.ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(2*backoff, maxKubernetesRetry)
+			}
+		}
+	}()
+}
+
+// Stop ends the watch. Safe to call more than once.
+func (k *Kubernetes) Stop() {
+	if k == nil {
+		return
+	}
+	k.cancel()
+}
+
+// run lists the slices and then follows watches from the list's resource
+// version until one fails. listed is called after a successful list.
+func (k *Kubernetes) run(emit func(map[string]endpointSlice), listed func()) error {
+	var list struct {
+		Metadata objectMeta      `json:"metadata"`
+		Items    []endpointSlice `json:"items"`
+	}
+	if err := k.get(url.Values{}, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&list)
+	}); err != nil {
+		return err
+	}
+	listed()
+	set := make(map[string]endpointSlice, len(list.Items))
+	for _, s := range list.Items {
+		set[s.Metadata.Name] = s
+	}
+	emit(set)
+
+	rv := list.Metadata.ResourceVersion
+	for {
+		q := url.Values{
+			"watch":               {"1"},
+			"resourceVersion":     {rv},
+			"allowWatchBookmarks": {"true"},
+			"timeoutSeconds":      {strconv.Itoa(watchTimeoutSecs)},
+		}
+		err := k.get(q, func(body io.Reader) error {
+			dec := json.NewDecoder(body)
+			for {
+				var ev struct {
+					Type   string          `json:"type"`
+					Object json.RawMessage `json:"object"`
+				}
+				if err := dec.Decode(&ev); err != nil {
+					if errors.Is(err, io.EOF) {
+						return nil // server ended the watch; resume from rv
+					}
+					return err
+				}
+				if ev.Type == "ERROR" {
+					var status struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					}
+					_ = json.Unmarshal(ev.Object, &status)
+					if status.Code == http.StatusGone {
+						return errGone
+					}
+					return fmt.Errorf("watch error %d: %s", status.Code, status.Message)
+				}
+				var s endpointSlice
+				if err := json.Unmarshal(ev.Object, &s); err != nil {
+					return fmt.Errorf("decode %s event: %w", ev.Type, err)
+				}
+				rv = s.Metadata.ResourceVersion
+				switch ev.Type {
+				case "ADDED", "MODIFIED":
+					set[s.Metadata.Name] = s
+				case "DELETED":
+					delete(set, s.Metadata.Name)
+				default: // BOOKMARK only advances rv
+					continue
+				}
+				emit(set)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// get requests the Service's EndpointSlices with extra query parameters and
+// hands the body of a 200 response to read.
+func (k *Kubernetes) get(q url.Values, read func(io.Reader) error) error {
+	q.Set("labelSelector", serviceNameLabel+"="+k.service)
+	u := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s", k.api, url.PathEscape(k.namespace), q.Encode())
+	req, err := http.NewRequestWithContext(k.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	// Re-read every time: projected service account tokens rotate
+	if token, err := os.ReadFile(k.tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return errGone
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("list endpointslices: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return read(resp.Body)
+}
+
+// ---------------------------------------------------------------------------
+// EndpointSlice (discovery.k8s.io/v1), only the fields used here
+// ---------------------------------------------------------------------------
+
+type objectMeta struct {
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type endpointSlice struct {
+	Metadata    objectMeta `json:"metadata"`
+	AddressType string     `json:"addressType"`
+	Endpoints   []endpoint `json:"endpoints"`
+	Ports       []struct {
+		Name string `json:"name"`
+		Port *int   `json:"port"`
+	} `json:"ports"`
+}
+
+type endpoint struct {
+	Addresses  []string `json:"addresses"`
+	Conditions struct {
+		Ready *bool `json:"ready"` // unset means ready
+	} `json:"conditions"`
+	Zone  string `json:"zone"`
+	Hints *struct {
+		ForZones []struct {
+			Name string `json:"name"`
+		} `json:"forZones"`
+	} `json:"hints"`
+}
+
+func (e endpoint) hintedFor(zone string) bool {
+	for _, z := range e.Hints.ForZones {
+		if z.Name == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// slicePort returns the slice's port for the configured name or number,
+// or its first port if none is configured.
+func (k *Kubernetes) slicePort(s endpointSlice) (int, bool) {
+	for _, p := range s.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if k.port == "" || p.Name == k.port || strconv.Itoa(*p.Port) == k.port {
+			return *p.Port, true
+		}
+	}
+	return 0, false
+}
+
+// backends turns the ready endpoints in set into backends sorted by URL.
+func (k *Kubernetes) backends(set map[string]endpointSlice) []config.BackendConfig {
+	type candidate struct {
+		cfg    config.BackendConfig
+		ep     endpoint
+		hinted bool
+	}
+	var all []candidate
+	allHinted := true
+	for _, s := range set {
+		if s.AddressType == "FQDN" {
+			continue
+		}
+		port, ok := k.slicePort(s)
+		if !ok {
+			continue
+		}
+		for _, ep := range s.Endpoints {
+			if len(ep.Addresses) == 0 || (ep.Conditions.Ready != nil && !*ep.Conditions.Ready) {
+				continue
+			}
+			hinted := ep.Hints != nil && len(ep.Hints.ForZones) > 0
+			allHinted = allHinted && hinted
+			all = append(all, candidate{
+				cfg: config.BackendConfig{
+					URL:    k.scheme + "://" + net.JoinHostPort(ep.Addresses[0], strconv.Itoa(port)),
+					Weight: 1,
+					Zone:   ep.Zone,
+				},
+				ep:     ep,
+				hinted: hinted,
+			})
+		}
+	}
+
+	useHints := false
+	if k.zone != "" && allHinted {
+		for _, c := range all {
+			if c.ep.hintedFor(k.zone) {
+				useHints = true
+				break
+			}
+		}
+	}
+	out := make([]config.BackendConfig, 0, len(all))
+	for _, c := range all {
+		if !useHints || c.ep.hintedFor(k.zone) {
+			out = append(out, c.cfg)
+		}
+	}
+	return sortBackends(out)
+}
@@ -0,0 +1,276 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+// ---------------------------------------------------------------------------
+// Fake API server: serves a list of EndpointSlices, then streams the watch
+// events pushed by the test
+// ---------------------------------------------------------------------------
+
+type fakeAPIServer struct {
+	url    string
+	events chan any
+
+	mu      sync.Mutex
+	items   []any
+	lists   int
+	watchRV []string
+}
+
+func newFakeAPIServer(t *testing.T, items ...any) *fakeAPIServer {
+	t.Helper()
+	f := &fakeAPIServer{items: items, events: make(chan any, 10)}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	f.url = srv.URL
+	return f
+}
+
+func (f *fakeAPIServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/shop/endpointslices" ||
+		r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=orders" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer s3cret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	if r.URL.Query().Get("watch") != "1" {
+		f.lists++
+		items := f.items
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"metadata": map[string]string{"resourceVersion": "10"}, "items": items})
+		return
+	}
+	f.watchRV = append(f.watchRV, r.URL.Query().Get("resourceVersion"))
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-f.events:
+			if ev == nil {
+				return // end this watch
+			}
+			enc.Encode(ev)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func (f *fakeAPIServer) stats() (lists int, watchRV []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lists, slices.Clone(f.watchRV)
+}
+
+type testEndpoint struct {
+	ip    string
+	ready bool
+	zone  string
+	hints []string // nil for no hints
+}
+
+func slice(name, rv string, eps ...testEndpoint) map[string]any {
+	var endpoints []any
+	for _, e := range eps {
+		ep := map[string]any{
+			"addresses":  []string{e.ip},
+			"conditions": map[string]bool{"ready": e.ready},
+			"zone":       e.zone,
+		}
+		if e.hints != nil {
+			var zones []any
+			for _, z := range e.hints {
+				zones = append(zones, map[string]string{"name": z})
+			}
+			ep["hints"] = map[string]any{"forZones": zones}
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return map[string]any{
+		"metadata":    map[string]string{"name": name, "resourceVersion": rv},
+		"addressType": "IPv4",
+		"endpoints":   endpoints,
+		"ports": []any{
+			map[string]any{"name": "metrics", "port": 9100},
+			map[string]any{"name": "http", "port": 8080},
+		},
+	}
+}
+
+func event(typ string, obj any) map[string]any {
+	return map[string]any{"type": typ, "object": obj}
+}
+
+func newTestKubernetes(t *testing.T, api string, cfg config.KubernetesDiscoveryConfig, zone string) *Kubernetes {
+	t.Helper()
+	token := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(token, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Service, cfg.Namespace, cfg.APIServer, cfg.TokenFile = "orders", "shop", api, token
+	k, err := NewKubernetes(&cfg, zone, "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewKubernetes: %v", err)
+	}
+	t.Cleanup(k.Stop)
+	return k
+}
+
+// ---------------------------------------------------------------------------
+
+func TestKubernetes_ListAndWatch(t *testing.T) {
+	api := newFakeAPIServer(t, slice("orders-a", "5",
+		testEndpoint{ip: "10.0.0.1", ready: true, zone: "eu-1a"},
+		testEndpoint{ip: "10.0.0.2", ready: false, zone: "eu-1b"},
+	))
+	k := newTestKubernetes(t, api.url, config.KubernetesDiscoveryConfig{Port: "http"}, "")
+
+	updates := make(chan []config.BackendConfig, 10)
+	k.Start(func(bs []config.BackendConfig) { updates <- bs })
+	next := func() []config.BackendConfig {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(2 * time.Second):
+			t.Fatal("no update")
+			return nil
+		}
+	}
+
+	want := []config.BackendConfig{{URL: "http://10.0.0.1:8080", Weight: 1, Zone: "eu-1a"}}
+	if got := next(); !slices.Equal(got, want) {
+		t.Fatalf("listed backends = %+v, want only the ready endpoint %+v", got, want)
+	}
+
+	// The second pod becomes ready, and another slice appears
+	api.events <- event("MODIFIED", slice("orders-a", "11",
+		testEndpoint{ip: "10.0.0.1", ready: true, zone: "eu-1a"},
+		testEndpoint{ip: "10.0.0.2", ready: true, zone: "eu-1b"},
+	))
+	if got := urls(next()); !slices.Equal(got, []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}) {
+		t.Fatalf("after MODIFIED = %v", got)
+	}
+	api.events <- event("ADDED", slice("orders-b", "12", testEndpoint{ip: "10.0.1.1", ready: true}))
+	if got := urls(next()); len(got) != 3 {
+		t.Fatalf("after ADDED = %v", got)
+	}
+	api.events <- event("DELETED", slice("orders-a", "13"))
+	if got := urls(next()); !slices.Equal(got, []string{"http://10.0.1.1:8080"}) {
+		t.Fatalf("after DELETED = %v", got)
+	}
+
+	// A bookmark advances the resource version without an update; the
+	// next watch resumes from it
+	api.events <- event("BOOKMARK", map[string]any{"metadata": map[string]string{"resourceVersion": "20"}})
+	api.events <- nil
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case u := <-updates:
+		t.Fatalf("unexpected update %v", u)
+	default:
+	}
+	lists, rvs := api.stats()
+	if lists != 1 || !slices.Equal(rvs, []string{"10", "20"}) {
+		t.Fatalf("lists = %d, watch resource versions = %v; want 1 list and watches from 10 then 20", lists, rvs)
+	}
+
+	// An expired resource version means listing again
+	api.events <- event("ERROR", map[string]any{"kind": "Status", "code": 410, "message": "too old"})
+	deadline := time.Now().Add(2 * time.Second)
+	for lists < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		lists, _ = api.stats()
+	}
+	if lists != 2 {
+		t.Fatalf("lists = %d after 410, want a relist", lists)
+	}
+	// The relist returns the original slice again
+	if got := urls(next()); !slices.Equal(got, []string{"http://10.0.0.1:8080"}) {
+		t.Fatalf("after relist = %v", got)
+	}
+}
+
+func TestKubernetes_Backends(t *testing.T) {
+	set := func(eps ...testEndpoint) map[string]endpointSlice {
+		b, _ := json.Marshal(slice("s", "1", eps...))
+		var s endpointSlice
+		if err := json.Unmarshal(b, &s); err != nil {
+			t.Fatal(err)
+		}
+		return map[string]endpointSlice{"s": s}
+	}
+	hinted := set(
+		testEndpoint{ip: "10.0.0.1", ready: true, zone: "a", hints: []string{"a"}},
+		testEndpoint{ip: "10.0.0.2", ready: true, zone: "b", hints: []string{"b", "c"}},
+	)
+	tests := []struct {
+		name, port, zone string
+		set              map[string]endpointSlice
+		want             []string
+	}{
+		{"first port by default", "", "", hinted, []string{"http://10.0.0.1:9100", "http://10.0.0.2:9100"}},
+		{"port by number", "8080", "", hinted, []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}},
+		{"unknown port", "grpc", "", hinted, nil},
+		{"hints for our zone", "http", "c", hinted, []string{"http://10.0.0.2:8080"}},
+		{"no hints for our zone", "http", "d", hinted, []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}},
+		{"hints ignored unless every endpoint has them", "http", "a", set(
+			testEndpoint{ip: "10.0.0.1", ready: true, hints: []string{"a"}},
+			testEndpoint{ip: "10.0.0.2", ready: true},
+		), []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &Kubernetes{port: tt.port, zone: tt.zone, scheme: "http"}
+			if got := urls(k.backends(tt.set)); !slices.Equal(got, tt.want) {
+				t.Fatalf("backends = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubernetes_Errors(t *testing.T) {
+	if _, err := NewKubernetes(&config.KubernetesDiscoveryConfig{}, "", "/test", zap.NewNop().Sugar()); err == nil {
+		t.Error("expected an error without a service")
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := NewKubernetes(&config.KubernetesDiscoveryConfig{Service: "orders"}, "", "/test", zap.NewNop().Sugar()); err == nil {
+		t.Error("expected an error outside a cluster without api_server")
+	}
+	if _, err := NewKubernetes(&config.KubernetesDiscoveryConfig{Service: "orders", APIServer: "https://k8s", CAFile: "/nonexistent/ca.crt"}, "", "/test", zap.NewNop().Sugar()); err == nil {
+		t.Error("expected an error for a missing ca_file")
+	}
+
+	// The API server rejects requests without the token
+	api := newFakeAPIServer(t)
+	cfg := config.KubernetesDiscoveryConfig{Service: "orders", Namespace: "shop", APIServer: api.url, TokenFile: "/nonexistent/token"}
+	k, err := NewKubernetes(&cfg, "", "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Stop()
+	if err := k.run(func(map[string]endpointSlice) {}, func() {}); err == nil {
+		t.Fatal("expected an error without a token")
+	}
+}
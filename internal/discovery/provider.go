@@ -0,0 +1,58 @@
+// Package discovery keeps a route's backend list in sync with an external
+// source of truth, such as DNS, Kubernetes, Consul or a file, instead of the
+// static list in the config.
+package discovery
+
+import (
+	"errors"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+// Provider watches a source of backends. Start runs in the background until
+// Stop and calls update with the stream of backend sets, sorted by URL, each
+// time the set changes. update is never called concurrently, nor once Stop
+// has returned, except by a call that had already begun.
+type Provider interface {
+	Start(update func([]config.BackendConfig))
+	Stop()
+}
+
+var (
+	_ Provider = (*DNS)(nil)
+	_ Provider = (*Kubernetes)(nil)
+	_ Provider = (*Consul)(nil)
+	_ Provider = (*File)(nil)
+)
+
+// New returns the provider selected in cfg for route. zone is the gateway's
+// own zone, used by providers that support topology hints.
+func New(cfg *config.DiscoveryConfig, zone, route string, log *zap.SugaredLogger) (Provider, error) {
+	n := 0
+	for _, set := range []bool{cfg.DNS != nil, cfg.Kubernetes != nil, cfg.Consul != nil, cfg.File != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("discovery: set exactly one of dns, kubernetes, consul and file")
+	}
+
+	var p Provider
+	var err error
+	switch {
+	case cfg.DNS != nil:
+		p, err = NewDNS(cfg.DNS, route, log)
+	case cfg.Kubernetes != nil:
+		p, err = NewKubernetes(cfg.Kubernetes, zone, route, log)
+	case cfg.Consul != nil:
+		p, err = NewConsul(cfg.Consul, route, log)
+	default:
+		p, err = NewFile(cfg.File, route, log)
+	}
+	if err != nil {
+		return nil, err // not a typed nil inside p
+	}
+	return p, nil
+}
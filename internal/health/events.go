@@ -0,0 +1,183 @@
+package health
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ---------------------------------------------------------------------------
+// State-change events
+// ---------------------------------------------------------------------------
+
+// Event types.
+const (
+	EventHealthy   = "healthy"   // active checks passed healthy_threshold times
+	EventUnhealthy = "unhealthy" // active checks failed unhealthy_threshold times
+	EventEjected   = "ejected"   // outlier detection removed the backend
+	EventReturned  = "returned"  // an ejection expired
+	EventDrained   = "drained"   // a draining backend finished its last request
+)
+
+// Event is a change in a backend's health state.
+type Event struct {
+	Time    time.Time  `json:"time"`
+	Route   string     `json:"route"`
+	Backend string     `json:"backend"`
+	Type    string     `json:"type"`
+	Reason  string     `json:"reason,omitempty"`
+	Until   *time.Time `json:"until,omitempty"` // end of an ejection
+}
+
+// Subscriber receives events. Notify is called synchronously from the
+// checker or the proxy path and must not block.
+type Subscriber interface {
+	Notify(e Event)
+}
+
+// Publisher fans events out to subscribers. A nil *Publisher drops events.
+type Publisher struct {
+	subs []Subscriber
+}
+
+// NewPublisher returns a Publisher delivering to subs.
+func NewPublisher(subs ...Subscriber) *Publisher {
+	return &Publisher{subs: subs}
+}
+
+// Publish delivers e to every subscriber.
+func (p *Publisher) Publish(e Event) {
+	if p == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, s := range p.subs {
+		s.Notify(e)
+	}
+}
+
+// Close releases subscribers that hold resources, such as webhooks.
+func (p *Publisher) Close() {
+	if p == nil {
+		return
+	}
+	for _, s := range p.subs {
+		if c, ok := s.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
+// LogSubscriber writes events to log: losses of health at warn level,
+// recoveries at info.
+func LogSubscriber(log *zap.SugaredLogger) Subscriber {
+	return logSubscriber{log}
+}
+
+type logSubscriber struct{ log *zap.SugaredLogger }
+
+func (l logSubscriber) Notify(e Event) {
+	kv := []any{"route", e.Route, "url", e.Backend}
+	if e.Reason != "" {
+		kv = append(kv, "reason", e.Reason)
+	}
+	if e.Until != nil {
+		kv = append(kv, "duration", e.Until.Sub(e.Time).Round(time.Millisecond))
+	}
+	switch e.Type {
+	case EventUnhealthy:
+		l.log.Warnw("backend unhealthy", kv...)
+	case EventEjected:
+		l.log.Warnw("backend ejected", kv...)
+	case EventHealthy:
+		l.log.Infow("backend recovered", kv...)
+	case EventReturned:
+		l.log.Infow("backend returned from ejection", kv...)
+	case EventDrained:
+		l.log.Infow("backend drained", kv...)
+	}
+}
+
+// Webhook POSTs each event as JSON to a URL from a background goroutine.
+// Events are dropped, with a warning, if the queue backs up.
+type Webhook struct {
+	url    string
+	client *http.Client
+	queue  chan Event
+	log    *zap.SugaredLogger
+	done   chan struct{}
+	once   sync.Once
+}
+
+const webhookQueueSize = 256
+
+// NewWebhook starts a webhook subscriber for url.
+func NewWebhook(url string, log *zap.SugaredLogger) *Webhook {
+	w := &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan Event, webhookQueueSize),
+		log:    log,
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Notify queues e for delivery. Events after Close are dropped.
+func (w *Webhook) Notify(e Event) {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	select {
+	case w.queue <- e:
+	default:
+		w.log.Warnw("health webhook queue full, dropping event", "url", w.url, "backend", e.Backend, "type", e.Type)
+	}
+}
+
+// Close stops delivery; queued events are discarded.
+func (w *Webhook) Close() { w.once.Do(func() { close(w.done) }) }
+
+func (w *Webhook) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case e := <-w.queue:
+			if err := w.post(e); err != nil {
+				w.log.Warnw("health webhook failed", "url", w.url, "err", err)
+			}
+		}
+	}
+}
+
+func (w *Webhook) post(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
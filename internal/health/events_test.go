@@ -0,0 +1,60 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWebhook_PostsEvents(t *testing.T) {
+	got := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected webhook request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		got <- e
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, zap.NewNop().Sugar())
+	p := NewPublisher(LogSubscriber(zap.NewNop().Sugar()), wh)
+	defer p.Close()
+
+	until := time.Now().Add(30 * time.Second).Truncate(time.Millisecond)
+	p.Publish(Event{Route: "/api", Backend: "http://b1", Type: EventEjected, Reason: ReasonConsecutive5xx, Until: &until})
+
+	select {
+	case e := <-got:
+		if e.Route != "/api" || e.Backend != "http://b1" || e.Type != EventEjected ||
+			e.Reason != ReasonConsecutive5xx || e.Until == nil || !e.Until.Equal(until) || e.Time.IsZero() {
+			t.Fatalf("unexpected event delivered: %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestPublisher_NilIsNoop(t *testing.T) {
+	var p *Publisher
+	p.Publish(Event{Type: EventHealthy})
+	p.Close()
+}
+
+func TestWebhook_DropsEventsAfterClose(t *testing.T) {
+	wh := NewWebhook("http://127.0.0.1:1/hook", zap.NewNop().Sugar())
+	wh.Close()
+	for i := 0; i < webhookQueueSize+1; i++ {
+		wh.Notify(Event{Backend: "http://b", Type: EventDrained})
+	}
+	if n := len(wh.queue); n != 0 {
+		t.Fatalf("expected events after Close to be dropped, %d queued", n)
+	}
+}
@@ -0,0 +1,186 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
+	"golang.org/x/net/http2"
+)
+
+// ---------------------------------------------------------------------------
+// gRPC health checking protocol (grpc.health.v1.Health/Check)
+//
+// Pulling in grpc-go for one unary call is not worth it, so the request is
+// sent with the x/net HTTP/2 transport, over TLS or cleartext (h2c). A backend
+// that answers with anything but a SERVING message and grpc-status 0
+// (including a trailers-only error) is unhealthy.
+// ---------------------------------------------------------------------------
+
+const (
+	grpcHealthPath      = "/grpc.health.v1.Health/Check"
+	grpcMaxResponseSize = 1 << 10
+)
+
+// HealthCheckResponse.ServingStatus values.
+var servingStatus = map[uint64]string{0: "UNKNOWN", 1: "SERVING", 2: "NOT_SERVING", 3: "SERVICE_UNKNOWN"}
+
+type grpcProbe struct {
+	port      int
+	service   string
+	tls       *tls.Config // nil: cleartext (h2c) unless the URL is https
+	authority string
+}
+
+func (p *grpcProbe) Check(ctx context.Context, b *loadbalancer.Backend) error {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return err
+	}
+	addr, err := probeAddr(b.URL, p.port)
+	if err != nil {
+		return err
+	}
+
+	// A fresh connection per check, like the other probes
+	t := &http2.Transport{}
+	defer t.CloseIdleConnections()
+	scheme := "https"
+	switch {
+	case p.tls != nil:
+		t.TLSClientConfig = p.tls.Clone()
+	case u.Scheme != "https":
+		scheme = "http"
+		t.AllowHTTP = true
+		t.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+"://"+addr+grpcHealthPath,
+		bytes.NewReader(grpcHealthRequest(p.service)))
+	if err != nil {
+		return err
+	}
+	req.Host = p.authority
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %d", resp.StatusCode)
+	}
+
+	// Trailers are only filled in once the body has been read to the end
+	data, err := io.ReadAll(io.LimitReader(resp.Body, grpcMaxResponseSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > grpcMaxResponseSize {
+		return errors.New("health response too large")
+	}
+	if err := grpcStatus(resp); err != nil {
+		return err
+	}
+	msg, err := grpcMessage(data)
+	if err != nil {
+		return err
+	}
+	status, err := parseServingStatus(msg)
+	if err != nil {
+		return err
+	}
+	if status != 1 {
+		name := servingStatus[status]
+		if name == "" {
+			name = fmt.Sprint(status)
+		}
+		return fmt.Errorf("grpc health status %s", name)
+	}
+	return nil
+}
+
+// grpcHealthRequest returns a length-prefixed HealthCheckRequest{service = 1}.
+func grpcHealthRequest(service string) []byte {
+	var req []byte
+	if service != "" {
+		req = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(service)))...)
+		req = append(req, service...)
+	}
+	body := make([]byte, 5, 5+len(req))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(req)))
+	return append(body, req...)
+}
+
+// grpcStatus returns an error for a non-zero grpc-status, which comes in the
+// trailers or, for a trailers-only response, in the headers.
+func grpcStatus(resp *http.Response) error {
+	h := resp.Trailer
+	if h.Get("Grpc-Status") == "" {
+		h = resp.Header
+	}
+	status, msg := h.Get("Grpc-Status"), h.Get("Grpc-Message")
+	switch {
+	case status == "" || status == "0":
+		return nil
+	case msg != "":
+		return fmt.Errorf("grpc status %s: %s", status, msg)
+	default:
+		return fmt.Errorf("grpc status %s", status)
+	}
+}
+
+// grpcMessage returns the first length-prefixed message of a response body.
+func grpcMessage(data []byte) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, errors.New("no health response message (grpc error status)")
+	}
+	n := binary.BigEndian.Uint32(data[1:5])
+	if data[0] != 0 || int(n) > len(data)-5 {
+		return nil, errors.New("malformed grpc message")
+	}
+	return data[5 : 5+n], nil
+}
+
+// parseServingStatus extracts field 1 (status) of a HealthCheckResponse.
+func parseServingStatus(msg []byte) (uint64, error) {
+	var status uint64
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed health response")
+		}
+		msg = msg[n:]
+		switch tag & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed health response")
+			}
+			if tag>>3 == 1 {
+				status = v
+			}
+			msg = msg[n:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return 0, errors.New("malformed health response")
+			}
+			msg = msg[n+int(l):]
+		default:
+			return 0, errors.New("malformed health response")
+		}
+	}
+	return status, nil
+}
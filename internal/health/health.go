@@ -1,61 +1,251 @@
 // Package health provides active health-checking of upstream backends.
-// It periodically probes each backend's health endpoint and updates the
-// backend's alive flag so the load balancer skips unhealthy nodes.
+// It periodically probes each backend (HTTP, TCP connect, TLS handshake or
+// gRPC health protocol) and updates the backend's alive flag so the load
+// balancer skips unhealthy nodes. Recent probe results are kept per backend,
+// and state changes are published as Events.
 package health
 
 import (
 	"context"
-	"net/http"
+	"fmt"
+	"math/rand/v2"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sneha4175/gateway-pro/internal/config"
 	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
-	"go.uber.org/zap"
 )
 
 const (
 	defaultCheckInterval = 10 * time.Second
 	defaultTimeout       = 3 * time.Second
 	defaultHealthPath    = "/health"
+	defaultHistorySize   = 20
+
+	// Bytes of a response body inspected for expected_body / expected_body_regex.
+	maxBodyBytes = 64 << 10
+)
+
+var (
+	backendHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Name:      "backend_healthy",
+		Help:      "1 if the backend passes active health checks, 0 if not.",
+	}, []string{"route", "backend"})
+
+	checkDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gateway",
+		Name:      "health_check_duration_seconds",
+		Help:      "Latency of active health check probes.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"route", "backend", "result"})
+)
+
+// Probe results in history and the check duration metric.
+const (
+	ResultPass = "pass"
+	ResultFail = "fail"
 )
 
+// ProbeResult is one health check of one backend.
+type ProbeResult struct {
+	Time      time.Time `json:"time"`
+	LatencyMs float64   `json:"latency_ms"`
+	Result    string    `json:"result"` // pass | fail
+	Alive     bool      `json:"alive"`  // backend state after applying thresholds
+	Error     string    `json:"error,omitempty"`
+}
+
 // Checker continuously polls backends and flips their alive flag.
 type Checker struct {
-	mu       sync.Mutex
-	backends []*loadbalancer.Backend
-	client   *http.Client
-	interval time.Duration
-	path     string
-	log      *zap.SugaredLogger
-	cancel   context.CancelFunc
+	mu        sync.Mutex
+	backends  []*loadbalancer.Backend
+	removed   map[*loadbalancer.Backend]bool // dropped by Update during this round
+	streaks   map[*loadbalancer.Backend]int  // >0 consecutive passes, <0 consecutive failures
+	history   map[*loadbalancer.Backend]*ring
+	histSize  int
+	route     string
+	events    *Publisher
+	probe     Probe
+	checkType string
+	interval  time.Duration
+	timeout   time.Duration
+	jitter    time.Duration
+	healthy   int
+	unhealthy int
+	cancel    context.CancelFunc
 }
 
-// New creates and immediately starts a Checker.
-func New(backends []*loadbalancer.Backend, log *zap.SugaredLogger) *Checker {
-	ctx, cancel := context.WithCancel(context.Background())
+// ring holds the most recent probe results of one backend.
+type ring struct {
+	buf  []ProbeResult
+	next int
+	full bool
+}
+
+func (r *ring) add(res ProbeResult) {
+	r.buf[r.next] = res
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// slice returns the results oldest first.
+func (r *ring) slice() []ProbeResult {
+	if !r.full {
+		return append([]ProbeResult(nil), r.buf[:r.next]...)
+	}
+	return append(append([]ProbeResult(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
+
+// New creates and immediately starts a Checker for the backends of route.
+// State changes are published to events, which may be nil. A nil cfg uses
+// the defaults.
+func New(cfg *config.HealthCheckConfig, route string, backends []*loadbalancer.Backend, events *Publisher) (*Checker, error) {
+	if cfg == nil {
+		cfg = &config.HealthCheckConfig{}
+	}
+	probe, err := newProbe(cfg)
+	if err != nil {
+		return nil, err
+	}
 	c := &Checker{
-		backends: backends,
-		client: &http.Client{
-			Timeout: defaultTimeout,
-			// Don't follow redirects on health checks
-			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		},
-		interval: defaultCheckInterval,
-		path:     defaultHealthPath,
-		log:      log,
-		cancel:   cancel,
+		backends:  backends,
+		streaks:   make(map[*loadbalancer.Backend]int),
+		history:   make(map[*loadbalancer.Backend]*ring),
+		histSize:  orDefault(cfg.HistorySize, defaultHistorySize),
+		route:     route,
+		events:    events,
+		probe:     probe,
+		checkType: cfg.Type,
+		healthy:   max(cfg.HealthyThreshold, 1),
+		unhealthy: max(cfg.UnhealthyThreshold, 1),
+	}
+
+	if c.checkType == "" {
+		c.checkType = TypeHTTP
+	}
+
+	if c.interval, err = config.ParseDuration("health_check.interval", cfg.Interval, defaultCheckInterval); err != nil {
+		return nil, err
+	}
+	if c.timeout, err = config.ParseDuration("health_check.timeout", cfg.Timeout, defaultTimeout); err != nil {
+		return nil, err
 	}
+	c.jitter = c.interval / 10
+	if cfg.Jitter != "" {
+		if c.jitter, err = time.ParseDuration(cfg.Jitter); err != nil || c.jitter < 0 {
+			return nil, fmt.Errorf("health_check.jitter %q: must be a non-negative duration", cfg.Jitter)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
 	go c.run(ctx)
-	return c
+	return c, nil
 }
 
-// Update swaps in a new backend list without restarting the loop.
+// Update swaps in a new backend list without restarting the loop. The
+// metrics of backends no longer in the list are removed.
 func (c *Checker) Update(backends []*loadbalancer.Backend) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	keep := make(map[*loadbalancer.Backend]bool, len(backends))
+	urls := make(map[string]bool, len(backends))
+	for _, b := range backends {
+		keep[b] = true
+		urls[b.URL] = true
+	}
+	for _, b := range c.backends {
+		if keep[b] {
+			continue
+		}
+		if c.removed == nil {
+			c.removed = make(map[*loadbalancer.Backend]bool)
+		}
+		c.removed[b] = true
+		if !urls[b.URL] {
+			Forget(c.route, b.URL)
+		}
+	}
 	c.backends = backends
+	for b := range c.streaks {
+		if !keep[b] {
+			delete(c.streaks, b)
+		}
+	}
+	for b := range c.history {
+		if !keep[b] {
+			delete(c.history, b)
+		}
+	}
+}
+
+// Inherit takes over old's probe history and streaks for the backends both
+// checkers cover, matched by URL, so that replacing a route's checker with
+// one of the same settings on reload does not wipe them.
+func (c *Checker) Inherit(old *Checker) {
+	if old == c {
+		return
+	}
+	old.mu.Lock()
+	history := make(map[string][]ProbeResult, len(old.history))
+	for b, r := range old.history {
+		history[b.URL] = r.slice()
+	}
+	streaks := make(map[string]int, len(old.streaks))
+	for b, n := range old.streaks {
+		streaks[b.URL] = n
+	}
+	old.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range c.backends {
+		if _, ok := c.streaks[b]; !ok {
+			if n, ok := streaks[b.URL]; ok {
+				c.streaks[b] = n
+			}
+		}
+		prev := history[b.URL]
+		if len(prev) == 0 || c.histSize == 0 {
+			continue
+		}
+		// Older results first, then any this checker already has
+		r := &ring{buf: make([]ProbeResult, c.histSize)}
+		for _, res := range prev {
+			r.add(res)
+		}
+		if own := c.history[b]; own != nil {
+			for _, res := range own.slice() {
+				r.add(res)
+			}
+		}
+		c.history[b] = r
+	}
+}
+
+// Forget removes the health check and outlier detection metrics of a
+// backend that route no longer has.
+func Forget(route, backend string) {
+	labels := prometheus.Labels{"route": route, "backend": backend}
+	backendHealthy.Delete(labels)
+	checkDuration.DeletePartialMatch(labels)
+	ejectedGauge.Delete(labels)
+	ejectionsTotal.DeletePartialMatch(labels)
+}
+
+// History returns the retained probe results for b, oldest first.
+func (c *Checker) History(b *loadbalancer.Backend) []ProbeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r := c.history[b]; r != nil {
+		return r.slice()
+	}
+	return nil
 }
 
 // Stop cancels the background goroutine.
@@ -80,15 +270,31 @@ func (c *Checker) run(ctx context.Context) {
 
 func (c *Checker) checkAll(ctx context.Context) {
 	c.mu.Lock()
+	c.removed = nil // the previous round's probes have all finished
 	bs := make([]*loadbalancer.Backend, len(c.backends))
 	copy(bs, c.backends)
 	c.mu.Unlock()
 
 	var wg sync.WaitGroup
 	for _, b := range bs {
+		if b.AdminState() == loadbalancer.StateMaintenance {
+			// Not checked while an operator works on it, and its streak
+			// starts over when it comes back
+			c.mu.Lock()
+			delete(c.streaks, b)
+			c.mu.Unlock()
+			continue
+		}
 		wg.Add(1)
 		go func(backend *loadbalancer.Backend) {
 			defer wg.Done()
+			if c.jitter > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(rand.N(c.jitter)):
+				}
+			}
 			c.checkOne(ctx, backend)
 		}(b)
 	}
@@ -96,30 +302,79 @@ func (c *Checker) checkAll(ctx context.Context) {
 }
 
 func (c *Checker) checkOne(ctx context.Context, b *loadbalancer.Backend) {
-	url := b.URL + c.path
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		c.setAlive(b, false)
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.probe.Check(checkCtx, b)
+	latency := time.Since(start)
+	if ctx.Err() != nil {
+		return // shutting down; not the backend's fault
+	}
+	c.record(b, err, start, latency)
+}
+
+// record applies the healthy/unhealthy thresholds to one check result and
+// appends it to the backend's history.
+func (c *Checker) record(b *loadbalancer.Backend, err error, at time.Time, latency time.Duration) {
+	c.mu.Lock()
+	if c.removed[b] {
+		// Removed while the probe ran; don't bring its metrics back
+		c.mu.Unlock()
 		return
 	}
+	streak := c.streaks[b]
+	switch {
+	case err == nil && streak < 0, err != nil && streak > 0:
+		streak = 0
+	}
+	if err == nil {
+		streak++
+	} else {
+		streak--
+	}
+	c.streaks[b] = streak
+
+	// Decide the transition under the lock so concurrent rounds can't
+	// publish the same change twice.
+	alive := b.IsAlive()
+	var event *Event
+	switch {
+	case err == nil && streak >= c.healthy && !alive:
+		alive = true
+		event = &Event{Type: EventHealthy, Reason: c.checkType + " check passed"}
+	case err != nil && -streak >= c.unhealthy && alive:
+		alive = false
+		event = &Event{Type: EventUnhealthy, Reason: c.checkType + " check: " + err.Error()}
+	}
+	if event != nil {
+		b.SetAlive(alive)
+	}
 
-	resp, err := c.client.Do(req)
+	res := ProbeResult{Time: at, LatencyMs: float64(latency.Microseconds()) / 1000, Result: ResultPass, Alive: alive}
 	if err != nil {
-		if b.IsAlive() {
-			c.log.Warnw("backend unhealthy", "url", b.URL, "err", err)
+		res.Result, res.Error = ResultFail, err.Error()
+	}
+	if c.histSize > 0 {
+		r := c.history[b]
+		if r == nil {
+			r = &ring{buf: make([]ProbeResult, c.histSize)}
+			c.history[b] = r
 		}
-		c.setAlive(b, false)
-		return
+		r.add(res)
 	}
-	resp.Body.Close()
+	c.mu.Unlock()
 
-	alive := resp.StatusCode < 500
-	if !b.IsAlive() && alive {
-		c.log.Infow("backend recovered", "url", b.URL, "status", resp.StatusCode)
+	checkDuration.WithLabelValues(c.route, b.URL, res.Result).Observe(latency.Seconds())
+	backendHealthy.WithLabelValues(c.route, b.URL).Set(boolGauge(alive))
+	if event != nil {
+		event.Route, event.Backend = c.route, b.URL
+		c.events.Publish(*event)
 	}
-	c.setAlive(b, alive)
 }
 
-func (c *Checker) setAlive(b *loadbalancer.Backend, alive bool) {
-	b.SetAlive(alive)
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,297 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
+)
+
+// newTestChecker returns a checker whose loop effectively never fires, so
+// tests drive it with checkOne.
+func newTestChecker(t *testing.T, url string, cfg config.HealthCheckConfig) (*Checker, *loadbalancer.Backend) {
+	t.Helper()
+	b := loadbalancer.New("round_robin", []config.BackendConfig{{URL: url, Weight: 1}}).Backends()[0]
+	if cfg.Interval == "" {
+		cfg.Interval = "1h"
+	}
+	cfg.Jitter = "0s"
+	c, err := New(&cfg, "/test", nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(c.Stop)
+	return c, b
+}
+
+func TestChecker_RequestShape(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer srv.Close()
+
+	c, b := newTestChecker(t, srv.URL, config.HealthCheckConfig{
+		Path: "/ready", Method: "head",
+		Headers: map[string]string{"Host": "svc.internal", "X-Probe": "gateway"},
+	})
+	c.checkOne(context.Background(), b)
+
+	if got == nil || got.Method != http.MethodHead || got.URL.Path != "/ready" ||
+		got.Host != "svc.internal" || got.Header.Get("X-Probe") != "gateway" {
+		t.Fatalf("unexpected probe request: %+v", got)
+	}
+}
+
+func TestChecker_ExpectedStatusAndBody(t *testing.T) {
+	status, body := http.StatusOK, `{"status":"degraded"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	c, b := newTestChecker(t, srv.URL, config.HealthCheckConfig{
+		ExpectedStatuses:  []string{"200-204"},
+		ExpectedBody:      "status",
+		ExpectedBodyRegex: `"status":\s*"(ok|up)"`,
+	})
+	ctx := context.Background()
+
+	c.checkOne(ctx, b)
+	if b.IsAlive() {
+		t.Fatal("expected body regex mismatch to fail the check")
+	}
+	body = `{"status": "ok"}`
+	c.checkOne(ctx, b)
+	if !b.IsAlive() {
+		t.Fatal("expected matching body to pass")
+	}
+	status = http.StatusNotFound // below 500 but not expected
+	c.checkOne(ctx, b)
+	if b.IsAlive() {
+		t.Fatal("expected 404 outside expected_statuses to fail")
+	}
+}
+
+func TestChecker_Thresholds(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	c, b := newTestChecker(t, srv.URL, config.HealthCheckConfig{HealthyThreshold: 2, UnhealthyThreshold: 3})
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		c.checkOne(ctx, b)
+		if want := i < 3; b.IsAlive() != want {
+			t.Fatalf("after %d failures: expected alive=%v", i, want)
+		}
+	}
+	healthy.Store(true)
+	c.checkOne(ctx, b)
+	if b.IsAlive() {
+		t.Fatal("one pass must not revive with healthy_threshold 2")
+	}
+	c.checkOne(ctx, b)
+	if !b.IsAlive() {
+		t.Fatal("expected revival after 2 consecutive passes")
+	}
+}
+
+func TestChecker_JitteredLoop(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { probes.Add(1) }))
+	defer srv.Close()
+
+	bs := loadbalancer.New("round_robin", []config.BackendConfig{{URL: srv.URL, Weight: 1}}).Backends()
+	c, err := New(&config.HealthCheckConfig{Interval: "20ms", Jitter: "5ms"}, "/test", bs, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for probes.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if probes.Load() < 3 {
+		t.Fatalf("expected repeated probes, got %d", probes.Load())
+	}
+}
+
+func TestChecker_BadConfig(t *testing.T) {
+	for _, cfg := range []config.HealthCheckConfig{
+		{Interval: "often"},
+		{Timeout: "-1s"},
+		{Jitter: "-1s"},
+		{ExpectedStatuses: []string{"299-200"}},
+		{ExpectedStatuses: []string{"2xx"}},
+		{ExpectedBodyRegex: "("},
+	} {
+		if c, err := New(&cfg, "/test", nil, nil); err == nil {
+			c.Stop()
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+// recorder is a Subscriber that keeps every event.
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Notify(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, e := range r.events {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func TestChecker_HistoryAndEvents(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	rec := &recorder{}
+	b := loadbalancer.New("round_robin", []config.BackendConfig{{URL: srv.URL, Weight: 1}}).Backends()[0]
+	c, err := New(&config.HealthCheckConfig{Interval: "1h", Jitter: "0s", HistorySize: 3}, "/test", nil, NewPublisher(rec))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Stop()
+	ctx := context.Background()
+
+	c.checkOne(ctx, b) // fail -> unhealthy
+	c.checkOne(ctx, b) // fail, no change
+	healthy.Store(true)
+	c.checkOne(ctx, b) // pass -> healthy
+	c.checkOne(ctx, b) // pass, no change
+
+	h := c.History(b)
+	if len(h) != 3 {
+		t.Fatalf("expected history capped at 3, got %d", len(h))
+	}
+	if h[0].Result != ResultFail || h[0].Alive || h[0].Error != "unexpected status 503" {
+		t.Fatalf("oldest retained result should be the second failure: %+v", h[0])
+	}
+	if h[1].Result != ResultPass || !h[1].Alive || h[2].Result != ResultPass {
+		t.Fatalf("expected two passes after recovery: %+v", h[1:])
+	}
+	if !h[0].Time.Before(h[2].Time) || h[2].LatencyMs <= 0 {
+		t.Fatalf("expected ordered, timed results: %+v", h)
+	}
+
+	if got := rec.types(); len(got) != 2 || got[0] != EventUnhealthy || got[1] != EventHealthy {
+		t.Fatalf("expected unhealthy then healthy events, got %v", got)
+	}
+	if e := rec.events[0]; e.Route != "/test" || e.Backend != srv.URL || e.Reason == "" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	c.Update(nil)
+	if h := c.History(b); h != nil {
+		t.Fatalf("expected history of removed backend to be dropped, got %v", h)
+	}
+}
+
+func TestChecker_RemovedBackendsLeaveNoMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+
+	c, b := newTestChecker(t, srv.URL, config.HealthCheckConfig{})
+	c.Stop() // keep the loop from probing b on its own
+	c.Update([]*loadbalancer.Backend{b})
+	before := testutil.CollectAndCount(backendHealthy)
+	c.checkOne(context.Background(), b)
+	if n := testutil.CollectAndCount(backendHealthy); n != before+1 {
+		t.Fatalf("expected a gateway_backend_healthy series for the backend, got %d (was %d)", n, before)
+	}
+
+	c.Update(nil)
+	if n := testutil.CollectAndCount(backendHealthy); n != before {
+		t.Fatalf("removed backend still reported: %d series, want %d", n, before)
+	}
+	// A probe that was in flight when the backend went away is dropped
+	c.checkOne(context.Background(), b)
+	if n := testutil.CollectAndCount(backendHealthy); n != before || c.History(b) != nil {
+		t.Fatalf("late probe brought the removed backend back: %d series", n)
+	}
+}
+
+func TestChecker_InheritKeepsHistory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+
+	old, b := newTestChecker(t, srv.URL, config.HealthCheckConfig{HistorySize: 3})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		old.checkOne(ctx, b)
+	}
+
+	// The reloaded route has a new backend object for the same URL
+	c, nb := newTestChecker(t, srv.URL, config.HealthCheckConfig{HistorySize: 3})
+	c.Stop() // keep the loop from probing nb on its own
+	c.Update([]*loadbalancer.Backend{nb})
+	c.checkOne(ctx, nb)
+	c.Inherit(old)
+	c.checkOne(ctx, nb)
+
+	h := c.History(nb)
+	if len(h) != 3 || !h[0].Time.Before(h[2].Time) {
+		t.Fatalf("expected the old results followed by the new ones, capped at 3: %+v", h)
+	}
+	if !h[0].Time.Equal(old.History(b)[1].Time) {
+		t.Fatalf("expected the oldest kept result to be the old checker's last: %+v", h)
+	}
+}
+
+func TestChecker_SkipsMaintenance(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, b := newTestChecker(t, srv.URL, config.HealthCheckConfig{})
+	b.SetAdminState(loadbalancer.StateMaintenance)
+	c.Update([]*loadbalancer.Backend{b})
+	ctx := context.Background()
+
+	c.checkAll(ctx)
+	if n := probes.Load(); n != 0 || !b.IsAlive() || c.History(b) != nil {
+		t.Fatalf("backend in maintenance was checked: %d probes, alive %v", n, b.IsAlive())
+	}
+
+	b.SetAdminState(loadbalancer.StateActive)
+	c.checkAll(ctx)
+	if n := probes.Load(); n == 0 || b.IsAlive() {
+		t.Fatalf("checks did not resume after maintenance: %d probes, alive %v", n, b.IsAlive())
+	}
+}
@@ -0,0 +1,372 @@
+package health
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
+)
+
+// ---------------------------------------------------------------------------
+// Outlier detection (passive health checking)
+//
+// Modelled on Envoy: every proxied response is recorded, and a backend is
+// ejected from the pool after too many consecutive failures, or when its
+// success rate or latency stands out from its peers over an interval.
+// Ejections last base_ejection_time times the number of recent ejections,
+// and are lifted on the next interval tick once they expire.
+// ---------------------------------------------------------------------------
+
+// Reasons reported in ejection events and the ejections metric.
+const (
+	ReasonConsecutive5xx     = "consecutive_5xx"
+	ReasonConsecutiveGateway = "consecutive_gateway_failure"
+	ReasonSuccessRate        = "success_rate"
+	ReasonLatency            = "latency"
+)
+
+var (
+	ejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Name:      "outlier_ejections_total",
+		Help:      "Backends ejected by outlier detection.",
+	}, []string{"route", "backend", "reason"})
+
+	ejectedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Name:      "outlier_ejected",
+		Help:      "1 while a backend is ejected by outlier detection.",
+	}, []string{"route", "backend"})
+)
+
+// OutlierDetector ejects misbehaving backends of one route.
+// A nil *OutlierDetector records nothing.
+type OutlierDetector struct {
+	consecutive5xx     int
+	consecutiveGateway int
+	interval           time.Duration
+	baseEjection       time.Duration
+	maxEjection        time.Duration
+	maxEjectionPercent int
+	minHosts           int
+	requestVolume      int
+	stdevFactor        float64
+	latencyFactor      float64
+
+	backends func() []*loadbalancer.Backend
+	route    string
+	events   *Publisher
+	now      func() time.Time
+
+	mu    sync.Mutex // serialises ejection decisions
+	hosts sync.Map   // *loadbalancer.Backend -> *hostStats
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// hostStats is the detector's view of one backend.
+type hostStats struct {
+	mu           sync.Mutex
+	consec5xx    int
+	consecGW     int
+	requests     int // this interval
+	successes    int // this interval
+	latency      time.Duration
+	ejections    int // multiplier for the next ejection time
+	ejectedUntil time.Time
+}
+
+// NewOutlierDetector builds a detector for the backends returned by
+// backends, which is consulted on every interval so pool changes are picked
+// up. Ejections and returns are published to events, which may be nil. A nil
+// cfg uses the defaults. Call Start to begin interval analysis.
+func NewOutlierDetector(cfg *config.OutlierDetectionConfig, route string, backends func() []*loadbalancer.Backend, events *Publisher) (*OutlierDetector, error) {
+	if cfg == nil {
+		cfg = &config.OutlierDetectionConfig{}
+	}
+	d := &OutlierDetector{
+		consecutive5xx:     orDefault(cfg.Consecutive5xx, 5),
+		consecutiveGateway: orDefault(cfg.ConsecutiveGatewayFailure, 5),
+		maxEjectionPercent: orDefault(cfg.MaxEjectionPercent, 10),
+		minHosts:           orDefault(cfg.SuccessRateMinimumHosts, 5),
+		requestVolume:      orDefault(cfg.SuccessRateRequestVolume, 100),
+		stdevFactor:        cfg.SuccessRateStdevFactor,
+		latencyFactor:      cfg.LatencyFactor,
+		backends:           backends,
+		route:              route,
+		events:             events,
+		now:                time.Now,
+		stop:               make(chan struct{}),
+	}
+	if d.stdevFactor == 0 {
+		d.stdevFactor = 1.9
+	}
+
+	var err error
+	if d.interval, err = config.ParseDuration("outlier_detection.interval", cfg.Interval, 10*time.Second); err != nil {
+		return nil, err
+	}
+	if d.baseEjection, err = config.ParseDuration("outlier_detection.base_ejection_time", cfg.BaseEjectionTime, 30*time.Second); err != nil {
+		return nil, err
+	}
+	if d.maxEjection, err = config.ParseDuration("outlier_detection.max_ejection_time", cfg.MaxEjectionTime, 300*time.Second); err != nil {
+		return nil, err
+	}
+	if d.maxEjection < d.baseEjection {
+		d.maxEjection = d.baseEjection
+	}
+	return d, nil
+}
+
+// Start runs interval analysis until Stop is called.
+func (d *OutlierDetector) Start() {
+	if d == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.evaluate()
+			}
+		}
+	}()
+}
+
+// Stop ends interval analysis. Safe to call more than once.
+func (d *OutlierDetector) Stop() {
+	if d == nil {
+		return
+	}
+	d.once.Do(func() { close(d.stop) })
+}
+
+// Inherit carries the ejections of old, the detector d replaces on reload,
+// over to the backends of d with the same URL: an ejected backend stays out
+// until its ejection expires, and repeat offenders keep their longer
+// ejection time.
+func (d *OutlierDetector) Inherit(old *OutlierDetector) {
+	if d == nil || old == nil || old == d {
+		return
+	}
+	type ejection struct {
+		ejected   bool
+		ejections int
+		until     time.Time
+	}
+	prev := make(map[string]ejection)
+	old.hosts.Range(func(k, v any) bool {
+		b, h := k.(*loadbalancer.Backend), v.(*hostStats)
+		h.mu.Lock()
+		if h.ejections > 0 {
+			prev[b.URL] = ejection{ejected: b.IsEjected(), ejections: h.ejections, until: h.ejectedUntil}
+		}
+		h.mu.Unlock()
+		return true
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, b := range d.backends() {
+		e, ok := prev[b.URL]
+		if !ok {
+			continue
+		}
+		h := d.stats(b)
+		h.mu.Lock()
+		if h.ejections == 0 {
+			h.ejections, h.ejectedUntil = e.ejections, e.until
+			if e.ejected {
+				b.SetEjected(true) // the next tick lifts it once expired
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Record feeds one upstream outcome to the detector. status is the HTTP
+// status of the response, or 0 if none arrived (transport error, timeout).
+// latency is the time to response headers.
+func (d *OutlierDetector) Record(b *loadbalancer.Backend, status int, latency time.Duration) {
+	if d == nil {
+		return
+	}
+	failed := status == 0 || status >= 500
+	gateway := status == 0 || status == 502 || status == 503 || status == 504
+
+	h := d.stats(b)
+	h.mu.Lock()
+	h.requests++
+	h.latency += latency
+	if failed {
+		h.consec5xx++
+	} else {
+		h.successes++
+		h.consec5xx = 0
+	}
+	if gateway {
+		h.consecGW++
+	} else {
+		h.consecGW = 0
+	}
+	reason := ""
+	switch {
+	case d.consecutive5xx > 0 && h.consec5xx >= d.consecutive5xx:
+		reason = ReasonConsecutive5xx
+	case d.consecutiveGateway > 0 && h.consecGW >= d.consecutiveGateway:
+		reason = ReasonConsecutiveGateway
+	}
+	if reason != "" {
+		h.consec5xx, h.consecGW = 0, 0
+	}
+	h.mu.Unlock()
+
+	if reason != "" && !b.IsEjected() {
+		d.eject(b, reason, d.backends())
+	}
+}
+
+func (d *OutlierDetector) stats(b *loadbalancer.Backend) *hostStats {
+	if h, ok := d.hosts.Load(b); ok {
+		return h.(*hostStats)
+	}
+	h, _ := d.hosts.LoadOrStore(b, &hostStats{})
+	return h.(*hostStats)
+}
+
+// eject takes b out of the pool unless that would exceed the ejection cap.
+func (d *OutlierDetector) eject(b *loadbalancer.Backend, reason string, pool []*loadbalancer.Backend) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if b.IsEjected() {
+		return false
+	}
+
+	ejected, member := 0, false
+	for _, p := range pool {
+		if p.IsEjected() {
+			ejected++
+		}
+		member = member || p == b
+	}
+	if !member {
+		return false // removed from the route meanwhile
+	}
+	// Envoy semantics: eject while the ejected share is below the cap, so
+	// one backend can always go; but never empty the pool.
+	if ejected+1 >= len(pool) || ejected*100 >= d.maxEjectionPercent*len(pool) {
+		return false
+	}
+
+	h := d.stats(b)
+	h.mu.Lock()
+	h.ejections++
+	dur := min(d.baseEjection*time.Duration(h.ejections), d.maxEjection)
+	now := d.now()
+	until := now.Add(dur)
+	h.ejectedUntil = until
+	h.mu.Unlock()
+
+	b.SetEjected(true)
+	ejectionsTotal.WithLabelValues(d.route, b.URL, reason).Inc()
+	ejectedGauge.WithLabelValues(d.route, b.URL).Set(1)
+	d.events.Publish(Event{Time: now, Route: d.route, Backend: b.URL, Type: EventEjected, Reason: reason, Until: &until})
+	return true
+}
+
+// evaluate runs one interval: lifts expired ejections, then compares the
+// interval's success rates and latencies across the pool.
+func (d *OutlierDetector) evaluate() {
+	now := d.now()
+	pool := d.backends()
+
+	type sample struct {
+		b           *loadbalancer.Backend
+		successRate float64
+		latency     float64
+	}
+	var samples []sample
+	inPool := make(map[*loadbalancer.Backend]bool, len(pool))
+	for _, b := range pool {
+		inPool[b] = true
+		h := d.stats(b)
+		h.mu.Lock()
+		switch {
+		case b.IsEjected() && !now.Before(h.ejectedUntil):
+			b.SetEjected(false)
+			ejectedGauge.WithLabelValues(d.route, b.URL).Set(0)
+			d.events.Publish(Event{Time: now, Route: d.route, Backend: b.URL, Type: EventReturned})
+		case !b.IsEjected() && h.ejections > 0 && now.After(h.ejectedUntil.Add(d.baseEjection)):
+			// Healthy for a while: shorten the next ejection.
+			h.ejections--
+		}
+		if !b.IsEjected() && d.requestVolume > 0 && h.requests >= d.requestVolume {
+			samples = append(samples, sample{
+				b:           b,
+				successRate: float64(h.successes) / float64(h.requests),
+				latency:     float64(h.latency) / float64(h.requests),
+			})
+		}
+		h.requests, h.successes, h.latency = 0, 0, 0
+		h.mu.Unlock()
+	}
+	d.hosts.Range(func(k, _ any) bool {
+		if !inPool[k.(*loadbalancer.Backend)] {
+			d.hosts.Delete(k)
+		}
+		return true
+	})
+
+	if d.minHosts <= 0 || len(samples) < d.minHosts {
+		return
+	}
+
+	var mean float64
+	for _, s := range samples {
+		mean += s.successRate
+	}
+	mean /= float64(len(samples))
+	var variance float64
+	for _, s := range samples {
+		variance += (s.successRate - mean) * (s.successRate - mean)
+	}
+	threshold := mean - d.stdevFactor*math.Sqrt(variance/float64(len(samples)))
+
+	var median float64
+	if d.latencyFactor > 0 {
+		lat := make([]float64, len(samples))
+		for i, s := range samples {
+			lat[i] = s.latency
+		}
+		sort.Float64s(lat)
+		median = lat[len(lat)/2]
+		if len(lat)%2 == 0 {
+			median = (lat[len(lat)/2-1] + lat[len(lat)/2]) / 2
+		}
+	}
+
+	for _, s := range samples {
+		switch {
+		case s.successRate < threshold:
+			d.eject(s.b, ReasonSuccessRate, pool)
+		case d.latencyFactor > 0 && s.latency > d.latencyFactor*median:
+			d.eject(s.b, ReasonLatency, pool)
+		}
+	}
+}
+
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
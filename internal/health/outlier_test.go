@@ -0,0 +1,232 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
+)
+
+// newTestDetector returns a detector over n backends with a controllable clock.
+func newTestDetector(t *testing.T, n int, cfg config.OutlierDetectionConfig) (*OutlierDetector, []*loadbalancer.Backend, *time.Time) {
+	t.Helper()
+	cfgs := make([]config.BackendConfig, n)
+	for i := range cfgs {
+		cfgs[i] = config.BackendConfig{URL: "http://b" + string(rune('0'+i)), Weight: 1}
+	}
+	lb := loadbalancer.New("round_robin", cfgs)
+	d, err := NewOutlierDetector(&cfg, "/test", lb.Backends, nil)
+	if err != nil {
+		t.Fatalf("NewOutlierDetector: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	d.now = func() time.Time { return now }
+	return d, lb.Backends(), &now
+}
+
+func TestOutlier_SingleFailureDoesNotEject(t *testing.T) {
+	d, bs, _ := newTestDetector(t, 3, config.OutlierDetectionConfig{})
+	d.Record(bs[0], 500, time.Millisecond)
+	if bs[0].IsEjected() || !bs[0].Available() {
+		t.Fatal("one 5xx must not eject a backend")
+	}
+}
+
+func TestOutlier_Consecutive5xxEjectsAndExpires(t *testing.T) {
+	d, bs, now := newTestDetector(t, 3, config.OutlierDetectionConfig{
+		Consecutive5xx: 3, BaseEjectionTime: "30s", MaxEjectionPercent: 50,
+	})
+
+	d.Record(bs[0], 500, time.Millisecond)
+	d.Record(bs[0], 500, time.Millisecond)
+	d.Record(bs[0], 200, time.Millisecond) // resets the streak
+	d.Record(bs[0], 500, time.Millisecond)
+	d.Record(bs[0], 500, time.Millisecond)
+	if bs[0].IsEjected() {
+		t.Fatal("streak was broken by a success; expected no ejection yet")
+	}
+	d.Record(bs[0], 500, time.Millisecond)
+	if !bs[0].IsEjected() || bs[0].Available() {
+		t.Fatal("expected ejection after 3 consecutive 5xx")
+	}
+
+	*now = now.Add(29 * time.Second)
+	d.evaluate()
+	if !bs[0].IsEjected() {
+		t.Fatal("ejection lifted early")
+	}
+	*now = now.Add(time.Second)
+	d.evaluate()
+	if bs[0].IsEjected() {
+		t.Fatal("expected ejection to be lifted after base_ejection_time")
+	}
+}
+
+func TestOutlier_PublishesEvents(t *testing.T) {
+	d, bs, now := newTestDetector(t, 3, config.OutlierDetectionConfig{
+		Consecutive5xx: 1, BaseEjectionTime: "30s", MaxEjectionPercent: 50,
+	})
+	rec := &recorder{}
+	d.events = NewPublisher(rec)
+
+	d.Record(bs[1], 502, time.Millisecond)
+	*now = now.Add(30 * time.Second)
+	d.evaluate()
+
+	if got := rec.types(); len(got) != 2 || got[0] != EventEjected || got[1] != EventReturned {
+		t.Fatalf("expected ejected then returned events, got %v", got)
+	}
+	e := rec.events[0]
+	if e.Route != "/test" || e.Backend != bs[1].URL || e.Reason != ReasonConsecutive5xx ||
+		e.Until == nil || e.Until.Sub(e.Time) != 30*time.Second {
+		t.Fatalf("unexpected ejection event: %+v", e)
+	}
+}
+
+func TestOutlier_EjectionTimeGrows(t *testing.T) {
+	d, bs, now := newTestDetector(t, 3, config.OutlierDetectionConfig{
+		Consecutive5xx: 1, BaseEjectionTime: "10s", MaxEjectionTime: "25s", MaxEjectionPercent: 50,
+	})
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 25 * time.Second} {
+		start := *now
+		d.Record(bs[0], 503, 0)
+		for bs[0].IsEjected() {
+			*now = now.Add(time.Second)
+			d.evaluate()
+		}
+		if got := now.Sub(start); got != want {
+			t.Errorf("expected ejection of %v, got %v", want, got)
+		}
+	}
+}
+
+func TestOutlier_InheritKeepsEjections(t *testing.T) {
+	cfg := config.OutlierDetectionConfig{Consecutive5xx: 1, BaseEjectionTime: "10s", MaxEjectionPercent: 50}
+	old, _, now := newTestDetector(t, 3, cfg)
+	oldBackends := old.backends()
+	old.Record(oldBackends[0], 503, 0)
+
+	// A reload that rebuilds the balancer brings new backends with the same URLs
+	d, bs, _ := newTestDetector(t, 3, cfg)
+	d.now = old.now
+	d.Inherit(old)
+	if !bs[0].IsEjected() || bs[1].IsEjected() {
+		t.Fatal("expected the ejection to carry over by URL")
+	}
+	*now = now.Add(9 * time.Second)
+	d.evaluate()
+	if !bs[0].IsEjected() {
+		t.Fatal("ejection lifted early after the reload")
+	}
+	*now = now.Add(time.Second)
+	d.evaluate()
+	if bs[0].IsEjected() {
+		t.Fatal("expected the ejection to be lifted once it expired")
+	}
+
+	// The next ejection is the second one: twice as long
+	start := *now
+	d.Record(bs[0], 503, 0)
+	for bs[0].IsEjected() {
+		*now = now.Add(time.Second)
+		d.evaluate()
+	}
+	if got := now.Sub(start); got != 20*time.Second {
+		t.Errorf("expected the second ejection to last 20s, got %v", got)
+	}
+}
+
+func TestOutlier_ConsecutiveGatewayFailure(t *testing.T) {
+	d, bs, _ := newTestDetector(t, 3, config.OutlierDetectionConfig{
+		Consecutive5xx: -1, ConsecutiveGatewayFailure: 2, MaxEjectionPercent: 50,
+	})
+	d.Record(bs[0], 500, 0)
+	d.Record(bs[0], 500, 0)
+	if bs[0].IsEjected() {
+		t.Fatal("500 is not a gateway failure")
+	}
+	d.Record(bs[0], 0, 0) // transport error
+	d.Record(bs[0], 502, 0)
+	if !bs[0].IsEjected() {
+		t.Fatal("expected ejection after consecutive gateway failures")
+	}
+}
+
+func TestOutlier_MaxEjectionPercent(t *testing.T) {
+	d, bs, _ := newTestDetector(t, 4, config.OutlierDetectionConfig{Consecutive5xx: 1, MaxEjectionPercent: 10})
+	for _, b := range bs {
+		d.Record(b, 500, 0)
+	}
+	ejected := 0
+	for _, b := range bs {
+		if b.IsEjected() {
+			ejected++
+		}
+	}
+	if ejected != 1 {
+		t.Errorf("expected exactly one ejection under a 10%% cap, got %d", ejected)
+	}
+}
+
+func TestOutlier_NeverEmptiesPool(t *testing.T) {
+	d, bs, _ := newTestDetector(t, 2, config.OutlierDetectionConfig{Consecutive5xx: 1, MaxEjectionPercent: 100})
+	d.Record(bs[0], 500, 0)
+	d.Record(bs[1], 500, 0)
+	if bs[0].IsEjected() == bs[1].IsEjected() {
+		t.Fatalf("expected exactly one of two backends ejected, got %v and %v", bs[0].IsEjected(), bs[1].IsEjected())
+	}
+}
+
+func TestOutlier_SuccessRate(t *testing.T) {
+	d, bs, _ := newTestDetector(t, 5, config.OutlierDetectionConfig{
+		Consecutive5xx: -1, ConsecutiveGatewayFailure: -1,
+		SuccessRateMinimumHosts: 5, SuccessRateRequestVolume: 100,
+	})
+	for i, b := range bs {
+		for n := 0; n < 100; n++ {
+			status := 200
+			if i == 2 && n%2 == 0 {
+				status = 500 // 50% success
+			} else if n == 0 {
+				status = 500 // 99% success
+			}
+			d.Record(b, status, time.Millisecond)
+		}
+	}
+	d.evaluate()
+	for i, b := range bs {
+		if b.IsEjected() != (i == 2) {
+			t.Errorf("backend %d: ejected=%v", i, b.IsEjected())
+		}
+	}
+}
+
+func TestOutlier_Latency(t *testing.T) {
+	d, bs, _ := newTestDetector(t, 5, config.OutlierDetectionConfig{
+		SuccessRateMinimumHosts: 5, SuccessRateRequestVolume: 10, LatencyFactor: 3,
+	})
+	for i, b := range bs {
+		lat := 10 * time.Millisecond
+		if i == 4 {
+			lat = 100 * time.Millisecond
+		}
+		for n := 0; n < 10; n++ {
+			d.Record(b, 200, lat)
+		}
+	}
+	d.evaluate()
+	for i, b := range bs {
+		if b.IsEjected() != (i == 4) {
+			t.Errorf("backend %d: ejected=%v", i, b.IsEjected())
+		}
+	}
+}
+
+func TestOutlier_BadConfig(t *testing.T) {
+	_, err := NewOutlierDetector(&config.OutlierDetectionConfig{Interval: "soon"}, "/test",
+		func() []*loadbalancer.Backend { return nil }, nil)
+	if err == nil {
+		t.Fatal("expected an invalid interval to be rejected")
+	}
+}
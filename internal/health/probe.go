@@ -0,0 +1,234 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
+)
+
+// ---------------------------------------------------------------------------
+// Probe types
+// ---------------------------------------------------------------------------
+
+// Check types for HealthCheckConfig.Type.
+const (
+	TypeHTTP = "http" // request and inspect status / body
+	TypeTCP  = "tcp"  // TCP connect
+	TypeTLS  = "tls"  // TCP connect and TLS handshake
+	TypeGRPC = "grpc" // grpc.health.v1.Health/Check
+)
+
+// Probe checks one backend once. It returns nil if the backend is healthy,
+// or an error describing why not. ctx carries the check's timeout.
+type Probe interface {
+	Check(ctx context.Context, b *loadbalancer.Backend) error
+}
+
+// newProbe builds the probe selected by cfg.Type.
+func newProbe(cfg *config.HealthCheckConfig) (Probe, error) {
+	var tlsCfg *tls.Config
+	if cfg.TLSServerName != "" || cfg.TLSSkipVerify {
+		tlsCfg = &tls.Config{ServerName: cfg.TLSServerName, InsecureSkipVerify: cfg.TLSSkipVerify} //nolint:gosec // opt-in for self-signed backends
+	}
+
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeHTTP:
+		return newHTTPProbe(cfg, tlsCfg)
+	case TypeTCP:
+		return &tcpProbe{port: cfg.Port}, nil
+	case TypeTLS:
+		return &tlsProbe{port: cfg.Port, tls: tlsCfg}, nil
+	case TypeGRPC:
+		return &grpcProbe{port: cfg.Port, service: cfg.GRPCService, tls: tlsCfg, authority: cfg.Headers["Host"]}, nil
+	default:
+		return nil, fmt.Errorf("unknown health_check.type %q", cfg.Type)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// HTTP
+// ---------------------------------------------------------------------------
+
+type httpProbe struct {
+	client    *http.Client
+	path      string
+	method    string
+	headers   http.Header
+	host      string
+	statuses  []statusRange
+	body      string
+	bodyRegex *regexp.Regexp
+}
+
+type statusRange struct{ lo, hi int }
+
+func newHTTPProbe(cfg *config.HealthCheckConfig, tlsCfg *tls.Config) (*httpProbe, error) {
+	p := &httpProbe{
+		path:    cfg.Path,
+		method:  strings.ToUpper(cfg.Method),
+		headers: make(http.Header),
+		body:    cfg.ExpectedBody,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsCfg, DisableKeepAlives: true},
+			// Don't follow redirects on health checks
+			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	if p.path == "" {
+		p.path = defaultHealthPath
+	}
+	if p.method == "" {
+		p.method = http.MethodGet
+	}
+	for k, v := range cfg.Headers {
+		if strings.EqualFold(k, "Host") {
+			p.host = v
+			continue
+		}
+		p.headers.Set(k, v)
+	}
+
+	var err error
+	if p.statuses, err = parseStatuses(cfg.ExpectedStatuses); err != nil {
+		return nil, err
+	}
+	if cfg.ExpectedBodyRegex != "" {
+		if p.bodyRegex, err = regexp.Compile(cfg.ExpectedBodyRegex); err != nil {
+			return nil, fmt.Errorf("health_check.expected_body_regex: %w", err)
+		}
+	}
+	return p, nil
+}
+
+func (p *httpProbe) Check(ctx context.Context, b *loadbalancer.Backend) error {
+	req, err := http.NewRequestWithContext(ctx, p.method, b.URL+p.path, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range p.headers {
+		req.Header[k] = vs
+	}
+	if p.host != "" {
+		req.Host = p.host
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !p.statusOK(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if p.body == "" && p.bodyRegex == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	if p.body != "" && !strings.Contains(string(body), p.body) {
+		return fmt.Errorf("body does not contain %q", p.body)
+	}
+	if p.bodyRegex != nil && !p.bodyRegex.Match(body) {
+		return fmt.Errorf("body does not match %q", p.bodyRegex)
+	}
+	return nil
+}
+
+func (p *httpProbe) statusOK(code int) bool {
+	if len(p.statuses) == 0 {
+		return code < 500
+	}
+	for _, r := range p.statuses {
+		if code >= r.lo && code <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatuses parses entries such as "200", "200-299".
+func parseStatuses(specs []string) ([]statusRange, error) {
+	var out []statusRange
+	for _, s := range specs {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+		if !isRange {
+			hi = lo
+		}
+		l, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		h, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || l < 100 || h > 599 || l > h {
+			return nil, fmt.Errorf("health_check.expected_statuses: invalid entry %q", s)
+		}
+		out = append(out, statusRange{l, h})
+	}
+	return out, nil
+}
+
+// ---------------------------------------------------------------------------
+// TCP and TLS
+// ---------------------------------------------------------------------------
+
+type tcpProbe struct{ port int }
+
+func (p *tcpProbe) Check(ctx context.Context, b *loadbalancer.Backend) error {
+	addr, err := probeAddr(b.URL, p.port)
+	if err != nil {
+		return err
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+type tlsProbe struct {
+	port int
+	tls  *tls.Config
+}
+
+func (p *tlsProbe) Check(ctx context.Context, b *loadbalancer.Backend) error {
+	addr, err := probeAddr(b.URL, p.port)
+	if err != nil {
+		return err
+	}
+	conn, err := (&tls.Dialer{Config: p.tls}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	return conn.Close()
+}
+
+// probeAddr returns host:port for a backend URL, with port overriding the
+// URL's port (or the scheme's default) when non-zero.
+func probeAddr(rawURL string, port int) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	p := u.Port()
+	switch {
+	case port > 0:
+		p = strconv.Itoa(port)
+	case p == "" && u.Scheme == "https":
+		p = "443"
+	case p == "":
+		p = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), p), nil
+}
@@ -0,0 +1,156 @@
+package health
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func checkBackend(t *testing.T, cfg config.HealthCheckConfig, url string) error {
+	t.Helper()
+	p, err := newProbe(&cfg)
+	if err != nil {
+		t.Fatalf("newProbe: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return p.Check(ctx, loadbalancer.New("round_robin", []config.BackendConfig{{URL: url, Weight: 1}}).Backends()[0])
+}
+
+func TestProbe_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// The URL's port is overridden by health_check.port.
+	if err := checkBackend(t, config.HealthCheckConfig{Type: "tcp", Port: port}, "http://127.0.0.1:1"); err != nil {
+		t.Fatalf("expected open port to pass, got %v", err)
+	}
+	ln.Close()
+	if err := checkBackend(t, config.HealthCheckConfig{Type: "tcp", Port: port}, "http://127.0.0.1:1"); err == nil {
+		t.Fatal("expected closed port to fail")
+	}
+}
+
+func TestProbe_TLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	if err := checkBackend(t, config.HealthCheckConfig{Type: "tls"}, srv.URL); err == nil {
+		t.Fatal("expected an untrusted certificate to fail the handshake")
+	}
+	if err := checkBackend(t, config.HealthCheckConfig{Type: "tls", TLSSkipVerify: true}, srv.URL); err != nil {
+		t.Fatalf("expected handshake to pass, got %v", err)
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer plain.Close()
+	if err := checkBackend(t, config.HealthCheckConfig{Type: "tls", TLSSkipVerify: true}, plain.URL); err == nil {
+		t.Fatal("expected a plaintext port to fail the handshake")
+	}
+}
+
+// newGRPCHealthServer serves grpc.health.v1.Health/Check over HTTP/2, with
+// TLS or cleartext (h2c), using statuses to answer per service; unknown services get NOT_FOUND as a
+// trailers-only response, like grpc-go, and service "overloaded" gets a
+// SERVING message followed by grpc-status UNAVAILABLE.
+func newGRPCHealthServer(t *testing.T, statuses map[string]byte, useTLS bool) *httptest.Server {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != grpcHealthPath || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected request %s %s %v", r.Proto, r.URL.Path, r.Header)
+		}
+		var frame [5]byte
+		_, _ = r.Body.Read(frame[:])
+		msg := make([]byte, binary.BigEndian.Uint32(frame[1:]))
+		_, _ = r.Body.Read(msg)
+		service := ""
+		if len(msg) > 2 {
+			service = string(msg[2:])
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		status, ok := statuses[service]
+		if !ok {
+			w.Header().Set("Grpc-Status", "5")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		_, _ = w.Write([]byte{0, 0, 0, 0, 2, 0x08, status})
+		if service == "overloaded" {
+			w.Header().Set("Grpc-Status", "14")
+			w.Header().Set("Grpc-Message", "too many requests")
+			return
+		}
+		w.Header().Set("Grpc-Status", "0")
+	})
+	var srv *httptest.Server
+	if useTLS {
+		srv = httptest.NewUnstartedServer(handler)
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+	} else {
+		srv = httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProbe_GRPC(t *testing.T) {
+	t.Run("tls", func(t *testing.T) { testGRPCProbe(t, true) })
+	t.Run("h2c", func(t *testing.T) { testGRPCProbe(t, false) })
+}
+
+func testGRPCProbe(t *testing.T, useTLS bool) {
+	srv := newGRPCHealthServer(t, map[string]byte{"": 1, "users.v1.Users": 1, "billing": 2, "overloaded": 1}, useTLS)
+
+	cases := []struct {
+		service string
+		wantErr string
+	}{
+		{"", ""},
+		{"users.v1.Users", ""},
+		{"billing", "NOT_SERVING"},
+		{"missing", "grpc status 5"},
+		{"overloaded", "grpc status 14: too many requests"},
+	}
+	for _, tc := range cases {
+		err := checkBackend(t, config.HealthCheckConfig{Type: "grpc", GRPCService: tc.service, TLSSkipVerify: useTLS}, srv.URL)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("service %q: expected SERVING, got %v", tc.service, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("service %q: expected error containing %q, got %v", tc.service, tc.wantErr, err)
+		}
+	}
+}
+
+func TestProbe_UnknownType(t *testing.T) {
+	if _, err := newProbe(&config.HealthCheckConfig{Type: "icmp"}); err == nil {
+		t.Fatal("expected unknown type to be rejected")
+	}
+}
+
+func TestParseServingStatus(t *testing.T) {
+	// Unknown length-delimited field before the status.
+	msg := []byte{0x12, 0x02, 'h', 'i', 0x08, 0x01}
+	if s, err := parseServingStatus(msg); err != nil || s != 1 {
+		t.Fatalf("expected SERVING, got %d, %v", s, err)
+	}
+	if _, err := parseServingStatus([]byte{0x12, 0x05, 'h'}); err == nil {
+		t.Fatal("expected truncated message to be rejected")
+	}
+}
@@ -0,0 +1,303 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// ---------------------------------------------------------------------------
+// Consistent hashing: ring hash and Maglev
+//
+// Both map a request's hash key to a backend so that adding or removing one
+// backend only moves the keys that belonged to it (ring hash) or roughly
+// that share plus a little (Maglev), instead of reshuffling nearly every
+// client as ip_hash does.
+// ---------------------------------------------------------------------------
+
+const (
+	defaultVirtualNodes = 100
+	defaultTableSize    = 65537 // prime, as Maglev requires
+)
+
+// hashOptions holds the validated hash settings shared by both balancers.
+type hashOptions struct {
+	key       hashKeyFunc
+	vnodes    int
+	tableSize int
+}
+
+func newHashOptions(cfg *config.HashConfig) (hashOptions, error) {
+	if cfg == nil {
+		cfg = &config.HashConfig{}
+	}
+	key, err := parseHashKey(cfg.Key)
+	if err != nil {
+		return hashOptions{}, err
+	}
+	o := hashOptions{key: key, vnodes: defaultVirtualNodes, tableSize: defaultTableSize}
+	if cfg.VirtualNodes != 0 {
+		if cfg.VirtualNodes < 0 {
+			return hashOptions{}, fmt.Errorf("hash.virtual_nodes %d: must be positive", cfg.VirtualNodes)
+		}
+		o.vnodes = cfg.VirtualNodes
+	}
+	if cfg.TableSize != 0 {
+		if !isPrime(cfg.TableSize) {
+			return hashOptions{}, fmt.Errorf("hash.table_size %d: must be a prime", cfg.TableSize)
+		}
+		o.tableSize = cfg.TableSize
+	}
+	return o, nil
+}
+
+// ---------------------------------------------------------------------------
+// Ring hash (Karger et al.), with weight-proportional virtual nodes
+// ---------------------------------------------------------------------------
+
+type ringHash struct {
+	mu       sync.RWMutex
+	backends []*Backend
+	ring     []ringEntry // sorted by hash
+	vnodes   int
+	key      hashKeyFunc
+	ss       *slowStart
+}
+
+type ringEntry struct {
+	hash uint64
+	b    *Backend
+}
+
+func newRingHash(bs []*Backend, o hashOptions, ss *slowStart) *ringHash {
+	rh := &ringHash{backends: bs, vnodes: o.vnodes, key: o.key, ss: ss}
+	rh.ring = buildRing(bs, rh.vnodes)
+	return rh
+}
+
+// buildRing places vnodes points per unit of weight for every backend, so
+// backends of weight 0 get none.
+func buildRing(bs []*Backend, vnodes int) []ringEntry {
+	var ring []ringEntry
+	for _, b := range bs {
+		for i := 0; i < vnodes*b.Weight(); i++ {
+			ring = append(ring, ringEntry{hash64(b.URL + "#" + strconv.Itoa(i)), b})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+func (rh *ringHash) Next(r *http.Request) (*Backend, error) {
+	rh.mu.RLock()
+	ring := rh.ring
+	rh.mu.RUnlock()
+
+	h := hash64(rh.key(r))
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+
+	// Walk clockwise past unavailable (and, while warming, unadmitted)
+	// backends, so only the keys of a missing backend move.
+	var now time.Time
+	if rh.ss != nil {
+		now = rh.ss.now()
+	}
+	roll := hashRoll(uint32(h))
+	var first *Backend
+	var turnedAway []*Backend
+	for i := range ring {
+		b := ring[(start+i)%len(ring)].b
+		if !b.Routable() || containsBackend(turnedAway, b) {
+			continue
+		}
+		if first == nil {
+			first = b
+		}
+		if rh.ss == nil || rh.ss.admit(b, now, roll(len(turnedAway))) {
+			return b, nil
+		}
+		turnedAway = append(turnedAway, b)
+	}
+	if first == nil {
+		return nil, ErrNoHealthyBackend
+	}
+	return first, nil
+}
+
+func (rh *ringHash) Backends() []*Backend {
+	rh.mu.RLock()
+	defer rh.mu.RUnlock()
+	return rh.backends
+}
+
+func (rh *ringHash) Update(cfgs []config.BackendConfig) { rh.update(cfgs, nil) }
+
+func (rh *ringHash) update(cfgs []config.BackendConfig, from map[string]*Backend) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	rh.backends = mergeBackends(rh.backends, cfgs, from)
+	rh.ring = buildRing(rh.backends, rh.vnodes)
+}
+
+// ---------------------------------------------------------------------------
+// Maglev (Eisenbud et al., NSDI '16), weighted as in Envoy
+//
+// The lookup table covers the currently available backends and is rebuilt
+// when that set changes, so a failed backend's slots are redistributed
+// evenly rather than spilling onto a ring neighbour.
+// ---------------------------------------------------------------------------
+
+type maglev struct {
+	mu       sync.RWMutex
+	backends []*Backend
+	size     int
+	key      hashKeyFunc
+	ss       *slowStart
+	table    []*Backend
+	tableFor []*Backend // the available backends table was built from
+}
+
+func newMaglev(bs []*Backend, o hashOptions, ss *slowStart) *maglev {
+	return &maglev{backends: bs, size: o.tableSize, key: o.key, ss: ss}
+}
+
+func (m *maglev) Next(r *http.Request) (*Backend, error) {
+	table, n, err := m.lookupTable()
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash64(m.key(r))
+	b := table[h%uint64(len(table))]
+	if m.ss == nil {
+		return b, nil
+	}
+	// Warming backends turn some keys away; retry with rehashed keys.
+	now := m.ss.now()
+	roll := hashRoll(uint32(h))
+	for i := 0; i < 2*n && !m.ss.admit(b, now, roll(i)); i++ {
+		h = hash64(strconv.FormatUint(h, 16))
+		b = table[h%uint64(len(table))]
+	}
+	return b, nil
+}
+
+// lookupTable returns the table for the current set of available backends,
+// and the size of that set.
+func (m *maglev) lookupTable() ([]*Backend, int, error) {
+	m.mu.RLock()
+	alive := healthy(m.backends)
+	table := m.table
+	current := sameBackends(alive, m.tableFor)
+	m.mu.RUnlock()
+	if len(alive) == 0 {
+		return nil, 0, ErrNoHealthyBackend
+	}
+	if current {
+		return table, len(alive), nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !sameBackends(alive, m.tableFor) {
+		m.table = buildMaglev(alive, m.size)
+		m.tableFor = alive
+	}
+	return m.table, len(alive), nil
+}
+
+// buildMaglev fills a table of the given (prime) size by letting each
+// backend claim slots in its own permutation order, at a rate proportional
+// to its weight.
+func buildMaglev(bs []*Backend, size int) []*Backend {
+	m := uint64(size)
+	offset := make([]uint64, len(bs))
+	skip := make([]uint64, len(bs))
+	next := make([]uint64, len(bs))
+	claimed := make([]int, len(bs))
+	maxWeight := 1
+	for i, b := range bs {
+		offset[i] = hash64(b.URL) % m
+		skip[i] = hash64(b.URL+"#skip")%(m-1) + 1
+		maxWeight = max(maxWeight, b.Weight())
+	}
+
+	table := make([]*Backend, size)
+	filled := 0
+	for round := 1; ; round++ {
+		for i, b := range bs {
+			// A backend of weight w claims w/maxWeight slots per round
+			if claimed[i]*maxWeight >= round*max(b.Weight(), 1) {
+				continue
+			}
+			c := (offset[i] + next[i]*skip[i]) % m
+			for table[c] != nil {
+				next[i]++
+				c = (offset[i] + next[i]*skip[i]) % m
+			}
+			table[c] = b
+			next[i]++
+			claimed[i]++
+			if filled++; filled == size {
+				return table
+			}
+		}
+	}
+}
+
+func (m *maglev) Backends() []*Backend {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.backends
+}
+
+func (m *maglev) Update(cfgs []config.BackendConfig) { m.update(cfgs, nil) }
+
+func (m *maglev) update(cfgs []config.BackendConfig, from map[string]*Backend) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.backends = mergeBackends(m.backends, cfgs, from)
+	m.table, m.tableFor = nil, nil
+}
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+func sameBackends(a, b []*Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsBackend(bs []*Backend, b *Backend) bool {
+	for _, x := range bs {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+func newHashLB(t *testing.T, algorithm string, hash config.HashConfig, weights ...int) (Balancer, []*Backend) {
+	t.Helper()
+	cfgs := make([]config.BackendConfig, len(weights))
+	for i, w := range weights {
+		cfgs[i] = config.BackendConfig{URL: fmt.Sprintf("http://10.0.0.%d:8080", i), Weight: w}
+	}
+	lb, err := NewWithOptions(algorithm, cfgs, Options{Hash: &hash})
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	return lb, lb.Backends()
+}
+
+func userRequest(id int) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-User-ID", fmt.Sprintf("user-%d", id))
+	return r
+}
+
+// assignments maps n users to backends.
+func assignments(t *testing.T, lb Balancer, n int) []*Backend {
+	t.Helper()
+	out := make([]*Backend, n)
+	for i := range out {
+		b, err := lb.Next(userRequest(i))
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		out[i] = b
+	}
+	return out
+}
+
+func TestConsistentHash_MinimalRemapping(t *testing.T) {
+	for _, algorithm := range []string{"ring_hash", "maglev"} {
+		t.Run(algorithm, func(t *testing.T) {
+			lb, bs := newHashLB(t, algorithm, config.HashConfig{Key: "header:X-User-ID"}, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1)
+			const users = 5000
+			before := assignments(t, lb, users)
+
+			bs[3].SetAlive(false)
+			after := assignments(t, lb, users)
+			moved := 0
+			for i := range before {
+				if before[i] == bs[3] {
+					if after[i] == bs[3] {
+						t.Fatal("a dead backend must not be chosen")
+					}
+					continue
+				}
+				if before[i] != after[i] {
+					moved++
+				}
+			}
+			// Ring hash moves only the dead backend's keys; Maglev a little more.
+			if limit := users / 50; moved > limit {
+				t.Fatalf("%d keys of healthy backends moved, want at most %d", moved, limit)
+			}
+
+			bs[3].SetAlive(true)
+			restored := assignments(t, lb, users)
+			for i := range before {
+				if before[i] != restored[i] {
+					t.Fatalf("user %d did not return to its backend after recovery", i)
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHash_Weights(t *testing.T) {
+	for _, algorithm := range []string{"ring_hash", "maglev"} {
+		t.Run(algorithm, func(t *testing.T) {
+			lb, bs := newHashLB(t, algorithm, config.HashConfig{Key: "header:X-User-ID", VirtualNodes: 200, TableSize: 10007}, 1, 3)
+			heavy := 0
+			for _, b := range assignments(t, lb, 8000) {
+				if b == bs[1] {
+					heavy++
+				}
+			}
+			if share := float64(heavy) / 8000; share < 0.68 || share > 0.82 {
+				t.Fatalf("weight-3 backend got %.2f of keys, want about 0.75", share)
+			}
+		})
+	}
+}
+
+func TestConsistentHash_SlowStart(t *testing.T) {
+	for _, algorithm := range []string{"ring_hash", "maglev"} {
+		t.Run(algorithm, func(t *testing.T) {
+			cfgs := []config.BackendConfig{{URL: "http://a", Weight: 1}, {URL: "http://b", Weight: 1}}
+			lb, err := NewWithOptions(algorithm, cfgs, Options{
+				Hash:      &config.HashConfig{Key: "header:X-User-ID"},
+				SlowStart: &config.SlowStartConfig{Window: "1h"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs := lb.Backends()
+			bs[1].SetAvailableSince(time.Now().Add(-30 * time.Minute)) // factor 0.5
+
+			first := assignments(t, lb, 4000)
+			warm := 0
+			for _, b := range first {
+				if b == bs[1] {
+					warm++
+				}
+			}
+			if share := float64(warm) / 4000; share < 0.15 || share > 0.4 {
+				t.Fatalf("warming backend got %.2f of keys, want about 0.25", share)
+			}
+			again := assignments(t, lb, 4000)
+			for i := range first {
+				if first[i] != again[i] {
+					t.Fatal("slow start must not break key affinity")
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHash_Keys(t *testing.T) {
+	for _, tc := range []struct {
+		key  string
+		req  func(v string) *http.Request
+		same func(v string) *http.Request // a different request with the same key
+	}{
+		{"header:X-Tenant", func(v string) *http.Request {
+			r := httptest.NewRequest("GET", "/a", nil)
+			r.Header.Set("X-Tenant", v)
+			return r
+		}, func(v string) *http.Request {
+			r := httptest.NewRequest("POST", "/b", nil)
+			r.Header.Set("X-Tenant", v)
+			r.RemoteAddr = "192.0.2.99:1"
+			return r
+		}},
+		{"cookie:session", func(v string) *http.Request {
+			r := httptest.NewRequest("GET", "/a", nil)
+			r.AddCookie(&http.Cookie{Name: "session", Value: v})
+			return r
+		}, func(v string) *http.Request {
+			r := httptest.NewRequest("GET", "/b", nil)
+			r.AddCookie(&http.Cookie{Name: "session", Value: v})
+			r.RemoteAddr = "192.0.2.99:1"
+			return r
+		}},
+		{"query:shard", func(v string) *http.Request {
+			return httptest.NewRequest("GET", "/a?shard="+v, nil)
+		}, func(v string) *http.Request {
+			return httptest.NewRequest("GET", "/b?x=1&shard="+v, nil)
+		}},
+		{"path", func(v string) *http.Request {
+			return httptest.NewRequest("GET", "/objects/"+v, nil)
+		}, func(v string) *http.Request {
+			r := httptest.NewRequest("GET", "/objects/"+v+"?v=2", nil)
+			r.RemoteAddr = "192.0.2.99:1"
+			return r
+		}},
+	} {
+		t.Run(tc.key, func(t *testing.T) {
+			lb, _ := newHashLB(t, "maglev", config.HashConfig{Key: tc.key}, 1, 1, 1, 1)
+			spread := map[*Backend]bool{}
+			for i := 0; i < 50; i++ {
+				v := fmt.Sprint("v", i)
+				a, _ := lb.Next(tc.req(v))
+				b, _ := lb.Next(tc.same(v))
+				if a != b {
+					t.Fatalf("key %q: requests with the same value went to different backends", v)
+				}
+				spread[a] = true
+			}
+			if len(spread) < 3 {
+				t.Fatalf("expected keys to spread across backends, got %d", len(spread))
+			}
+		})
+	}
+}
+
+func TestConsistentHash_MissingKeyFallsBackToIP(t *testing.T) {
+	lb, _ := newHashLB(t, "ring_hash", config.HashConfig{Key: "header:X-User-ID"}, 1, 1, 1)
+	first, _ := lb.Next(httptest.NewRequest("GET", "/", nil))
+	for i := 0; i < 20; i++ {
+		if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != first {
+			t.Fatal("requests from one client without the header should stick together")
+		}
+	}
+}
+
+func TestConsistentHash_BadConfig(t *testing.T) {
+	for _, cfg := range []config.HashConfig{
+		{Key: "header:"},
+		{Key: "claim:sub"},
+		{Key: "method"},
+		{VirtualNodes: -1},
+		{TableSize: 65536},
+	} {
+		if _, err := NewWithOptions("maglev", nil, Options{Hash: &cfg}); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestConsistentHash_NoBackends(t *testing.T) {
+	for _, algorithm := range []string{"ring_hash", "maglev"} {
+		lb, bs := newHashLB(t, algorithm, config.HashConfig{}, 1)
+		bs[0].SetAlive(false)
+		if _, err := lb.Next(httptest.NewRequest("GET", "/", nil)); err != ErrNoHealthyBackend {
+			t.Errorf("%s: expected ErrNoHealthyBackend, got %v", algorithm, err)
+		}
+	}
+}
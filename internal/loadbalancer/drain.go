@@ -0,0 +1,73 @@
+package loadbalancer
+
+import "fmt"
+
+// ---------------------------------------------------------------------------
+// Draining and maintenance
+//
+// Operators take a backend out of rotation by setting its admin state. A
+// draining backend gets no new requests but finishes those in flight, and
+// becomes drained once the last one completes. A backend in maintenance gets
+// no requests and is not health checked. Both are independent of health and
+// outlier ejection, and every Balancer honours them through Routable.
+// ---------------------------------------------------------------------------
+
+// AdminState is a backend's operator-set state.
+type AdminState int32
+
+const (
+	StateActive      AdminState = iota // in rotation
+	StateDraining                      // no new requests; in-flight ones finish
+	StateDrained                       // draining with nothing left in flight
+	StateMaintenance                   // no requests, no health checks
+)
+
+func (s AdminState) String() string {
+	switch s {
+	case StateDraining:
+		return "draining"
+	case StateDrained:
+		return "drained"
+	case StateMaintenance:
+		return "maintenance"
+	default:
+		return "active"
+	}
+}
+
+// ParseAdminState parses a state an operator may set: active, draining or
+// maintenance. Drained is only ever reached by draining.
+func ParseAdminState(s string) (AdminState, error) {
+	switch s {
+	case "active":
+		return StateActive, nil
+	case "draining":
+		return StateDraining, nil
+	case "maintenance":
+		return StateMaintenance, nil
+	}
+	return 0, fmt.Errorf("admin state %q: expected active, draining or maintenance", s)
+}
+
+// AdminState returns the backend's operator-set state.
+func (b *Backend) AdminState() AdminState { return AdminState(b.state.Load()) }
+
+// SetAdminState changes the backend's operator-set state and returns the
+// resulting one: draining a backend with nothing in flight leaves it drained
+// straight away, and draining one that is already drained keeps it so.
+func (b *Backend) SetAdminState(s AdminState) AdminState {
+	if s == StateDraining && b.AdminState() == StateDrained {
+		return StateDrained
+	}
+	b.state.Store(int32(s))
+	if s == StateDraining && b.inflight.Load() == 0 {
+		b.state.CompareAndSwap(int32(StateDraining), int32(StateDrained))
+	}
+	return b.AdminState()
+}
+
+// inRotation reports whether the operator wants the backend to get traffic:
+// it is active and its weight is not 0.
+func (b *Backend) inRotation() bool {
+	return b.Weight() > 0 && b.AdminState() == StateActive
+}
@@ -0,0 +1,67 @@
+package loadbalancer
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminState_ExcludedByEveryAlgorithm(t *testing.T) {
+	for _, alg := range allAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			lb := New(alg, weightedCfgs(1, 1, 1))
+			bs := lb.Backends()
+			bs[0].SetAdminState(StateDraining)
+			bs[1].SetAdminState(StateMaintenance)
+
+			if got := distribution(t, lb, 300); got["http://b2"] != 300 {
+				t.Fatalf("draining or maintenance backend picked: %v", got)
+			}
+			bs[2].SetAdminState(StateMaintenance)
+			if _, err := lb.Next(httptest.NewRequest("GET", "/", nil)); err != ErrNoHealthyBackend {
+				t.Fatalf("err = %v, want ErrNoHealthyBackend", err)
+			}
+		})
+	}
+}
+
+func TestAdminState_DrainCompletes(t *testing.T) {
+	b := New("round_robin", weightedCfgs(1)).Backends()[0]
+	b.Inc()
+	b.Inc()
+
+	if got := b.SetAdminState(StateDraining); got != StateDraining {
+		t.Fatalf("state with requests in flight = %v, want draining", got)
+	}
+	if b.Dec() {
+		t.Fatal("drained with a request still in flight")
+	}
+	if !b.Dec() || b.AdminState() != StateDrained {
+		t.Fatalf("last request did not finish the drain: %v", b.AdminState())
+	}
+	if got := b.SetAdminState(StateDraining); got != StateDrained {
+		t.Fatalf("draining again = %v, want drained", got)
+	}
+
+	b.SetAdminState(StateActive)
+	b.Inc()
+	if b.Dec() || !b.Routable() {
+		t.Fatal("active backend reported as drained")
+	}
+	if got := b.SetAdminState(StateDraining); got != StateDrained {
+		t.Fatalf("draining an idle backend = %v, want drained", got)
+	}
+}
+
+func TestParseAdminState(t *testing.T) {
+	for _, s := range []string{"active", "draining", "maintenance"} {
+		st, err := ParseAdminState(s)
+		if err != nil || st.String() != s {
+			t.Errorf("ParseAdminState(%q) = %v, %v", s, st, err)
+		}
+	}
+	for _, s := range []string{"drained", "", "Active"} {
+		if _, err := ParseAdminState(s); err == nil {
+			t.Errorf("ParseAdminState(%q) accepted", s)
+		}
+	}
+}
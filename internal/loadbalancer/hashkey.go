@@ -0,0 +1,78 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sneha4175/gateway-pro/internal/clientip"
+)
+
+// ---------------------------------------------------------------------------
+// Hash keys for ring_hash and maglev
+//
+// hash.key selects the request attribute that picks a backend:
+//
+//	ip             client IP (trusted-proxy aware); the default
+//	header:<name>  a request header
+//	cookie:<name>  a cookie value
+//	query:<name>   a query parameter
+//	path           the request path
+//
+// Requests that lack the attribute are hashed by client IP instead.
+// ---------------------------------------------------------------------------
+
+type hashKeyFunc func(r *http.Request) string
+
+func parseHashKey(expr string) (hashKeyFunc, error) {
+	ip := func(r *http.Request) string { return clientip.FromRequest(r) }
+	orIP := func(get func(r *http.Request) string) hashKeyFunc {
+		return func(r *http.Request) string {
+			if v := get(r); v != "" {
+				return v
+			}
+			return ip(r)
+		}
+	}
+
+	kind, arg, hasArg := strings.Cut(expr, ":")
+	switch {
+	case expr == "" || expr == "ip":
+		return ip, nil
+	case expr == "path":
+		return func(r *http.Request) string { return r.URL.Path }, nil
+	case !hasArg || arg == "":
+		return nil, fmt.Errorf("hash.key %q: expected ip, path, header:<name>, cookie:<name> or query:<name>", expr)
+	}
+	switch kind {
+	case "header":
+		name := http.CanonicalHeaderKey(arg)
+		return orIP(func(r *http.Request) string { return r.Header.Get(name) }), nil
+	case "cookie":
+		return orIP(func(r *http.Request) string {
+			if c, err := r.Cookie(arg); err == nil {
+				return c.Value
+			}
+			return ""
+		}), nil
+	case "query":
+		return orIP(func(r *http.Request) string { return r.URL.Query().Get(arg) }), nil
+	}
+	return nil, fmt.Errorf("hash.key %q: unknown source %q", expr, kind)
+}
+
+// hash64 is FNV-1a followed by a 64-bit finalizer, so that similar inputs
+// ("url#1", "url#2") land far apart on the ring.
+func hash64(s string) uint64 {
+	var h uint64 = 14695981039346656037
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -4,11 +4,15 @@ package loadbalancer
 
 import (
 	"errors"
+	"math/rand/v2"
 	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/sneha4175/gateway-pro/internal/clientip"
 	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
 )
 
 // ErrNoHealthyBackend is returned when every backend is unhealthy.
@@ -16,53 +20,255 @@ var ErrNoHealthyBackend = errors.New("no healthy backend available")
 
 // Backend represents a single upstream server.
 type Backend struct {
-	URL    string
-	Weight int
+	URL string
+
+	// labels are the locality labels from the config; they change with
+	// Balancer.Update.
+	labels atomic.Pointer[labels]
+
+	// weight is the configured weight (see Balancer.Update) and override
+	// an operator's runtime weight plus one, or 0 if unset; the override
+	// wins and survives updates. A weight of 0 drains the backend of new
+	// requests.
+	weight   atomic.Int64
+	override atomic.Int64
 
 	// alive is written by the health-checker and read by the LB; use atomic.
 	alive atomic.Bool
 
+	// ejected is set by outlier detection, independently of alive, so an
+	// active health check passing cannot cut an ejection short.
+	ejected atomic.Bool
+
 	// inflight tracks active connections for least_conn
 	inflight atomic.Int64
+
+	// state is the AdminState set by operators
+	state atomic.Int32
+
+	// since is when the backend last became available (UnixNano), for slow
+	// start; 0 means it has been serving since the balancer was built.
+	since atomic.Int64
+
+	// latency is the response-time average used by peak_ewma
+	latency peakEWMA
+}
+
+type labels struct {
+	zone, region string
+	priority     int
+}
+
+func newBackend(c config.BackendConfig) *Backend {
+	b := &Backend{URL: c.URL}
+	b.configure(c)
+	b.alive.Store(true)
+	return b
 }
 
-func (b *Backend) IsAlive() bool       { return b.alive.Load() }
-func (b *Backend) SetAlive(v bool)     { b.alive.Store(v) }
-func (b *Backend) Inflight() int64     { return b.inflight.Load() }
-func (b *Backend) Inc()                { b.inflight.Add(1) }
-func (b *Backend) Dec()                { b.inflight.Add(-1) }
+// configure applies c's weight and locality labels.
+func (b *Backend) configure(c config.BackendConfig) {
+	b.weight.Store(int64(c.Weight))
+	b.labels.Store(&labels{zone: c.Zone, region: c.Region, priority: c.Priority})
+}
+
+// Zone, Region and Priority return the backend's locality labels.
+func (b *Backend) Zone() string   { return b.locality().zone }
+func (b *Backend) Region() string { return b.locality().region }
+func (b *Backend) Priority() int  { return b.locality().priority }
+
+func (b *Backend) locality() labels {
+	if l := b.labels.Load(); l != nil {
+		return *l
+	}
+	return labels{}
+}
+
+// Weight returns the weight in effect: the operator's override if one is
+// set, else the configured weight.
+func (b *Backend) Weight() int {
+	if o := b.override.Load(); o > 0 {
+		return int(o - 1)
+	}
+	return int(b.weight.Load())
+}
+
+// SetWeightOverride sets a runtime weight that takes precedence over the
+// configured one until cleared with a negative w. Balancer.Update keeps it.
+func (b *Backend) SetWeightOverride(w int) { b.override.Store(int64(max(w, -1)) + 1) }
+
+// WeightOverride returns the runtime weight, if one is set.
+func (b *Backend) WeightOverride() (int, bool) {
+	o := b.override.Load()
+	return int(o - 1), o > 0
+}
+
+func (b *Backend) IsAlive() bool   { return b.alive.Load() }
+func (b *Backend) IsEjected() bool { return b.ejected.Load() }
+func (b *Backend) Inflight() int64 { return b.inflight.Load() }
+func (b *Backend) Inc()            { b.inflight.Add(1) }
+
+// Dec records the end of a request and reports whether it was the last one
+// a draining backend was waiting for.
+func (b *Backend) Dec() (drained bool) {
+	return b.inflight.Add(-1) == 0 && b.state.CompareAndSwap(int32(StateDraining), int32(StateDrained))
+}
+
+// SetAlive records the health check verdict. A backend that comes back
+// starts its slow-start window.
+func (b *Backend) SetAlive(v bool) {
+	if !b.alive.Swap(v) && v {
+		b.SetAvailableSince(time.Now())
+	}
+}
+
+// SetEjected records an outlier ejection. A backend returning from one
+// starts its slow-start window.
+func (b *Backend) SetEjected(v bool) {
+	if b.ejected.Swap(v) && !v {
+		b.SetAvailableSince(time.Now())
+	}
+}
+
+// Available reports whether the backend may receive traffic: it passes
+// health checks and is not ejected as an outlier.
+func (b *Backend) Available() bool { return b.alive.Load() && !b.ejected.Load() }
+
+// Routable reports whether balancers may send new requests to the backend:
+// it is available, its weight has not been set to 0 and it is not draining
+// or in maintenance.
+func (b *Backend) Routable() bool { return b.Available() && b.inRotation() }
+
+// Config returns the backend's configured settings, without any weight
+// override, e.g. to pass a modified copy to Balancer.Update.
+func (b *Backend) Config() config.BackendConfig {
+	l := b.locality()
+	return config.BackendConfig{URL: b.URL, Weight: int(b.weight.Load()), Zone: l.zone, Region: l.region, Priority: l.priority}
+}
+
+// AvailableSince returns when the backend last became available, or the
+// zero time if it has been available since the balancer was built.
+func (b *Backend) AvailableSince() time.Time {
+	if n := b.since.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// SetAvailableSince restarts the backend's slow-start window at t, e.g. when
+// a reload adds it to an existing route. The zero time ends the window.
+func (b *Backend) SetAvailableSince(t time.Time) {
+	if t.IsZero() {
+		b.since.Store(0)
+		return
+	}
+	b.since.Store(t.UnixNano())
+}
 
 // Balancer selects the next backend for a given request.
 type Balancer interface {
 	Next(r *http.Request) (*Backend, error)
 	Backends() []*Backend
+
+	// Update applies a new backend list. Backends whose URL is already known
+	// keep their state (health, in-flight requests, balancing position,
+	// admin state and weight override) and take the new weight and labels.
 	Update(cfgs []config.BackendConfig)
 }
 
+// updater is implemented by the balancers of every algorithm. update is
+// Update, except that backends new to the balancer but found in from are
+// taken over with their state rather than created: a backend moving between
+// locality tiers stays the same *Backend.
+type updater interface {
+	update(cfgs []config.BackendConfig, from map[string]*Backend)
+}
+
 // ---------------------------------------------------------------------------
 // Factory
 // ---------------------------------------------------------------------------
 
+// Options tunes a Balancer beyond its algorithm. The zero value disables
+// every option.
+type Options struct {
+	// Ramp traffic up to recovered and newly added backends
+	SlowStart *config.SlowStartConfig
+
+	// Hash key and table tuning for ring_hash and maglev
+	Hash *config.HashConfig
+
+	// Prefer backends near the gateway (Zone, Region) and fail over between
+	// priorities; the algorithm runs separately within each tier
+	Locality     *config.LocalityConfig
+	Zone, Region string
+
+	// Percentage of available backends below which health is ignored;
+	// 0 disables panic mode
+	PanicThreshold int
+
+	// Route label and logger for panic mode
+	Route string
+	Log   *zap.SugaredLogger
+}
+
+// New builds a balancer for algorithm with default options.
 func New(algorithm string, cfgs []config.BackendConfig) Balancer {
+	lb, _ := NewWithOptions(algorithm, cfgs, Options{}) // cannot fail without options
+	return lb
+}
+
+// NewWithOptions builds a balancer for algorithm, validating opts.
+func NewWithOptions(algorithm string, cfgs []config.BackendConfig, opts Options) (Balancer, error) {
+	if opts.PanicThreshold != 0 {
+		inner := opts
+		inner.PanicThreshold = 0
+		lb, err := NewWithOptions(algorithm, cfgs, inner)
+		if err != nil {
+			return nil, err
+		}
+		return newPanicGuard(lb, opts.PanicThreshold, opts.Route, opts.Log)
+	}
+	ss, err := newSlowStart(opts.SlowStart)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Locality != nil {
+		perTier := opts
+		perTier.Locality = nil
+		return newLocality(cfgs, opts, func(cfgs []config.BackendConfig) (Balancer, error) {
+			return NewWithOptions(algorithm, cfgs, perTier)
+		})
+	}
 	backends := buildBackends(cfgs)
 	switch algorithm {
+	case "ring_hash", "maglev":
+		o, err := newHashOptions(opts.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if algorithm == "maglev" {
+			return newMaglev(backends, o, ss), nil
+		}
+		return newRingHash(backends, o, ss), nil
 	case "least_conn":
-		return &leastConn{backends: backends}
+		return &leastConn{backends: backends, ss: ss}, nil
+	case "p2c":
+		return &p2c{backends: backends, cost: inflightCost, ss: ss}, nil
+	case "peak_ewma":
+		return &p2c{backends: backends, cost: ewmaCost, ss: ss}, nil
 	case "weighted":
-		return newWeighted(backends)
+		return newWeighted(backends, ss), nil
 	case "ip_hash":
-		return &ipHash{backends: backends}
+		return &ipHash{backends: backends, ss: ss}, nil
 	default: // round_robin
-		return &roundRobin{backends: backends}
+		return &roundRobin{backends: backends, ss: ss}, nil
 	}
 }
 
 func buildBackends(cfgs []config.BackendConfig) []*Backend {
 	bs := make([]*Backend, len(cfgs))
 	for i, c := range cfgs {
-		b := &Backend{URL: c.URL, Weight: c.Weight}
-		b.alive.Store(true)
-		bs[i] = b
+		bs[i] = newBackend(c)
 	}
 	return bs
 }
@@ -75,6 +281,7 @@ type roundRobin struct {
 	mu       sync.RWMutex
 	backends []*Backend
 	counter  atomic.Uint64
+	ss       *slowStart
 }
 
 func (rr *roundRobin) Next(_ *http.Request) (*Backend, error) {
@@ -87,7 +294,7 @@ func (rr *roundRobin) Next(_ *http.Request) (*Backend, error) {
 		return nil, ErrNoHealthyBackend
 	}
 	idx := rr.counter.Add(1) - 1
-	return alive[idx%uint64(len(alive))], nil
+	return rr.ss.pick(alive, int(idx%uint64(len(alive))), randomRoll), nil
 }
 
 func (rr *roundRobin) Backends() []*Backend {
@@ -96,10 +303,12 @@ func (rr *roundRobin) Backends() []*Backend {
 	return rr.backends
 }
 
-func (rr *roundRobin) Update(cfgs []config.BackendConfig) {
+func (rr *roundRobin) Update(cfgs []config.BackendConfig) { rr.update(cfgs, nil) }
+
+func (rr *roundRobin) update(cfgs []config.BackendConfig, from map[string]*Backend) {
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
-	rr.backends = mergeBackends(rr.backends, cfgs)
+	rr.backends = mergeBackends(rr.backends, cfgs, from)
 }
 
 // ---------------------------------------------------------------------------
@@ -109,6 +318,7 @@ func (rr *roundRobin) Update(cfgs []config.BackendConfig) {
 type leastConn struct {
 	mu       sync.RWMutex
 	backends []*Backend
+	ss       *slowStart
 }
 
 func (lc *leastConn) Next(_ *http.Request) (*Backend, error) {
@@ -120,10 +330,24 @@ func (lc *leastConn) Next(_ *http.Request) (*Backend, error) {
 	if len(alive) == 0 {
 		return nil, ErrNoHealthyBackend
 	}
-	best := alive[0]
-	for _, b := range alive[1:] {
-		if b.Inflight() < best.Inflight() {
-			best = b
+	if lc.ss == nil {
+		best := alive[0]
+		for _, b := range alive[1:] {
+			if b.Inflight() < best.Inflight() {
+				best = b
+			}
+		}
+		return best, nil
+	}
+
+	// Warming backends look proportionally busier
+	now := lc.ss.now()
+	var best *Backend
+	bestLoad := 0.0
+	for _, b := range alive {
+		load := float64(b.Inflight()+1) / lc.ss.factor(b, now)
+		if best == nil || load < bestLoad {
+			best, bestLoad = b, load
 		}
 	}
 	return best, nil
@@ -135,10 +359,12 @@ func (lc *leastConn) Backends() []*Backend {
 	return lc.backends
 }
 
-func (lc *leastConn) Update(cfgs []config.BackendConfig) {
+func (lc *leastConn) Update(cfgs []config.BackendConfig) { lc.update(cfgs, nil) }
+
+func (lc *leastConn) update(cfgs []config.BackendConfig, from map[string]*Backend) {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
-	lc.backends = mergeBackends(lc.backends, cfgs)
+	lc.backends = mergeBackends(lc.backends, cfgs, from)
 }
 
 // ---------------------------------------------------------------------------
@@ -148,33 +374,39 @@ func (lc *leastConn) Update(cfgs []config.BackendConfig) {
 type weighted struct {
 	mu       sync.Mutex
 	backends []*wBackend
+	ss       *slowStart
 }
 
 type wBackend struct {
 	*Backend
-	current int
+	current float64
 }
 
-func newWeighted(bs []*Backend) *weighted {
+func newWeighted(bs []*Backend, ss *slowStart) *weighted {
 	wb := make([]*wBackend, len(bs))
 	for i, b := range bs {
 		wb[i] = &wBackend{Backend: b}
 	}
-	return &weighted{backends: wb}
+	return &weighted{backends: wb, ss: ss}
 }
 
 func (w *weighted) Next(_ *http.Request) (*Backend, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	total := 0
+	var now time.Time
+	if w.ss != nil {
+		now = w.ss.now()
+	}
+	total := 0.0
 	var best *wBackend
 	for _, b := range w.backends {
-		if !b.IsAlive() {
+		if !b.Routable() {
 			continue
 		}
-		b.current += b.Weight
-		total += b.Weight
+		weight := float64(b.Weight()) * w.ss.factor(b.Backend, now)
+		b.current += weight
+		total += weight
 		if best == nil || b.current > best.current {
 			best = b
 		}
@@ -196,13 +428,25 @@ func (w *weighted) Backends() []*Backend {
 	return out
 }
 
-func (w *weighted) Update(cfgs []config.BackendConfig) {
+func (w *weighted) Update(cfgs []config.BackendConfig) { w.update(cfgs, nil) }
+
+func (w *weighted) update(cfgs []config.BackendConfig, from map[string]*Backend) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	merged := mergeBackends(backendSlice(w.backends), cfgs)
+	// Keep each surviving backend's current weight so an update does not
+	// restart the smooth sequence and burst traffic at the heaviest backend
+	prev := make(map[*Backend]*wBackend, len(w.backends))
+	for _, b := range w.backends {
+		prev[b.Backend] = b
+	}
+	merged := mergeBackends(backendSlice(w.backends), cfgs, from)
 	wb := make([]*wBackend, len(merged))
 	for i, b := range merged {
-		wb[i] = &wBackend{Backend: b}
+		if old, ok := prev[b]; ok {
+			wb[i] = old
+		} else {
+			wb[i] = &wBackend{Backend: b}
+		}
 	}
 	w.backends = wb
 }
@@ -214,6 +458,7 @@ func (w *weighted) Update(cfgs []config.BackendConfig) {
 type ipHash struct {
 	mu       sync.RWMutex
 	backends []*Backend
+	ss       *slowStart
 }
 
 func (ih *ipHash) Next(r *http.Request) (*Backend, error) {
@@ -225,9 +470,8 @@ func (ih *ipHash) Next(r *http.Request) (*Backend, error) {
 	if len(alive) == 0 {
 		return nil, ErrNoHealthyBackend
 	}
-	ip := clientIP(r)
-	h := fnv1a(ip)
-	return alive[h%uint32(len(alive))], nil
+	h := fnv1a(clientip.FromRequest(r))
+	return ih.ss.pick(alive, int(h%uint32(len(alive))), hashRoll(h)), nil
 }
 
 func (ih *ipHash) Backends() []*Backend {
@@ -236,20 +480,23 @@ func (ih *ipHash) Backends() []*Backend {
 	return ih.backends
 }
 
-func (ih *ipHash) Update(cfgs []config.BackendConfig) {
+func (ih *ipHash) Update(cfgs []config.BackendConfig) { ih.update(cfgs, nil) }
+
+func (ih *ipHash) update(cfgs []config.BackendConfig, from map[string]*Backend) {
 	ih.mu.Lock()
 	defer ih.mu.Unlock()
-	ih.backends = mergeBackends(ih.backends, cfgs)
+	ih.backends = mergeBackends(ih.backends, cfgs, from)
 }
 
 // ---------------------------------------------------------------------------
 // Helpers
 // ---------------------------------------------------------------------------
 
+// healthy returns the routable backends of bs.
 func healthy(bs []*Backend) []*Backend {
 	out := bs[:0:0]
 	for _, b := range bs {
-		if b.IsAlive() {
+		if b.Routable() {
 			out = append(out, b)
 		}
 	}
@@ -257,26 +504,33 @@ func healthy(bs []*Backend) []*Backend {
 }
 
 // mergeBackends preserves existing backend objects (keeping their atomic state)
-// and only adds/removes entries that changed in the new config.
-func mergeBackends(existing []*Backend, cfgs []config.BackendConfig) []*Backend {
+// and only adds/removes entries that changed in the new config. Backends
+// missing from existing are taken from from, if there, before being created.
+func mergeBackends(existing []*Backend, cfgs []config.BackendConfig, from map[string]*Backend) []*Backend {
 	byURL := make(map[string]*Backend, len(existing))
 	for _, b := range existing {
 		byURL[b.URL] = b
 	}
 	result := make([]*Backend, 0, len(cfgs))
 	for _, c := range cfgs {
-		if b, ok := byURL[c.URL]; ok {
-			b.Weight = c.Weight
+		b, ok := byURL[c.URL]
+		if !ok {
+			b, ok = from[c.URL]
+		}
+		if ok {
+			b.configure(c)
 			result = append(result, b)
 		} else {
-			nb := &Backend{URL: c.URL, Weight: c.Weight}
-			nb.alive.Store(true)
+			nb := newBackend(c)
+			nb.SetAvailableSince(time.Now())
 			result = append(result, nb)
 		}
 	}
 	return result
 }
 
+func randomRoll(int) float64 { return rand.Float64() }
+
 func backendSlice(wb []*wBackend) []*Backend {
 	out := make([]*Backend, len(wb))
 	for i, b := range wb {
@@ -285,16 +539,6 @@ func backendSlice(wb []*wBackend) []*Backend {
 	return out
 }
 
-func clientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
-	}
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-	return r.RemoteAddr
-}
-
 // Simple FNV-1a 32-bit hash — no allocations, no imports.
 func fnv1a(s string) uint32 {
 	var h uint32 = 2166136261
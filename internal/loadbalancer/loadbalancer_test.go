@@ -0,0 +1,154 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+var allAlgorithms = []string{"round_robin", "least_conn", "weighted", "ip_hash", "ring_hash", "maglev", "p2c", "peak_ewma"}
+
+func weightedCfgs(weights ...int) []config.BackendConfig {
+	cfgs := make([]config.BackendConfig, len(weights))
+	for i, w := range weights {
+		cfgs[i] = config.BackendConfig{URL: fmt.Sprintf("http://b%d", i), Weight: w}
+	}
+	return cfgs
+}
+
+// distribution counts picks per URL, varying the client IP so hashing
+// algorithms spread requests too, and keeping every pick in flight until
+// the end so load-aware algorithms do too.
+func distribution(t *testing.T, lb Balancer, n int) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	var picked []*Backend
+	defer func() {
+		for _, b := range picked {
+			b.Dec()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+		b, err := lb.Next(r)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		b.Inc()
+		picked = append(picked, b)
+		counts[b.URL]++
+	}
+	return counts
+}
+
+func TestWeighted_UpdateKeepsSequence(t *testing.T) {
+	cfgs := weightedCfgs(5, 1, 1)
+	lb := New("weighted", cfgs)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// Smooth weighted round-robin serves exactly 5:1:1 over every 7 picks,
+	// and an Update that changes nothing must not restart the sequence
+	counts := map[string]int{}
+	for i := 0; i < 7; i++ {
+		if i == 3 {
+			lb.Update(cfgs)
+		}
+		b, _ := lb.Next(r)
+		counts[b.URL]++
+	}
+	if counts["http://b0"] != 5 || counts["http://b1"] != 1 || counts["http://b2"] != 1 {
+		t.Fatalf("picks across an update = %v, want 5:1:1", counts)
+	}
+}
+
+func TestUpdate_KeepsBackendState(t *testing.T) {
+	for _, alg := range allAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			lb := New(alg, weightedCfgs(1, 1))
+			before := lb.Backends()
+			before[0].SetAlive(false)
+			before[1].Inc()
+
+			lb.Update(weightedCfgs(1, 1, 1))
+			after := lb.Backends()
+			if len(after) != 3 || after[0] != before[0] || after[1] != before[1] {
+				t.Fatalf("existing backends replaced: %v -> %v", before, after)
+			}
+			if after[0].IsAlive() || after[1].Inflight() != 1 {
+				t.Fatal("update lost health or in-flight state")
+			}
+		})
+	}
+}
+
+func TestUpdate_WeightChanges(t *testing.T) {
+	for _, alg := range allAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			lb := New(alg, weightedCfgs(1, 1, 1))
+			distribution(t, lb, 30)
+
+			// Draining to 0 stops new picks at once
+			lb.Update(weightedCfgs(1, 0, 1))
+			if got := distribution(t, lb, 300); got["http://b1"] != 0 {
+				t.Fatalf("drained backend picked: %v", got)
+			}
+			if w := lb.Backends()[1].Weight(); w != 0 {
+				t.Fatalf("Weight() = %d, want 0", w)
+			}
+
+			lb.Update(weightedCfgs(1, 1, 1))
+			if got := distribution(t, lb, 300); got["http://b1"] == 0 {
+				t.Fatalf("restored backend never picked: %v", got)
+			}
+
+			lb.Update(weightedCfgs(0, 0, 0))
+			if _, err := lb.Next(httptest.NewRequest("GET", "/", nil)); err != ErrNoHealthyBackend {
+				t.Fatalf("all drained: err = %v, want ErrNoHealthyBackend", err)
+			}
+		})
+	}
+}
+
+func TestUpdate_KeepsWeightOverride(t *testing.T) {
+	for _, alg := range allAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			lb := New(alg, weightedCfgs(1, 1, 1))
+			drained := lb.Backends()[1]
+			drained.SetWeightOverride(0)
+
+			cfgs := weightedCfgs(1, 5, 1)
+			cfgs[1].Zone, cfgs[1].Priority = "eu-1b", 2
+			lb.Update(cfgs)
+			if got := distribution(t, lb, 300); got["http://b1"] != 0 {
+				t.Fatalf("update undid the operator's weight 0: %v", got)
+			}
+			if c := drained.Config(); c.Weight != 5 || drained.Zone() != "eu-1b" || drained.Priority() != 2 {
+				t.Fatalf("update not applied under the override: %+v", c)
+			}
+
+			drained.SetWeightOverride(-1)
+			if w := drained.Weight(); w != 5 {
+				t.Fatalf("Weight() = %d after clearing the override, want the configured 5", w)
+			}
+		})
+	}
+}
+
+func TestUpdate_WeightedDistribution(t *testing.T) {
+	for _, alg := range []string{"weighted", "ring_hash", "maglev"} {
+		t.Run(alg, func(t *testing.T) {
+			lb := New(alg, weightedCfgs(1, 1))
+			distribution(t, lb, 100)
+			lb.Update(weightedCfgs(3, 1))
+
+			got := distribution(t, lb, 4000)
+			share := float64(got["http://b0"]) / 4000
+			if share < 0.65 || share > 0.85 {
+				t.Fatalf("weight 3:1 after update gave b0 %.2f of traffic (%v), want ~0.75", share, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// ---------------------------------------------------------------------------
+// Locality and priority
+//
+// Backends are grouped into tiers ordered by priority (0 first) and, within a
+// priority, by distance from the gateway: its own zone, other zones of its
+// region, then everything else. Each tier runs its own instance of the
+// route's algorithm. Traffic is first split between priorities, then within
+// a priority between its locality tiers, each group taking
+//
+//	share = min(remaining, healthy_fraction / failover_threshold)
+//
+// so a group at or above the threshold takes everything left, and one below
+// it keeps part and spills the rest to the next. Lower priorities (e.g. a DR
+// region) therefore only see traffic once every priority above them has
+// fallen below the threshold. If all groups are degraded, shares are scaled
+// up to cover all traffic.
+// ---------------------------------------------------------------------------
+
+const defaultFailoverThreshold = 70
+
+// Distance of a backend's zone from the gateway's.
+const (
+	localZone = iota
+	localRegion
+	remote
+)
+
+type tierKey struct {
+	priority int
+	distance int
+}
+
+type tier struct {
+	key tierKey
+	lb  Balancer
+}
+
+type locality struct {
+	mu        sync.RWMutex
+	tiers     []*tier // ordered
+	build     func(cfgs []config.BackendConfig) (Balancer, error)
+	zoneAware bool
+	zone      string
+	region    string
+	threshold float64 // fraction
+}
+
+func newLocality(cfgs []config.BackendConfig, opts Options, build func([]config.BackendConfig) (Balancer, error)) (*locality, error) {
+	l := &locality{
+		build:     build,
+		zoneAware: opts.Locality.ZoneAware,
+		zone:      opts.Zone,
+		region:    opts.Region,
+		threshold: defaultFailoverThreshold / 100.0,
+	}
+	if t := opts.Locality.FailoverThreshold; t != 0 {
+		if t < 0 || t > 100 {
+			return nil, fmt.Errorf("locality.failover_threshold %d: must be between 1 and 100", t)
+		}
+		l.threshold = float64(t) / 100
+	}
+	tiers, err := l.group(cfgs, nil)
+	if err != nil {
+		return nil, err
+	}
+	l.tiers = tiers
+	return l, nil
+}
+
+func (l *locality) distance(c config.BackendConfig) int {
+	switch {
+	case !l.zoneAware:
+		return localZone
+	case l.zone != "" && c.Zone == l.zone:
+		return localZone
+	case l.region != "" && c.Region == l.region:
+		return localRegion
+	default:
+		return remote
+	}
+}
+
+// group splits cfgs into ordered tiers, reusing the balancers (and so the
+// backend state) of existing tiers. A backend whose labels move it to
+// another tier keeps its *Backend.
+func (l *locality) group(cfgs []config.BackendConfig, existing []*tier) ([]*tier, error) {
+	byKey := map[tierKey][]config.BackendConfig{}
+	for _, c := range cfgs {
+		k := tierKey{c.Priority, l.distance(c)}
+		byKey[k] = append(byKey[k], c)
+	}
+	old := map[tierKey]Balancer{}
+	known := map[string]*Backend{}
+	for _, t := range existing {
+		old[t.key] = t.lb
+		for _, b := range t.lb.Backends() {
+			known[b.URL] = b
+		}
+	}
+
+	tiers := make([]*tier, 0, len(byKey))
+	for k, group := range byKey {
+		lb, ok := old[k]
+		var err error
+		switch {
+		case ok:
+			lb.(updater).update(group, known)
+		case existing == nil: // first build
+			lb, err = l.build(group)
+		default:
+			// A new tier starts empty, so its backends are taken over or
+			// added, as by any update
+			if lb, err = l.build(nil); err == nil {
+				lb.(updater).update(group, known)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, &tier{key: k, lb: lb})
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		a, b := tiers[i].key, tiers[j].key
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		return a.distance < b.distance
+	})
+	return tiers, nil
+}
+
+// shares returns each tier's share of traffic: priorities split traffic by
+// their overall health, then each priority's share is split between its
+// locality tiers the same way.
+func (l *locality) shares(tiers []*tier) []float64 {
+	healthy := make([]float64, len(tiers))
+	all := make([]float64, len(tiers))
+	for i, t := range tiers {
+		for _, b := range t.lb.Backends() {
+			if !b.inRotation() {
+				continue // drained backends are not lost capacity
+			}
+			w := float64(b.Weight())
+			all[i] += w
+			if b.Available() {
+				healthy[i] += w
+			}
+		}
+	}
+
+	// Tiers are sorted by priority, so each priority is a contiguous run
+	var prioHealth []float64
+	var runs [][2]int
+	for i := 0; i < len(tiers); {
+		j := i
+		var h, a float64
+		for ; j < len(tiers) && tiers[j].key.priority == tiers[i].key.priority; j++ {
+			h += healthy[j]
+			a += all[j]
+		}
+		prioHealth = append(prioHealth, fraction(h, a))
+		runs = append(runs, [2]int{i, j})
+		i = j
+	}
+
+	out := make([]float64, len(tiers))
+	for p, share := range l.spill(prioHealth) {
+		lo, hi := runs[p][0], runs[p][1]
+		local := make([]float64, hi-lo)
+		for i := range local {
+			local[i] = fraction(healthy[lo+i], all[lo+i])
+		}
+		for i, s := range l.spill(local) {
+			out[lo+i] = share * s
+		}
+	}
+	return out
+}
+
+// spill turns the healthy fractions of ordered groups into traffic shares:
+// each takes min(remaining, health/threshold), and the shares are scaled up
+// to 1 if every group is degraded.
+func (l *locality) spill(health []float64) []float64 {
+	out := make([]float64, len(health))
+	remaining, total := 1.0, 0.0
+	for i, h := range health {
+		if remaining <= 0 {
+			break
+		}
+		out[i] = min(remaining, h/l.threshold)
+		remaining -= out[i]
+		total += out[i]
+	}
+	if total > 0 && total < 1 {
+		for i := range out {
+			out[i] /= total
+		}
+	}
+	return out
+}
+
+func fraction(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole
+}
+
+func (l *locality) Next(r *http.Request) (*Backend, error) {
+	l.mu.RLock()
+	tiers := l.tiers
+	l.mu.RUnlock()
+
+	shares := l.shares(tiers)
+	x := rand.Float64()
+	for i, t := range tiers {
+		if shares[i] == 0 {
+			continue
+		}
+		if x -= shares[i]; x < 0 {
+			if b, err := t.lb.Next(r); err == nil {
+				return b, nil
+			}
+		}
+	}
+	// Rounding, or the chosen tier lost its last backend meanwhile
+	for i, t := range tiers {
+		if shares[i] > 0 {
+			if b, err := t.lb.Next(r); err == nil {
+				return b, nil
+			}
+		}
+	}
+	return nil, ErrNoHealthyBackend
+}
+
+func (l *locality) Backends() []*Backend {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []*Backend
+	for _, t := range l.tiers {
+		out = append(out, t.lb.Backends()...)
+	}
+	return out
+}
+
+func (l *locality) Update(cfgs []config.BackendConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tiers, err := l.group(cfgs, l.tiers); err == nil {
+		l.tiers = tiers
+	}
+}
@@ -0,0 +1,180 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// newLocalityLB builds a zone-aware round_robin balancer for a gateway in
+// zone a of region eu, with four backends in each of zones a, b (eu) and
+// c (us), plus two DR backends at priority 1 if withDR is set.
+func newLocalityLB(t *testing.T, threshold int, withDR bool) (Balancer, map[string][]*Backend) {
+	t.Helper()
+	var cfgs []config.BackendConfig
+	for _, z := range []struct{ zone, region string }{{"a", "eu"}, {"b", "eu"}, {"c", "us"}} {
+		for i := 0; i < 4; i++ {
+			cfgs = append(cfgs, config.BackendConfig{
+				URL: fmt.Sprintf("http://%s%d", z.zone, i), Weight: 1, Zone: z.zone, Region: z.region,
+			})
+		}
+	}
+	for i := 0; withDR && i < 2; i++ {
+		cfgs = append(cfgs, config.BackendConfig{URL: fmt.Sprintf("http://dr%d", i), Weight: 1, Zone: "dr", Region: "dr", Priority: 1})
+	}
+	lb, err := NewWithOptions("round_robin", cfgs, Options{
+		Locality: &config.LocalityConfig{ZoneAware: true, FailoverThreshold: threshold},
+		Zone:     "a",
+		Region:   "eu",
+	})
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	byZone := map[string][]*Backend{}
+	for _, b := range lb.Backends() {
+		byZone[b.Zone()] = append(byZone[b.Zone()], b)
+	}
+	return lb, byZone
+}
+
+// zoneShares returns the fraction of n requests served from each zone.
+func zoneShares(t *testing.T, lb Balancer, n int) map[string]float64 {
+	t.Helper()
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		b, err := lb.Next(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		counts[b.Zone()]++
+	}
+	out := map[string]float64{}
+	for z, c := range counts {
+		out[z] = float64(c) / float64(n)
+	}
+	return out
+}
+
+func near(got, want float64) bool { return got > want-0.04 && got < want+0.04 }
+
+func TestLocality_PrefersLocalZone(t *testing.T) {
+	lb, _ := newLocalityLB(t, 70, true)
+	if s := zoneShares(t, lb, 2000); s["a"] != 1 {
+		t.Fatalf("expected all traffic in the local zone, got %v", s)
+	}
+}
+
+func TestLocality_SpillsProportionally(t *testing.T) {
+	lb, zones := newLocalityLB(t, 100, false)
+	zones["a"][0].SetAlive(false)
+	zones["a"][1].SetAlive(false)
+	// Zone a is 50% healthy: it keeps half, the rest spills to zone b (same region)
+	s := zoneShares(t, lb, 8000)
+	if !near(s["a"], 0.5) || !near(s["b"], 0.5) || s["c"] != 0 {
+		t.Fatalf("expected an even split between zones a and b, got %v", s)
+	}
+
+	for _, b := range zones["b"][:3] {
+		b.SetAlive(false)
+	}
+	// a keeps 0.5, b (25% healthy) takes 0.25, c the remaining quarter
+	s = zoneShares(t, lb, 8000)
+	if !near(s["a"], 0.5) || !near(s["b"], 0.25) || !near(s["c"], 0.25) {
+		t.Fatalf("expected spill from a to b to c, got %v", s)
+	}
+}
+
+func TestLocality_PriorityFailover(t *testing.T) {
+	lb, zones := newLocalityLB(t, 70, true)
+	// Priority 0 at 75% healthy in every zone: above the threshold, no failover
+	for _, z := range []string{"a", "b", "c"} {
+		zones[z][0].SetAlive(false)
+	}
+	if s := zoneShares(t, lb, 2000); s["dr"] != 0 {
+		t.Fatalf("DR tier must not take traffic while priority 0 is above the threshold: %v", s)
+	}
+
+	// 25% healthy overall: priority 0 keeps 0.25/0.7, DR takes the rest
+	for _, z := range []string{"a", "b", "c"} {
+		zones[z][1].SetAlive(false)
+		zones[z][2].SetAlive(false)
+	}
+	s := zoneShares(t, lb, 8000)
+	if p0 := s["a"] + s["b"] + s["c"]; !near(p0, 0.25/0.7) || !near(s["dr"], 1-0.25/0.7) {
+		t.Fatalf("expected the DR tier to take over part of the traffic, got %v", s)
+	}
+
+	for _, z := range []string{"a", "b", "c"} {
+		zones[z][3].SetAlive(false)
+	}
+	if s := zoneShares(t, lb, 500); s["dr"] != 1 {
+		t.Fatalf("expected all traffic on the DR tier, got %v", s)
+	}
+	for _, b := range zones["dr"] {
+		b.SetAlive(false)
+	}
+	if _, err := lb.Next(httptest.NewRequest("GET", "/", nil)); err != ErrNoHealthyBackend {
+		t.Fatalf("expected ErrNoHealthyBackend, got %v", err)
+	}
+}
+
+func TestLocality_UpdateKeepsBackendState(t *testing.T) {
+	lb, zones := newLocalityLB(t, 70, true)
+	kept := zones["a"][0]
+	kept.SetAlive(false)
+	lb.Update([]config.BackendConfig{
+		{URL: kept.URL, Weight: 1, Zone: "a", Region: "eu"},
+		{URL: "http://b9", Weight: 1, Zone: "b", Region: "eu"},
+	})
+	bs := lb.Backends()
+	if len(bs) != 2 || bs[0] != kept || kept.IsAlive() {
+		t.Fatalf("expected the existing backend object and its state to be kept: %v", bs)
+	}
+	if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b.URL != "http://b9" {
+		t.Fatalf("expected traffic to spill to zone b, got %s", b.URL)
+	}
+}
+
+func TestLocality_RelabelKeepsBackend(t *testing.T) {
+	lb, zones := newLocalityLB(t, 70, false)
+	moved := zones["c"][0]
+	moved.SetAlive(false)
+	moved.Inc()
+	moved.SetAdminState(StateDraining)
+
+	// Relabelled into the gateway's zone, and a new tier for priority 1
+	var cfgs []config.BackendConfig
+	for _, b := range lb.Backends() {
+		c := b.Config()
+		if b == moved {
+			c.Zone, c.Region = "a", "eu"
+		}
+		cfgs = append(cfgs, c)
+	}
+	cfgs = append(cfgs, config.BackendConfig{URL: "http://dr0", Weight: 1, Priority: 1})
+	lb.Update(cfgs)
+
+	count := 0
+	for _, b := range lb.Backends() {
+		if b.URL == moved.URL {
+			count++
+			if b != moved {
+				t.Fatal("relabelled backend replaced by a new object")
+			}
+		}
+	}
+	if count != 1 || moved.Zone() != "a" || moved.IsAlive() || moved.Inflight() != 1 || moved.AdminState() != StateDraining {
+		t.Fatalf("relabelled backend lost its state: count=%d zone=%s", count, moved.Zone())
+	}
+	if len(lb.Backends()) != len(cfgs) {
+		t.Fatalf("backends = %d, want %d", len(lb.Backends()), len(cfgs))
+	}
+}
+
+func TestLocality_BadThreshold(t *testing.T) {
+	if _, err := NewWithOptions("round_robin", nil, Options{Locality: &config.LocalityConfig{FailoverThreshold: 120}}); err == nil {
+		t.Fatal("expected an out-of-range failover_threshold to be rejected")
+	}
+}
@@ -0,0 +1,132 @@
+package loadbalancer
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// ---------------------------------------------------------------------------
+// Power of two choices (p2c) and peak EWMA
+//
+// Both sample two available backends at random and send the request to the
+// cheaper one, which avoids least_conn's full scan and its herd behaviour
+// when many gateways see the same "least loaded" backend. p2c compares
+// in-flight requests; peak_ewma (as in Finagle and Linkerd) multiplies them
+// by a moving average of response latency that jumps to any slower sample
+// immediately and decays towards faster ones, so a backend that slows down
+// is avoided at once and trusted again gradually.
+// ---------------------------------------------------------------------------
+
+// ewmaDecay is the time constant of the latency average: after ewmaDecay
+// without slower samples a spike has lost about 63% of its weight.
+const ewmaDecay = 10 * time.Second
+
+// unmeasuredPenalty is the latency assumed for a busy backend that has not
+// completed a request yet, so new backends get a few probes rather than a
+// flood.
+const unmeasuredPenalty = float64(time.Second)
+
+// peakEWMA is a backend's latency average in nanoseconds.
+type peakEWMA struct {
+	mu    sync.Mutex
+	value float64
+	stamp time.Time
+}
+
+// ObserveLatency records the time a backend took to return response headers.
+func (b *Backend) ObserveLatency(d time.Duration) { b.observeLatency(d, time.Now()) }
+
+func (b *Backend) observeLatency(d time.Duration, now time.Time) {
+	e := &b.latency
+	rtt := float64(d)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if rtt > e.value || e.stamp.IsZero() {
+		e.value = rtt // peak: take slower samples at face value
+	} else {
+		w := math.Exp(-float64(now.Sub(e.stamp)) / float64(ewmaDecay))
+		e.value = e.value*w + rtt*(1-w)
+	}
+	e.stamp = now
+}
+
+// LatencyEWMA returns the backend's peak-EWMA response latency, or 0 if no
+// response has been observed.
+func (b *Backend) LatencyEWMA() time.Duration {
+	b.latency.mu.Lock()
+	defer b.latency.mu.Unlock()
+	return time.Duration(b.latency.value)
+}
+
+// ewmaCost estimates how long a new request to b would take.
+func ewmaCost(b *Backend) float64 {
+	inflight := b.Inflight()
+	lat := float64(b.LatencyEWMA())
+	if lat == 0 {
+		if inflight == 0 {
+			return 0 // idle and unmeasured: try it
+		}
+		lat = unmeasuredPenalty
+	}
+	return lat * float64(inflight+1)
+}
+
+func inflightCost(b *Backend) float64 { return float64(b.Inflight()) }
+
+type p2c struct {
+	mu       sync.RWMutex
+	backends []*Backend
+	cost     func(b *Backend) float64
+	ss       *slowStart
+}
+
+func (p *p2c) Next(_ *http.Request) (*Backend, error) {
+	p.mu.RLock()
+	bs := p.backends
+	p.mu.RUnlock()
+
+	alive := healthy(bs)
+	switch len(alive) {
+	case 0:
+		return nil, ErrNoHealthyBackend
+	case 1:
+		return alive[0], nil
+	}
+	i := rand.N(len(alive))
+	j := rand.N(len(alive) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := alive[i], alive[j]
+
+	ca, cb := p.cost(a), p.cost(b)
+	if p.ss != nil {
+		// Warming backends look proportionally more expensive
+		now := p.ss.now()
+		ca = (ca + 1) / p.ss.factor(a, now)
+		cb = (cb + 1) / p.ss.factor(b, now)
+	}
+	if cb < ca {
+		return b, nil
+	}
+	return a, nil
+}
+
+func (p *p2c) Backends() []*Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.backends
+}
+
+func (p *p2c) Update(cfgs []config.BackendConfig) { p.update(cfgs, nil) }
+
+func (p *p2c) update(cfgs []config.BackendConfig, from map[string]*Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backends = mergeBackends(p.backends, cfgs, from)
+}
@@ -0,0 +1,156 @@
+package loadbalancer
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+func newP2CLB(t testing.TB, algorithm string, n int) (Balancer, []*Backend) {
+	t.Helper()
+	cfgs := make([]config.BackendConfig, n)
+	for i := range cfgs {
+		cfgs[i] = config.BackendConfig{URL: fmt.Sprintf("http://10.0.0.%d", i), Weight: 1}
+	}
+	lb := New(algorithm, cfgs)
+	return lb, lb.Backends()
+}
+
+func TestPeakEWMA_Observe(t *testing.T) {
+	b := &Backend{}
+	now := time.Unix(1_700_000_000, 0)
+	b.observeLatency(10*time.Millisecond, now)
+	b.observeLatency(200*time.Millisecond, now.Add(time.Second))
+	if got := b.LatencyEWMA(); got != 200*time.Millisecond {
+		t.Fatalf("a slower sample should be taken at face value, got %v", got)
+	}
+	// One decay period later a fast sample carries 1-1/e of the weight
+	b.observeLatency(10*time.Millisecond, now.Add(time.Second+ewmaDecay))
+	want := 200*math.Exp(-1) + 10*(1-math.Exp(-1))
+	if got := float64(b.LatencyEWMA()) / float64(time.Millisecond); math.Abs(got-want) > 0.01 {
+		t.Fatalf("expected decay towards faster samples: got %.2fms, want %.2fms", got, want)
+	}
+}
+
+func TestP2C_PrefersLessLoaded(t *testing.T) {
+	lb, bs := newP2CLB(t, "p2c", 2)
+	for i := 0; i < 5; i++ {
+		bs[0].Inc()
+	}
+	for i := 0; i < 50; i++ {
+		if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != bs[1] {
+			t.Fatal("with two backends p2c must always choose the less loaded one")
+		}
+	}
+}
+
+func TestP2C_SingleAndNoBackend(t *testing.T) {
+	lb, bs := newP2CLB(t, "p2c", 1)
+	if b, err := lb.Next(httptest.NewRequest("GET", "/", nil)); err != nil || b != bs[0] {
+		t.Fatalf("expected the only backend, got %v, %v", b, err)
+	}
+	bs[0].SetAlive(false)
+	if _, err := lb.Next(httptest.NewRequest("GET", "/", nil)); err != ErrNoHealthyBackend {
+		t.Fatalf("expected ErrNoHealthyBackend, got %v", err)
+	}
+}
+
+func TestPeakEWMA_AvoidsSlowBackend(t *testing.T) {
+	lb, bs := newP2CLB(t, "peak_ewma", 2)
+	bs[0].ObserveLatency(5 * time.Millisecond)
+	bs[1].ObserveLatency(80 * time.Millisecond)
+	bs[0].Inc() // busier, but much faster
+	for i := 0; i < 50; i++ {
+		if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != bs[0] {
+			t.Fatal("expected the faster backend despite one more in-flight request")
+		}
+	}
+	for i := 0; i < 20; i++ {
+		bs[0].Inc()
+	}
+	if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != bs[1] {
+		t.Fatal("expected the slow backend once the fast one is queued up")
+	}
+}
+
+func TestPeakEWMA_UnmeasuredBackend(t *testing.T) {
+	lb, bs := newP2CLB(t, "peak_ewma", 2)
+	bs[0].ObserveLatency(5 * time.Millisecond)
+	if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != bs[1] {
+		t.Fatal("an idle unmeasured backend should be tried")
+	}
+	bs[1].Inc()
+	if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != bs[0] {
+		t.Fatal("a busy unmeasured backend should be penalised")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Benchmarks: simulated traffic against backends with skewed latency
+// ---------------------------------------------------------------------------
+
+type pendingReq struct {
+	done    time.Duration
+	backend *Backend
+	latency time.Duration
+}
+
+type pendingHeap []pendingReq
+
+func (h pendingHeap) Len() int           { return len(h) }
+func (h pendingHeap) Less(i, j int) bool { return h[i].done < h[j].done }
+func (h pendingHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *pendingHeap) Push(x any)        { *h = append(*h, x.(pendingReq)) }
+func (h *pendingHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// benchmarkSkewed sends a request every two simulated milliseconds to five
+// backends, one of which is ten times slower; each backend also slows down
+// as its queue grows. It reports the mean simulated latency per request.
+func benchmarkSkewed(b *testing.B, algorithm string) {
+	lb, bs := newP2CLB(b, algorithm, 5)
+	base := map[*Backend]time.Duration{}
+	for i, be := range bs {
+		base[be] = 10 * time.Millisecond
+		if i == 4 {
+			base[be] = 100 * time.Millisecond
+		}
+	}
+	epoch := time.Unix(1_700_000_000, 0)
+	req := httptest.NewRequest("GET", "/", nil)
+	pending := &pendingHeap{}
+	var clock, total time.Duration
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clock += 2 * time.Millisecond
+		for pending.Len() > 0 && (*pending)[0].done <= clock {
+			p := heap.Pop(pending).(pendingReq)
+			p.backend.Dec()
+			p.backend.observeLatency(p.latency, epoch.Add(p.done))
+		}
+		be, err := lb.Next(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		lat := base[be] + base[be]*time.Duration(be.Inflight())/10
+		be.Inc()
+		heap.Push(pending, pendingReq{done: clock + lat, backend: be, latency: lat})
+		total += lat
+	}
+	b.ReportMetric(float64(total)/float64(b.N)/float64(time.Millisecond), "sim-ms/req")
+}
+
+func BenchmarkSkewedLatency_RoundRobin(b *testing.B) { benchmarkSkewed(b, "round_robin") }
+func BenchmarkSkewedLatency_LeastConn(b *testing.B)  { benchmarkSkewed(b, "least_conn") }
+func BenchmarkSkewedLatency_P2C(b *testing.B)        { benchmarkSkewed(b, "p2c") }
+func BenchmarkSkewedLatency_PeakEWMA(b *testing.B)   { benchmarkSkewed(b, "peak_ewma") }
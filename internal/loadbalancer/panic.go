@@ -0,0 +1,82 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// ---------------------------------------------------------------------------
+// Panic mode
+//
+// When health checks mark most of a route's backends down at once, the cause
+// is as likely to be the checks (or a shared dependency of theirs) as the
+// backends. Below panic_threshold percent available backends the route stops
+// trusting health and spreads requests round-robin over every backend, so a
+// partial problem does not become a full outage.
+// ---------------------------------------------------------------------------
+
+var panicGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gateway",
+	Name:      "lb_panic",
+	Help:      "1 while a route's load balancer ignores backend health because too few backends are healthy.",
+}, []string{"route"})
+
+type panicGuard struct {
+	Balancer
+	threshold float64 // fraction
+	route     string
+	log       *zap.SugaredLogger
+	counter   atomic.Uint64
+	panicking atomic.Bool
+}
+
+func newPanicGuard(inner Balancer, percent int, route string, log *zap.SugaredLogger) (*panicGuard, error) {
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("panic_threshold %d: must be between 0 and 100", percent)
+	}
+	if log == nil {
+		log = zap.NewNop().Sugar()
+	}
+	panicGauge.WithLabelValues(route).Set(0)
+	return &panicGuard{Balancer: inner, threshold: float64(percent) / 100, route: route, log: log}, nil
+}
+
+func (p *panicGuard) Next(r *http.Request) (*Backend, error) {
+	// Backends taken out of rotation by an operator stay out, panic or not
+	var bs []*Backend
+	available := 0
+	for _, b := range p.Backends() {
+		if !b.inRotation() {
+			continue
+		}
+		bs = append(bs, b)
+		if b.Available() {
+			available++
+		}
+	}
+	panicking := len(bs) > 0 && float64(available) < p.threshold*float64(len(bs))
+	if p.panicking.Swap(panicking) != panicking {
+		p.transition(panicking, available, len(bs))
+	}
+	if !panicking {
+		return p.Balancer.Next(r)
+	}
+	idx := p.counter.Add(1) - 1
+	return bs[idx%uint64(len(bs))], nil
+}
+
+func (p *panicGuard) transition(panicking bool, available, total int) {
+	if panicking {
+		panicGauge.WithLabelValues(p.route).Set(1)
+		p.log.Warnw("load balancer entering panic mode, ignoring backend health",
+			"route", p.route, "available", available, "backends", total, "threshold_percent", p.threshold*100)
+		return
+	}
+	panicGauge.WithLabelValues(p.route).Set(0)
+	p.log.Infow("load balancer leaving panic mode", "route", p.route, "available", available, "backends", total)
+}
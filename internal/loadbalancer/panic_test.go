@@ -0,0 +1,79 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+func TestPanicThreshold(t *testing.T) {
+	var cfgs []config.BackendConfig
+	for i := 0; i < 4; i++ {
+		cfgs = append(cfgs, config.BackendConfig{URL: fmt.Sprintf("http://b%d", i), Weight: 1})
+	}
+	lb, err := NewWithOptions("round_robin", cfgs, Options{PanicThreshold: 50, Route: "/panic"})
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	bs := lb.Backends()
+	r := httptest.NewRequest("GET", "/", nil)
+	gauge := panicGauge.WithLabelValues("/panic")
+
+	counts := func() map[*Backend]int {
+		seen := map[*Backend]int{}
+		for i := 0; i < 40; i++ {
+			b, err := lb.Next(r)
+			if err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+			seen[b]++
+		}
+		return seen
+	}
+
+	// 2 of 4 available is exactly the threshold: health still applies
+	bs[0].SetAlive(false)
+	bs[1].SetAlive(false)
+	if seen := counts(); seen[bs[0]]+seen[bs[1]] != 0 {
+		t.Errorf("unhealthy backends used at the threshold: %v", seen)
+	}
+	if v := testutil.ToFloat64(gauge); v != 0 {
+		t.Errorf("gateway_lb_panic = %v, want 0", v)
+	}
+
+	// 1 of 4: panic, every backend gets traffic
+	bs[2].SetAlive(false)
+	seen := counts()
+	for _, b := range bs {
+		if seen[b] != 10 {
+			t.Errorf("%s served %d of 40 in panic mode, want 10", b.URL, seen[b])
+		}
+	}
+	if v := testutil.ToFloat64(gauge); v != 1 {
+		t.Errorf("gateway_lb_panic = %v, want 1", v)
+	}
+
+	// Even with nothing healthy the route keeps serving
+	bs[3].SetAlive(false)
+	if _, err := lb.Next(r); err != nil {
+		t.Errorf("Next with all backends down: %v", err)
+	}
+
+	for _, b := range bs {
+		b.SetAlive(true)
+	}
+	lb.Next(r)
+	if v := testutil.ToFloat64(gauge); v != 0 {
+		t.Errorf("gateway_lb_panic = %v after recovery, want 0", v)
+	}
+}
+
+func TestPanicThreshold_Invalid(t *testing.T) {
+	_, err := NewWithOptions("round_robin", []config.BackendConfig{{URL: "http://a", Weight: 1}}, Options{PanicThreshold: 120})
+	if err == nil {
+		t.Fatal("expected error for panic_threshold above 100")
+	}
+}
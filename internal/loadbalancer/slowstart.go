@@ -0,0 +1,109 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// ---------------------------------------------------------------------------
+// Slow start
+//
+// A backend that has just recovered, returned from an ejection or been added
+// by a reload gets a reduced share of traffic that grows over a window, so
+// services with cold caches or JIT are not hit with a full share at once.
+// As in Envoy, the effective weight is
+//
+//	weight * max(min_weight_percent/100, (elapsed/window)^(1/aggression))
+//
+// Balancers apply the resulting factor in whatever way suits them: weighted
+// ones scale the weight, the others admit a warming backend with that
+// probability and move on to the next candidate otherwise.
+// ---------------------------------------------------------------------------
+
+type slowStart struct {
+	window     time.Duration
+	minFactor  float64
+	aggression float64
+	now        func() time.Time
+}
+
+// newSlowStart returns nil (slow start disabled) for a nil cfg.
+func newSlowStart(cfg *config.SlowStartConfig) (*slowStart, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	window, err := time.ParseDuration(cfg.Window)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("slow_start.window %q: must be a positive duration", cfg.Window)
+	}
+	s := &slowStart{window: window, minFactor: 0.1, aggression: 1, now: time.Now}
+	if cfg.MinWeightPercent != 0 {
+		if cfg.MinWeightPercent < 0 || cfg.MinWeightPercent > 100 {
+			return nil, fmt.Errorf("slow_start.min_weight_percent %d: must be between 1 and 100", cfg.MinWeightPercent)
+		}
+		s.minFactor = float64(cfg.MinWeightPercent) / 100
+	}
+	if cfg.Aggression != 0 {
+		if cfg.Aggression < 0 {
+			return nil, fmt.Errorf("slow_start.aggression %v: must be positive", cfg.Aggression)
+		}
+		s.aggression = cfg.Aggression
+	}
+	return s, nil
+}
+
+// factor returns the share of b's weight it should receive at now, in
+// (0, 1]. A nil *slowStart always returns 1.
+func (s *slowStart) factor(b *Backend, now time.Time) float64 {
+	if s == nil {
+		return 1
+	}
+	since := b.AvailableSince()
+	if since.IsZero() {
+		return 1
+	}
+	elapsed := now.Sub(since)
+	if elapsed >= s.window {
+		return 1
+	}
+	f := math.Pow(float64(max(elapsed, time.Millisecond))/float64(s.window), 1/s.aggression)
+	return max(f, s.minFactor)
+}
+
+// pick walks bs from index start and returns the first backend that passes
+// its admission roll; roll(i) yields a number in [0, 1) for the i-th
+// candidate. If every candidate is turned away, bs[start] is used.
+func (s *slowStart) pick(bs []*Backend, start int, roll func(i int) float64) *Backend {
+	if s == nil {
+		return bs[start]
+	}
+	now := s.now()
+	for i := range bs {
+		b := bs[(start+i)%len(bs)]
+		if s.admit(b, now, roll(i)) {
+			return b
+		}
+	}
+	return bs[start]
+}
+
+// admit reports whether b takes a request given a roll in [0, 1).
+func (s *slowStart) admit(b *Backend, now time.Time, roll float64) bool {
+	f := s.factor(b, now)
+	return f >= 1 || roll < f
+}
+
+// hashRoll returns a deterministic roll for key, so a client is consistently
+// admitted to (or kept away from) a warming backend until its factor grows.
+func hashRoll(key uint32) func(i int) float64 {
+	return func(i int) float64 {
+		h := key ^ uint32(i)*0x9e3779b9
+		h ^= h >> 16
+		h *= 0x85ebca6b
+		h ^= h >> 13
+		return float64(h) / (1 << 32)
+	}
+}
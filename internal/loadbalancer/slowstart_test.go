@@ -0,0 +1,149 @@
+package loadbalancer
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+func newSlowStartLB(t *testing.T, algorithm string, ss config.SlowStartConfig, n int) (Balancer, []*Backend) {
+	t.Helper()
+	cfgs := make([]config.BackendConfig, n)
+	for i := range cfgs {
+		cfgs[i] = config.BackendConfig{URL: "http://b" + string(rune('0'+i)), Weight: 1}
+	}
+	lb, err := NewWithOptions(algorithm, cfgs, Options{SlowStart: &ss})
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	return lb, lb.Backends()
+}
+
+// share returns the fraction of n picks that went to target.
+func share(t *testing.T, lb Balancer, target *Backend, n int) float64 {
+	t.Helper()
+	hits := 0
+	for i := 0; i < n; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "198.51.100." + string(rune('0'+i%10)) + ":1"
+		b, err := lb.Next(r)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if b == target {
+			hits++
+		}
+	}
+	return float64(hits) / float64(n)
+}
+
+func TestSlowStart_Factor(t *testing.T) {
+	s, err := newSlowStart(&config.SlowStartConfig{Window: "100s", MinWeightPercent: 20, Aggression: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1_700_000_000, 0)
+	b := &Backend{}
+	if f := s.factor(b, start); f != 1 {
+		t.Fatalf("backend warm since startup should have factor 1, got %v", f)
+	}
+	b.SetAvailableSince(start)
+	for _, tc := range []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{time.Second, 0.2}, // sqrt(0.01) = 0.1, floored at 20%
+		{25 * time.Second, 0.5},
+		{64 * time.Second, 0.8},
+		{100 * time.Second, 1},
+	} {
+		if got := s.factor(b, start.Add(tc.elapsed)); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("after %v: factor %v, want %v", tc.elapsed, got, tc.want)
+		}
+	}
+}
+
+func TestSlowStart_BadConfig(t *testing.T) {
+	for _, cfg := range []config.SlowStartConfig{
+		{},
+		{Window: "-1s"},
+		{Window: "10s", MinWeightPercent: 150},
+		{Window: "10s", Aggression: -1},
+	} {
+		if _, err := NewWithOptions("round_robin", nil, Options{SlowStart: &cfg}); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestSlowStart_Transitions(t *testing.T) {
+	b := buildBackends([]config.BackendConfig{{URL: "http://b"}})[0]
+	if !b.AvailableSince().IsZero() {
+		t.Fatal("backends built at startup must not slow start")
+	}
+	b.SetAlive(true)
+	if !b.AvailableSince().IsZero() {
+		t.Fatal("a healthy verdict for a live backend is not a recovery")
+	}
+	b.SetAlive(false)
+	b.SetAlive(true)
+	recovered := b.AvailableSince()
+	if recovered.IsZero() {
+		t.Fatal("expected recovery to start slow start")
+	}
+	b.SetEjected(true)
+	time.Sleep(time.Millisecond)
+	b.SetEjected(false)
+	if !b.AvailableSince().After(recovered) {
+		t.Fatal("expected return from ejection to restart slow start")
+	}
+
+	added := mergeBackends([]*Backend{b}, []config.BackendConfig{{URL: "http://b"}, {URL: "http://new"}}, nil)
+	if added[0] != b || added[1].AvailableSince().IsZero() {
+		t.Fatal("expected only the added backend to slow start")
+	}
+}
+
+func TestSlowStart_Balancers(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		lo, hi    float64 // expected share of the warming backend
+	}{
+		{"round_robin", 0.15, 0.35},
+		{"weighted", 0.28, 0.39},
+		{"ip_hash", 0, 0.5},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			lb, bs := newSlowStartLB(t, tc.algorithm, config.SlowStartConfig{Window: "1h"}, 2)
+			// Half way through the window: factor 0.5
+			bs[1].SetAvailableSince(time.Now().Add(-30 * time.Minute))
+			if got := share(t, lb, bs[1], 6000); got < tc.lo || got > tc.hi {
+				t.Fatalf("warming backend got %.2f of traffic, want %.2f-%.2f", got, tc.lo, tc.hi)
+			}
+
+			bs[1].SetAvailableSince(time.Now().Add(-time.Hour))
+			if got := share(t, lb, bs[1], 6000); got < 0.4 && tc.algorithm != "ip_hash" {
+				t.Fatalf("expected an even split after the window, got %.2f", got)
+			}
+		})
+	}
+}
+
+func TestSlowStart_LeastConn(t *testing.T) {
+	lb, bs := newSlowStartLB(t, "least_conn", config.SlowStartConfig{Window: "1h", MinWeightPercent: 25}, 2)
+	bs[1].SetAvailableSince(time.Now())
+	bs[0].Inc()
+	bs[0].Inc()
+	// b0: (2+1)/1 = 3, b1: (0+1)/0.25 = 4
+	if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != bs[0] {
+		t.Fatal("a warming backend should look busier than its inflight count")
+	}
+	bs[0].Inc()
+	bs[0].Inc()
+	if b, _ := lb.Next(httptest.NewRequest("GET", "/", nil)); b != bs[1] {
+		t.Fatal("expected the warming backend once the other is busy enough")
+	}
+}
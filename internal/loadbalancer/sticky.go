@@ -0,0 +1,136 @@
+package loadbalancer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// ---------------------------------------------------------------------------
+// Cookie-based sticky sessions
+//
+// Sticky wraps any Balancer. The first response carries a cookie naming the
+// chosen backend by an opaque ID, signed with HMAC-SHA256 so clients cannot
+// steer themselves to a backend of their choice. Later requests go to that
+// backend while it is available; otherwise the wrapped balancer picks a new
+// one and the cookie is rewritten on the way out.
+// ---------------------------------------------------------------------------
+
+const defaultStickyCookie = "GW_STICKY"
+
+// Sticky routes requests carrying a valid sticky cookie to the backend it
+// names, and delegates everything else to the wrapped Balancer.
+type Sticky struct {
+	Balancer
+	name     string
+	secret   []byte
+	path     string
+	maxAge   int
+	secure   bool
+	sameSite http.SameSite
+}
+
+// NewSticky wraps inner. An empty cfg.Secret uses a random key, so cookies
+// are only honoured by this process until it restarts.
+func NewSticky(inner Balancer, cfg *config.StickyConfig) (*Sticky, error) {
+	s := &Sticky{
+		Balancer: inner,
+		name:     cfg.Cookie,
+		secret:   []byte(cfg.Secret),
+		path:     cfg.Path,
+		secure:   cfg.Secure,
+	}
+	if s.name == "" {
+		s.name = defaultStickyCookie
+	}
+	if s.path == "" {
+		s.path = "/"
+	}
+	if len(s.secret) == 0 {
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return nil, fmt.Errorf("sticky: generate secret: %w", err)
+		}
+	}
+	if cfg.TTL != "" {
+		ttl, err := time.ParseDuration(cfg.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("sticky.ttl %q: must be a positive duration", cfg.TTL)
+		}
+		s.maxAge = int(ttl.Seconds())
+	}
+	switch strings.ToLower(cfg.SameSite) {
+	case "", "lax":
+		s.sameSite = http.SameSiteLaxMode
+	case "strict":
+		s.sameSite = http.SameSiteStrictMode
+	case "none":
+		s.sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("sticky.same_site %q: expected lax, strict or none", cfg.SameSite)
+	}
+	return s, nil
+}
+
+// Next returns the backend named by the request's sticky cookie if it is
+// routable, else the wrapped balancer's choice.
+func (s *Sticky) Next(r *http.Request) (*Backend, error) {
+	if b := s.pinned(r); b != nil && b.Routable() {
+		return b, nil
+	}
+	return s.Balancer.Next(r)
+}
+
+// Cookie returns the cookie to set on the response to r, which was served by
+// b, or nil if r already carries a valid cookie for b. A nil *Sticky never
+// sets a cookie.
+func (s *Sticky) Cookie(r *http.Request, b *Backend) *http.Cookie {
+	if s == nil || s.pinned(r) == b {
+		return nil
+	}
+	id := backendID(b)
+	return &http.Cookie{
+		Name:     s.name,
+		Value:    id + "." + s.sign(id),
+		Path:     s.path,
+		MaxAge:   s.maxAge,
+		Secure:   s.secure,
+		HttpOnly: true,
+		SameSite: s.sameSite,
+	}
+}
+
+// pinned returns the backend named by a correctly signed cookie, or nil.
+func (s *Sticky) pinned(r *http.Request) *Backend {
+	c, err := r.Cookie(s.name)
+	if err != nil {
+		return nil
+	}
+	id, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(id))) {
+		return nil
+	}
+	for _, b := range s.Backends() {
+		if backendID(b) == id {
+			return b
+		}
+	}
+	return nil
+}
+
+func (s *Sticky) sign(id string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil)[:16])
+}
+
+// backendID is an opaque, stable name for b that does not reveal its address.
+func backendID(b *Backend) string { return strconv.FormatUint(hash64(b.URL), 36) }
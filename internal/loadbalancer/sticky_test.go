@@ -0,0 +1,107 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+func newStickyLB(t *testing.T, cfg config.StickyConfig) (*Sticky, []*Backend) {
+	t.Helper()
+	inner := New("round_robin", []config.BackendConfig{
+		{URL: "http://10.0.0.1", Weight: 1}, {URL: "http://10.0.0.2", Weight: 1}, {URL: "http://10.0.0.3", Weight: 1},
+	})
+	s, err := NewSticky(inner, &cfg)
+	if err != nil {
+		t.Fatalf("NewSticky: %v", err)
+	}
+	return s, s.Backends()
+}
+
+func withCookie(c *http.Cookie) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestSticky_PinsAndFailsOver(t *testing.T) {
+	s, _ := newStickyLB(t, config.StickyConfig{Secret: "k", TTL: "1h", Secure: true})
+
+	r := withCookie(nil)
+	first, _ := s.Next(r)
+	c := s.Cookie(r, first)
+	if c == nil || c.Name != defaultStickyCookie || c.MaxAge != 3600 || !c.HttpOnly || !c.Secure {
+		t.Fatalf("unexpected cookie %+v", c)
+	}
+	if strings.Contains(c.Value, "10.0.0") {
+		t.Fatalf("cookie must not reveal the backend address: %q", c.Value)
+	}
+
+	for i := 0; i < 10; i++ {
+		r := withCookie(c)
+		if b, _ := s.Next(r); b != first {
+			t.Fatalf("request %d left its pinned backend", i)
+		}
+		if s.Cookie(r, first) != nil {
+			t.Fatal("a valid cookie should not be rewritten")
+		}
+	}
+
+	first.SetEjected(true)
+	r = withCookie(c)
+	next, _ := s.Next(r)
+	if next == first {
+		t.Fatal("expected failover away from an ejected backend")
+	}
+	nc := s.Cookie(r, next)
+	if nc == nil || nc.Value == c.Value {
+		t.Fatal("expected the cookie to be rewritten after failover")
+	}
+	if b, _ := s.Next(withCookie(nc)); b != next {
+		t.Fatal("expected the new cookie to pin the new backend")
+	}
+}
+
+func TestSticky_RejectsForgedCookies(t *testing.T) {
+	s, bs := newStickyLB(t, config.StickyConfig{Secret: "k"})
+	other, _ := newStickyLB(t, config.StickyConfig{Secret: "different"})
+
+	forged := other.Cookie(withCookie(nil), bs[2])
+	if s.pinned(withCookie(forged)) != nil {
+		t.Fatal("a cookie signed with another key must be ignored")
+	}
+	tampered := s.Cookie(withCookie(nil), bs[2])
+	tampered.Value = backendID(bs[0]) + tampered.Value[strings.Index(tampered.Value, "."):]
+	if s.pinned(withCookie(tampered)) != nil {
+		t.Fatal("a cookie whose ID was changed must be ignored")
+	}
+	if s.pinned(withCookie(&http.Cookie{Name: defaultStickyCookie, Value: "garbage"})) != nil {
+		t.Fatal("a malformed cookie must be ignored")
+	}
+}
+
+func TestSticky_RemovedBackend(t *testing.T) {
+	s, bs := newStickyLB(t, config.StickyConfig{Secret: "k"})
+	c := s.Cookie(withCookie(nil), bs[0])
+	s.Update([]config.BackendConfig{{URL: "http://10.0.0.2", Weight: 1}, {URL: "http://10.0.0.3", Weight: 1}})
+	if b, _ := s.Next(withCookie(c)); b == bs[0] {
+		t.Fatal("a backend removed from the route must not be used")
+	}
+}
+
+func TestSticky_NilAndBadConfig(t *testing.T) {
+	var s *Sticky
+	if s.Cookie(withCookie(nil), &Backend{}) != nil {
+		t.Fatal("a nil Sticky must not set cookies")
+	}
+	for _, cfg := range []config.StickyConfig{{TTL: "forever"}, {SameSite: "sometimes"}} {
+		if _, err := NewSticky(New("round_robin", nil), &cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
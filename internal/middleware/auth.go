@@ -5,6 +5,8 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -38,6 +40,23 @@ type jwtClaims struct {
 	Sub string `json:"sub"` // forwarded as X-User-ID
 	Exp int64  `json:"exp"` // Unix timestamp — reject if in the past
 	Iat int64  `json:"iat"` // issued-at — sanity check only
+
+	// All claims, kept so later stages (rate-limit keys) can use custom ones.
+	All map[string]any `json:"-"`
+}
+
+type claimsCtxKey struct{}
+
+// WithClaims returns a copy of r carrying validated JWT claims.
+func WithClaims(r *http.Request, claims map[string]any) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsCtxKey{}, claims))
+}
+
+// Claims returns the claims of the JWT validated for r, or nil if the request
+// was not authenticated. Unlike request headers these cannot be forged.
+func Claims(r *http.Request) map[string]any {
+	c, _ := r.Context().Value(claimsCtxKey{}).(map[string]any)
+	return c
 }
 
 // authMiddleware holds the parsed public key and config.
@@ -90,6 +109,7 @@ func (am *authMiddleware) handler(next http.Handler) http.Handler {
 		// Inject the validated subject so upstream services don't need to
 		// re-parse the JWT — they can trust X-User-ID because it passed our check.
 		r.Header.Set("X-User-ID", claims.Sub)
+		r = WithClaims(r, claims.All)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -221,7 +241,13 @@ func decodeClaims(s string) (*jwtClaims, error) {
 		return nil, err
 	}
 	var c jwtClaims
-	return &c, json.Unmarshal(b, &c)
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	// Numbers stay json.Number so large numeric IDs keep every digit
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return &c, dec.Decode(&c.All)
 }
 
 // writeAuthError writes a JSON error response — consistent with gateway-pro's
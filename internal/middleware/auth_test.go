@@ -139,6 +139,36 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 	}
 }
 
+func TestAuthMiddleware_ValidToken_ExposesClaims(t *testing.T) {
+	kp := newTestKeyPair(t)
+	mw, err := NewAuthMiddleware(AuthConfig{
+		Enabled:       true,
+		PublicKeyPath: kp.pubPath,
+	})
+	if err != nil {
+		t.Fatalf("NewAuthMiddleware: %v", err)
+	}
+
+	token := kp.makeToken("user-42", time.Now().Add(time.Hour).Unix())
+
+	var claims map[string]any
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = Claims(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if claims["sub"] != "user-42" {
+		t.Errorf("want sub=user-42 in context claims, got %v", claims)
+	}
+	if Claims(httptest.NewRequest(http.MethodGet, "/", nil)) != nil {
+		t.Error("want nil claims for an unauthenticated request")
+	}
+}
+
 func TestAuthMiddleware_ExpiredToken(t *testing.T) {
 	kp := newTestKeyPair(t)
 	mw, err := NewAuthMiddleware(AuthConfig{
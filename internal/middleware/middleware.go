@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sneha4175/gateway-pro/internal/clientip"
 	"go.uber.org/zap"
 )
 
@@ -61,6 +62,7 @@ func Logger(log *zap.SugaredLogger) func(http.Handler) http.Handler {
 				"path", r.URL.Path,
 				"status", cw.status,
 				"duration_ms", time.Since(start).Milliseconds(),
+				"client_ip", clientip.FromRequest(r),
 				"request_id", r.Header.Get("X-Request-ID"),
 			)
 		})
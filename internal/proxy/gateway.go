@@ -6,17 +6,23 @@ package proxy
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sneha4175/gateway-pro/internal/circuitbreaker"
+	"github.com/sneha4175/gateway-pro/internal/clientip"
+	"github.com/sneha4175/gateway-pro/internal/concurrency"
 	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/discovery"
 	"github.com/sneha4175/gateway-pro/internal/health"
 	"github.com/sneha4175/gateway-pro/internal/loadbalancer"
 	"github.com/sneha4175/gateway-pro/internal/middleware"
@@ -28,20 +34,45 @@ import (
 type Gateway struct {
 	mu         sync.RWMutex
 	routes     []*route
+	clientIPs  *clientip.Resolver
 	log        *zap.SugaredLogger
 	authConfig *config.AuthConfig
 	traceStore *middleware.TraceStore
+	events     *health.Publisher // backend health state changes
 }
 
 type route struct {
-	prefix   string
-	strip    bool
-	timeout  time.Duration
-	lb       loadbalancer.Balancer
-	rl       ratelimiter.Limiter
-	breakers map[string]*circuitbreaker.Breaker // keyed by backend URL
-	checker  *health.Checker
-	handler  http.Handler
+	prefix    string
+	strip     bool
+	timeout   time.Duration
+	lb        loadbalancer.Balancer
+	lbConfig  balancerConfig
+	backends  []config.BackendConfig
+	updateMu  sync.Mutex           // serialises changes to the backend list
+	populated bool                 // setBackends has run; guarded by updateMu
+	retired   bool                 // replaced or stopped; guarded by updateMu
+	discovery discovery.Provider   // nil if backends are static
+	sticky    *loadbalancer.Sticky // nil unless sticky sessions are enabled
+	rl        ratelimiter.Limiter
+	rlCfg     *config.RateLimitConfig
+	rlStyle   string               // rate-limit header style
+	costHdr   string               // backend-reported request cost
+	inflight  *concurrency.Limiter // route-wide; nil if unlimited
+	prioHdr   string               // header carrying the priority class
+	prioClaim string               // JWT claim carrying the priority class
+	checker   *health.Checker
+	hcCfg     *config.HealthCheckConfig
+	outliers  *health.OutlierDetector
+	events    *health.Publisher
+	handler   http.Handler
+
+	// Per-backend circuit breakers and concurrency limits, keyed by backend
+	// URL and created on first use for backends that discovery adds
+	perBackendMu sync.RWMutex
+	breakers     map[string]*circuitbreaker.Breaker
+	perBack      map[string]*concurrency.Limiter
+	cbCfg        *config.CircuitBreakerConfig
+	perBackCfg   *config.ConcurrencyConfig
 }
 
 // NewGateway builds a Gateway from the given config.
@@ -51,46 +82,316 @@ func NewGateway(cfg *config.Config, log *zap.SugaredLogger, authCfg *config.Auth
 		authConfig: authCfg,
 		traceStore: traceStore,
 	}
-	routes, err := buildRoutes(cfg.Routes, log, authCfg, traceStore)
+	resolver, err := clientip.New(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	events := newHealthEvents(cfg.HealthEvents, log)
+	routes, err := buildRoutes(cfg.Routes, cfg.Server, log, authCfg, traceStore, events, nil)
 	if err != nil {
+		events.Close()
 		return nil, err
 	}
+	startDiscovery(routes, log)
 	gw.routes = routes
+	gw.clientIPs = resolver
+	gw.events = events
 	return gw, nil
 }
 
-// Reload swaps in a new set of routes without downtime.
-// Existing health-checkers for unchanged backends are preserved.
+// Reload swaps in a new set of routes without downtime. Each new route
+// starts its own health checker with its (possibly changed) health_check
+// settings, so every old route's checker is stopped. Health event
+// subscribers are rebuilt from health_events the same way. A route whose
+// balancer settings are unchanged keeps its balancer, which is updated with
+// the new backend list so existing backends keep their health, in-flight
+// counts and balancing state. Likewise a route whose rate_limit is
+// unchanged keeps its limiter, with its buckets and admin overrides, and
+// one whose health_check is unchanged keeps its probe history. Routes with
+// discovery wait for its first answer before going live; see
+// startDiscovery.
 func (gw *Gateway) Reload(cfg *config.Config) error {
-	routes, err := buildRoutes(cfg.Routes, gw.log, gw.authConfig, gw.traceStore)
+	resolver, err := clientip.New(cfg.Server.TrustedProxies)
 	if err != nil {
 		return err
 	}
+	gw.mu.RLock()
+	current := gw.routes
+	gw.mu.RUnlock()
+	events := newHealthEvents(cfg.HealthEvents, gw.log)
+	routes, err := buildRoutes(cfg.Routes, cfg.Server, gw.log, gw.authConfig, gw.traceStore, events, current)
+	if err != nil {
+		events.Close()
+		return err
+	}
+	// A stopped provider could still push its last lookup into a balancer
+	// the new route shares, after the new provider's first answer
+	retireShared(current, routes)
+	startDiscovery(routes, gw.log)
 
 	gw.mu.Lock()
-	old := gw.routes
+	old, oldEvents := gw.routes, gw.events
+	updateReused(old, routes)
+	carryBackendState(old, routes, time.Now())
 	gw.routes = routes
+	gw.clientIPs = resolver
+	gw.events = events
 	gw.mu.Unlock()
 
-	// Stop health-checkers for routes that were removed
-	newPrefixes := make(map[string]bool)
+	// Every route gets a fresh checker, outlier detector and discovery, so
+	// release the old ones' goroutines, and those of replaced limiters. The
+	// new ones pick up the probe history and ejections of the backends they
+	// keep.
+	kept := limiters(routes)
+	next := byPrefix(routes)
+	for _, r := range old {
+		n := next[r.prefix]
+		r.stop(kept, n)
+		if n != nil && reflect.DeepEqual(r.hcCfg, n.hcCfg) {
+			n.checker.Inherit(r.checker)
+		}
+		if n != nil {
+			n.outliers.Inherit(r.outliers)
+		}
+	}
+	oldEvents.Close()
+	return nil
+}
+
+// stop releases the route's goroutines and connections. Limiters in shared
+// are left running, as another route uses them. live is the route serving
+// the same prefix from now on, or nil; the metric series of backends it
+// does not serve are removed.
+func (rt *route) stop(shared map[ratelimiter.Limiter]bool, live *route) {
+	rt.retire()
+	rt.checker.Stop()
+	if !shared[rt.rl] {
+		rt.rl.Stop()
+	}
+	rt.outliers.Stop()
+
+	serving := make(map[string]bool)
+	if live != nil {
+		for _, b := range live.lb.Backends() {
+			serving[b.URL] = true
+		}
+	}
+	for _, b := range rt.lb.Backends() {
+		if !serving[b.URL] {
+			health.Forget(rt.prefix, b.URL)
+		}
+	}
+	rt.perBackendMu.Lock()
+	for url, l := range rt.perBack {
+		if !serving[url] {
+			l.Close()
+		}
+	}
+	rt.perBackendMu.Unlock()
+	if live == nil || live.inflight == nil {
+		rt.inflight.Close()
+	}
+}
+
+// retire stops the route's discovery and makes it ignore any update still
+// on its way, so it no longer changes its balancer.
+func (rt *route) retire() {
+	if rt.discovery != nil {
+		rt.discovery.Stop()
+	}
+	rt.updateMu.Lock()
+	rt.retired = true
+	rt.updateMu.Unlock()
+}
+
+// retireShared retires the old routes whose balancer a new route took over.
+func retireShared(old, routes []*route) {
+	next := byPrefix(routes)
+	for _, r := range old {
+		if n := next[r.prefix]; n != nil && n.lb == r.lb {
+			r.retire()
+		}
+	}
+}
+
+// byPrefix indexes routes by path prefix.
+func byPrefix(routes []*route) map[string]*route {
+	m := make(map[string]*route, len(routes))
+	for _, r := range routes {
+		m[r.prefix] = r
+	}
+	return m
+}
+
+// limiters returns the set of the routes' limiters.
+func limiters(routes []*route) map[ratelimiter.Limiter]bool {
+	set := make(map[ratelimiter.Limiter]bool, len(routes))
+	for _, r := range routes {
+		set[r.rl] = true
+	}
+	return set
+}
+
+// discoveryWait bounds how long startDiscovery waits for first answers.
+var discoveryWait = 5 * time.Second
+
+// startDiscovery starts the discovery of every route that has it and waits
+// up to discoveryWait for each to deliver its first backend set, so that the
+// routes do not go live with no backends. A route whose discovery has not
+// answered by then starts with the backends it has: its static ones, or
+// those the route it replaces had discovered.
+func startDiscovery(routes []*route, log *zap.SugaredLogger) {
+	type pending struct {
+		rt    *route
+		first chan struct{}
+	}
+	var waiting []pending
+	for _, r := range routes {
+		if r.discovery == nil {
+			continue
+		}
+		p := pending{r, make(chan struct{})}
+		var once sync.Once
+		r.discovery.Start(func(cfgs []config.BackendConfig) {
+			p.rt.setBackends(cfgs)
+			once.Do(func() { close(p.first) })
+		})
+		waiting = append(waiting, p)
+	}
+
+	timeout := time.After(discoveryWait)
+	for i, p := range waiting {
+		select {
+		case <-p.first:
+			continue
+		case <-timeout:
+		}
+		for _, p := range waiting[i:] {
+			select {
+			case <-p.first:
+			default:
+				log.Warnw("discovery has not answered yet, starting the route with its current backends",
+					"route", p.rt.prefix, "backends", len(p.rt.lb.Backends()), "waited", discoveryWait)
+			}
+		}
+		return
+	}
+}
+
+// setBackends applies a new backend list to the route's balancer and health
+// checker. Backends already known keep their state. The first backends of a
+// route that had none serve at full weight at once, as static backends do
+// at startup; later additions go through slow start.
+func (rt *route) setBackends(cfgs []config.BackendConfig) {
+	rt.updateMu.Lock()
+	defer rt.updateMu.Unlock()
+	if rt.retired {
+		return // a late update from a stopped provider
+	}
+	fresh := !rt.populated && len(rt.lb.Backends()) == 0
+	rt.populated = true
+	rt.lb.Update(cfgs)
+	if fresh {
+		for _, b := range rt.lb.Backends() {
+			b.SetAvailableSince(time.Time{})
+		}
+	}
+	rt.checker.Update(rt.lb.Backends())
+
+	// Forget breakers and limits of backends that are gone
+	keep := make(map[string]bool, len(cfgs))
+	for _, c := range cfgs {
+		keep[c.URL] = true
+	}
+	rt.perBackendMu.Lock()
+	defer rt.perBackendMu.Unlock()
+	for url := range rt.breakers {
+		if !keep[url] {
+			delete(rt.breakers, url)
+		}
+	}
+	for url, l := range rt.perBack {
+		if !keep[url] {
+			l.Close()
+			delete(rt.perBack, url)
+		}
+	}
+}
+
+// updateReused applies the new backend lists to balancers carried over from
+// old routes. It runs only once every route has been built, so a failed
+// reload leaves the live balancers untouched. Routes with discovery keep
+// their discovered backends until the new lookup.
+func updateReused(old, routes []*route) {
+	prev := make(map[string]*route, len(old))
+	for _, r := range old {
+		prev[r.prefix] = r
+	}
 	for _, r := range routes {
-		newPrefixes[r.prefix] = true
+		if p, ok := prev[r.prefix]; ok && p.lb == r.lb {
+			if r.discovery == nil {
+				r.setBackends(r.backends)
+			} else {
+				r.checker.Update(r.lb.Backends())
+			}
+		}
 	}
+}
+
+// carryBackendState copies the admin state (draining, maintenance), weight
+// override and slow-start window of every backend a route keeps across a
+// reload, and starts the slow-start window of
+// backends that a reload adds to an existing route. Backends of brand new
+// routes start at full weight, as they do at startup.
+func carryBackendState(old, routes []*route, now time.Time) {
+	prev := make(map[string]map[string]*loadbalancer.Backend, len(old))
 	for _, r := range old {
-		if !newPrefixes[r.prefix] && r.checker != nil {
-			r.checker.Stop()
+		byURL := make(map[string]*loadbalancer.Backend)
+		for _, b := range r.lb.Backends() {
+			byURL[b.URL] = b
+		}
+		prev[r.prefix] = byURL
+	}
+	for _, r := range routes {
+		byURL, ok := prev[r.prefix]
+		if !ok {
+			continue
+		}
+		for _, b := range r.lb.Backends() {
+			switch o := byURL[b.URL]; {
+			case o == nil:
+				b.SetAvailableSince(now)
+			case o != b:
+				b.SetAdminState(o.AdminState())
+				b.SetAvailableSince(o.AvailableSince())
+				if w, ok := o.WeightOverride(); ok {
+					b.SetWeightOverride(w)
+				}
+			}
 		}
 	}
-	return nil
+}
+
+// newHealthEvents returns a publisher that logs every backend health event
+// and forwards it to the configured webhooks.
+func newHealthEvents(cfg config.HealthEventsConfig, log *zap.SugaredLogger) *health.Publisher {
+	subs := []health.Subscriber{health.LogSubscriber(log)}
+	for _, u := range cfg.Webhooks {
+		subs = append(subs, health.NewWebhook(u, log))
+	}
+	return health.NewPublisher(subs...)
 }
 
 // ServeHTTP dispatches to the matching route.
 func (gw *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	gw.mu.RLock()
 	routes := gw.routes
+	resolver := gw.clientIPs
 	gw.mu.RUnlock()
 
+	// Resolve the client IP once for the limiter, balancer and access log
+	r = resolver.WithClientIP(r)
+
 	// Longest prefix match
 	var matched *route
 	for _, rt := range routes {
@@ -109,7 +410,9 @@ func (gw *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	matched.handler.ServeHTTP(w, r)
 }
 
-// RegisterAdminHandlers mounts /metrics and /healthz on the admin mux.
+// RegisterAdminHandlers mounts /metrics, /healthz, /readyz, /backends,
+// /backends/health, /backends/weight, /backends/state and the /ratelimit
+// endpoints on the admin mux.
 func (gw *Gateway) RegisterAdminHandlers(mux *http.ServeMux) {
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
@@ -118,6 +421,11 @@ func (gw *Gateway) RegisterAdminHandlers(mux *http.ServeMux) {
 	})
 	mux.HandleFunc("/readyz", gw.readyzHandler)
 	mux.HandleFunc("/backends", gw.backendsHandler)
+	mux.HandleFunc("GET /backends/health", gw.backendHealthHandler)
+	mux.HandleFunc("PUT /backends/weight", gw.backendWeightHandler)
+	mux.HandleFunc("DELETE /backends/weight", gw.backendWeightHandler)
+	mux.HandleFunc("PUT /backends/state", gw.backendStateHandler)
+	gw.registerRateLimitHandlers(mux)
 }
 
 func (gw *Gateway) readyzHandler(w http.ResponseWriter, _ *http.Request) {
@@ -127,7 +435,7 @@ func (gw *Gateway) readyzHandler(w http.ResponseWriter, _ *http.Request) {
 
 	for _, rt := range routes {
 		for _, b := range rt.lb.Backends() {
-			if b.IsAlive() {
+			if b.Available() {
 				goto ok
 			}
 		}
@@ -155,27 +463,244 @@ func (gw *Gateway) backendsHandler(w http.ResponseWriter, _ *http.Request) {
 			if j > 0 {
 				fmt.Fprint(w, ",")
 			}
-			cbState := "disabled"
-			if cb, ok := rt.breakers[b.URL]; ok {
-				cbState = cb.State()
-			}
-			fmt.Fprintf(w, `{"url":%q,"alive":%v,"inflight":%d,"circuit_breaker":%q}`,
-				b.URL, b.IsAlive(), b.Inflight(), cbState)
+			cbState := rt.breakerState(b.URL)
+			fmt.Fprintf(w, `{"url":%q,"weight":%d,"zone":%q,"priority":%d,"state":%q,"alive":%v,"ejected":%v,"inflight":%d,"circuit_breaker":%q}`,
+				b.URL, b.Weight(), b.Zone(), b.Priority(), b.AdminState(), b.IsAlive(), b.IsEjected(), b.Inflight(), cbState)
 		}
 		fmt.Fprint(w, "]}")
 	}
 	fmt.Fprint(w, "]")
 }
 
+// backendHealth is one backend in the /backends/health response.
+type backendHealth struct {
+	URL     string               `json:"url"`
+	Alive   bool                 `json:"alive"`
+	Ejected bool                 `json:"ejected"`
+	History []health.ProbeResult `json:"history"`
+}
+
+// backendHealthHandler reports each backend's current state and recent
+// active check results, optionally for a single route (?route=/prefix).
+func (gw *Gateway) backendHealthHandler(w http.ResponseWriter, r *http.Request) {
+	gw.mu.RLock()
+	routes := gw.routes
+	gw.mu.RUnlock()
+
+	type routeHealth struct {
+		Route    string          `json:"route"`
+		Backends []backendHealth `json:"backends"`
+	}
+	want := r.URL.Query().Get("route")
+	out := []routeHealth{}
+	for _, rt := range routes {
+		if want != "" && rt.prefix != want {
+			continue
+		}
+		rh := routeHealth{Route: rt.prefix, Backends: []backendHealth{}}
+		for _, b := range rt.lb.Backends() {
+			h := rt.checker.History(b)
+			if h == nil {
+				h = []health.ProbeResult{}
+			}
+			rh.Backends = append(rh.Backends, backendHealth{URL: b.URL, Alive: b.IsAlive(), Ejected: b.IsEjected(), History: h})
+		}
+		out = append(out, rh)
+	}
+	if want != "" && len(out) == 0 {
+		http.Error(w, "unknown route", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, out)
+}
+
+// backendWeightHandler overrides a backend's configured weight
+// (PUT ?route=&backend=<url>&weight=<n>) until the override is removed
+// (DELETE ?route=&backend=<url>). Like the admin state, the override
+// survives discovery updates and reloads. Weight 0 stops new requests to
+// the backend without touching those in flight.
+func (gw *Gateway) backendWeightHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, target := q.Get("route"), q.Get("backend")
+	if prefix == "" || target == "" {
+		http.Error(w, "route and backend are required", http.StatusBadRequest)
+		return
+	}
+	weight := -1 // DELETE removes the override
+	if r.Method == http.MethodPut {
+		var err error
+		if weight, err = strconv.Atoi(q.Get("weight")); err != nil || weight < 0 {
+			http.Error(w, "weight must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A reload that swaps the route in the meantime may have copied the
+	// backends' state before the change, so apply it again to the new route
+	for {
+		gw.mu.RLock()
+		rt := findRoute(gw.routes, prefix)
+		gw.mu.RUnlock()
+		if rt == nil {
+			http.Error(w, "unknown route", http.StatusNotFound)
+			return
+		}
+		if !rt.setWeightOverride(target, weight) {
+			http.Error(w, "unknown backend", http.StatusNotFound)
+			return
+		}
+		gw.mu.RLock()
+		current := findRoute(gw.routes, prefix) == rt
+		gw.mu.RUnlock()
+		if current {
+			break
+		}
+	}
+	if weight < 0 {
+		gw.log.Infow("backend weight override removed", "route", prefix, "backend", target)
+	} else {
+		gw.log.Infow("backend weight changed", "route", prefix, "backend", target, "weight", weight)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// backendState is the /backends/state response.
+type backendState struct {
+	URL      string `json:"url"`
+	State    string `json:"state"`
+	Inflight int64  `json:"inflight"`
+}
+
+// backendStateHandler puts a backend into draining or maintenance, or back
+// to active (?route=&backend=<url>&state=<state>). The state survives
+// reloads. The response reports the requests still in flight; a draining
+// backend turns drained, with a health event, once they have finished.
+func (gw *Gateway) backendStateHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, target := q.Get("route"), q.Get("backend")
+	state, err := loadbalancer.ParseAdminState(q.Get("state"))
+	if prefix == "" || target == "" || err != nil {
+		http.Error(w, "route, backend and state (active, draining or maintenance) are required", http.StatusBadRequest)
+		return
+	}
+
+	// As for weights, apply the state again if a reload swapped the route
+	var rt *route
+	var b *loadbalancer.Backend
+	var got loadbalancer.AdminState
+	for {
+		gw.mu.RLock()
+		rt = findRoute(gw.routes, prefix)
+		gw.mu.RUnlock()
+		if rt == nil {
+			http.Error(w, "unknown route", http.StatusNotFound)
+			return
+		}
+		if b, got = rt.setAdminState(target, state); b == nil {
+			http.Error(w, "unknown backend", http.StatusNotFound)
+			return
+		}
+		gw.mu.RLock()
+		current := findRoute(gw.routes, prefix) == rt
+		gw.mu.RUnlock()
+		if current {
+			break
+		}
+	}
+	gw.log.Infow("backend admin state changed", "route", prefix, "backend", target, "state", got)
+	if got == loadbalancer.StateDrained && state == loadbalancer.StateDraining {
+		rt.events.Publish(health.Event{Route: prefix, Backend: target, Type: health.EventDrained})
+	}
+	writeJSON(w, backendState{URL: b.URL, State: got.String(), Inflight: b.Inflight()})
+}
+
+// setAdminState sets the admin state of the backend at url and returns the
+// backend and the state it ended up in, or nil if there is none.
+func (rt *route) setAdminState(url string, state loadbalancer.AdminState) (*loadbalancer.Backend, loadbalancer.AdminState) {
+	rt.updateMu.Lock()
+	defer rt.updateMu.Unlock()
+	for _, b := range rt.lb.Backends() {
+		if b.URL == url {
+			return b, b.SetAdminState(state)
+		}
+	}
+	return nil, state
+}
+
+// setWeightOverride sets (or, with a negative weight, clears) the weight
+// override of the backend at url. It reports false if there is none.
+func (rt *route) setWeightOverride(url string, weight int) bool {
+	rt.updateMu.Lock()
+	defer rt.updateMu.Unlock()
+	found := false
+	cfgs := make([]config.BackendConfig, 0, len(rt.backends))
+	for _, b := range rt.lb.Backends() {
+		if b.URL == url {
+			b.SetWeightOverride(weight)
+			found = true
+		}
+		cfgs = append(cfgs, b.Config())
+	}
+	if found {
+		// Unchanged backends, but hash-based balancers rebuild their tables
+		// for the new weight
+		rt.lb.Update(cfgs)
+	}
+	return found
+}
+
+func findRoute(routes []*route, prefix string) *route {
+	for _, rt := range routes {
+		if rt.prefix == prefix {
+			return rt
+		}
+	}
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // Route construction
 // ---------------------------------------------------------------------------
 
-func buildRoutes(cfgs []config.RouteConfig, log *zap.SugaredLogger, authCfg *config.AuthConfig, traceStore *middleware.TraceStore) ([]*route, error) {
+// balancerConfig is everything a route's balancer is built from besides its
+// backends. Reload keeps a route's balancer while this is unchanged.
+type balancerConfig struct {
+	algorithm      string
+	hash           *config.HashConfig
+	locality       *config.LocalityConfig
+	slowStart      *config.SlowStartConfig
+	sticky         *config.StickyConfig
+	panicThreshold int
+	zone, region   string
+}
+
+func newBalancerConfig(cfg config.RouteConfig, server config.ServerConfig) balancerConfig {
+	return balancerConfig{
+		algorithm:      cfg.LBAlgorithm,
+		hash:           cfg.Hash,
+		locality:       cfg.Locality,
+		slowStart:      cfg.SlowStart,
+		sticky:         cfg.Sticky,
+		panicThreshold: cfg.PanicThreshold,
+		zone:           server.Zone,
+		region:         server.Region,
+	}
+}
+
+// buildRoutes builds cfgs, reusing the balancers and limiters of old routes
+// whose settings are unchanged. Reused balancers still have their old
+// backend list; see updateReused.
+func buildRoutes(cfgs []config.RouteConfig, server config.ServerConfig, log *zap.SugaredLogger, authCfg *config.AuthConfig, traceStore *middleware.TraceStore, events *health.Publisher, old []*route) ([]*route, error) {
+	prev := byPrefix(old)
 	routes := make([]*route, 0, len(cfgs))
 	for i, cfg := range cfgs {
-		r, err := buildRoute(cfg, log, authCfg, traceStore)
+		r, err := buildRoute(cfg, server, log, authCfg, traceStore, events, prev[cfg.PathPrefix])
 		if err != nil {
+			// The old routes stay live with their limiters and metrics
+			shared := limiters(old)
+			for _, r := range routes {
+				r.stop(shared, prev[r.prefix])
+			}
 			return nil, fmt.Errorf("route[%d] %q: %w", i, cfg.PathPrefix, err)
 		}
 		routes = append(routes, r)
@@ -183,32 +708,112 @@ func buildRoutes(cfgs []config.RouteConfig, log *zap.SugaredLogger, authCfg *con
 	return routes, nil
 }
 
-func buildRoute(cfg config.RouteConfig, log *zap.SugaredLogger, authCfg *config.AuthConfig, traceStore *middleware.TraceStore) (*route, error) {
-	lb := loadbalancer.New(cfg.LBAlgorithm, cfg.Backends)
+// buildRoute builds one route, taking over prev's balancer and limiter if
+// their settings match. prev may be nil. On error, everything it started is
+// stopped again.
+func buildRoute(cfg config.RouteConfig, server config.ServerConfig, log *zap.SugaredLogger, authCfg *config.AuthConfig, traceStore *middleware.TraceStore, events *health.Publisher, prev *route) (_ *route, err error) {
+	var cleanup []func()
+	defer func() {
+		if err != nil {
+			for _, stop := range cleanup {
+				stop()
+			}
+		}
+	}()
+
+	lbConfig := newBalancerConfig(cfg, server)
+	var lb loadbalancer.Balancer
+	var sticky *loadbalancer.Sticky
+	if prev != nil && reflect.DeepEqual(prev.lbConfig, lbConfig) {
+		lb, sticky = prev.lb, prev.sticky
+	} else {
+		seed := cfg
+		if prev != nil && cfg.Discovery != nil {
+			// Start from the backends discovered so far, not from none
+			seed.Backends = make([]config.BackendConfig, 0, len(prev.lb.Backends()))
+			for _, b := range prev.lb.Backends() {
+				seed.Backends = append(seed.Backends, b.Config())
+			}
+		}
+		if lb, sticky, err = newBalancer(seed, server, log); err != nil {
+			return nil, err
+		}
+	}
 
-	rl, err := ratelimiter.New(cfg.RateLimit)
+	var rl ratelimiter.Limiter
+	if prev != nil && reflect.DeepEqual(prev.rlCfg, cfg.RateLimit) {
+		rl = prev.rl
+	} else {
+		if rl, err = ratelimiter.New(cfg.RateLimit, cfg.PathPrefix, log); err != nil {
+			return nil, err
+		}
+		cleanup = append(cleanup, rl.Stop)
+	}
+
+	// Concurrency limits: one for the route, one per backend URL
+	inflight, err := concurrency.New(cfg.Concurrency, cfg.PathPrefix, "")
 	if err != nil {
 		return nil, err
 	}
-
-	// One circuit breaker per backend URL
-	breakers := make(map[string]*circuitbreaker.Breaker, len(cfg.Backends))
+	perBack := make(map[string]*concurrency.Limiter, len(cfg.Backends))
 	for _, b := range cfg.Backends {
-		breakers[b.URL] = circuitbreaker.New(cfg.CircuitBreaker)
+		if perBack[b.URL], err = concurrency.New(cfg.BackendConcurrency, cfg.PathPrefix, b.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	var source discovery.Provider
+	if cfg.Discovery != nil {
+		if source, err = discovery.New(cfg.Discovery, server.Zone, cfg.PathPrefix, log); err != nil {
+			return nil, err
+		}
+		cleanup = append(cleanup, source.Stop)
 	}
 
-	checker := health.New(lb.Backends(), log)
+	checker, err := health.New(cfg.HealthCheck, cfg.PathPrefix, lb.Backends(), events)
+	if err != nil {
+		return nil, err
+	}
+	cleanup = append(cleanup, checker.Stop)
+	outliers, err := health.NewOutlierDetector(cfg.OutlierDetection, cfg.PathPrefix, lb.Backends, events)
+	if err != nil {
+		return nil, err
+	}
+	outliers.Start()
+	cleanup = append(cleanup, outliers.Stop)
 
 	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
 
 	rt := &route{
-		prefix:   cfg.PathPrefix,
-		strip:    cfg.StripPrefix,
-		timeout:  timeout,
-		lb:       lb,
-		rl:       rl,
-		breakers: breakers,
-		checker:  checker,
+		prefix:     cfg.PathPrefix,
+		strip:      cfg.StripPrefix,
+		timeout:    timeout,
+		lb:         lb,
+		lbConfig:   lbConfig,
+		backends:   cfg.Backends,
+		sticky:     sticky,
+		rl:         rl,
+		rlCfg:      cfg.RateLimit,
+		rlStyle:    rateLimitHeaders(cfg.RateLimit),
+		costHdr:    costHeader(cfg.RateLimit),
+		breakers:   make(map[string]*circuitbreaker.Breaker, len(cfg.Backends)),
+		inflight:   inflight,
+		perBack:    perBack,
+		cbCfg:      cfg.CircuitBreaker,
+		perBackCfg: cfg.BackendConcurrency,
+		discovery:  source,
+		prioHdr:    priorityHeader(cfg),
+		prioClaim:  priorityClaim(cfg),
+		checker:    checker,
+		hcCfg:      cfg.HealthCheck,
+		outliers:   outliers,
+		events:     events,
+	}
+
+	// One circuit breaker per backend URL; discovered backends get theirs
+	// on first use
+	for _, b := range cfg.Backends {
+		rt.breaker(b.URL, log)
 	}
 
 	// Build the per-route handler chain
@@ -247,19 +852,121 @@ func buildRoute(cfg config.RouteConfig, log *zap.SugaredLogger, authCfg *config.
 	return rt, nil
 }
 
+// breaker returns the circuit breaker of the backend at url.
+func (rt *route) breaker(url string, log *zap.SugaredLogger) *circuitbreaker.Breaker {
+	rt.perBackendMu.RLock()
+	cb, ok := rt.breakers[url]
+	rt.perBackendMu.RUnlock()
+	if ok {
+		return cb
+	}
+	rt.perBackendMu.Lock()
+	defer rt.perBackendMu.Unlock()
+	if cb, ok = rt.breakers[url]; !ok {
+		var err error
+		if cb, err = circuitbreaker.New(rt.cbCfg); err != nil {
+			log.Errorw("circuit breaker disabled for backend", "route", rt.prefix, "backend", url, "err", err)
+		}
+		rt.breakers[url] = cb
+	}
+	return cb
+}
+
+// breakerState reports the state of the circuit breaker of the backend at
+// url without creating one: "none" if no request has needed it yet.
+func (rt *route) breakerState(url string) string {
+	rt.perBackendMu.RLock()
+	cb, ok := rt.breakers[url]
+	rt.perBackendMu.RUnlock()
+	if !ok {
+		return "none"
+	}
+	return cb.State()
+}
+
+// backendLimiter returns the concurrency limiter of the backend at url.
+func (rt *route) backendLimiter(url string, log *zap.SugaredLogger) *concurrency.Limiter {
+	rt.perBackendMu.RLock()
+	l, ok := rt.perBack[url]
+	rt.perBackendMu.RUnlock()
+	if ok {
+		return l
+	}
+	rt.perBackendMu.Lock()
+	defer rt.perBackendMu.Unlock()
+	if l, ok = rt.perBack[url]; !ok {
+		var err error
+		if l, err = concurrency.New(rt.perBackCfg, rt.prefix, url); err != nil {
+			log.Errorw("backend_concurrency disabled for discovered backend", "route", rt.prefix, "backend", url, "err", err)
+		}
+		rt.perBack[url] = l
+	}
+	return l
+}
+
+// newBalancer builds a route's balancer, wrapped for sticky sessions if
+// they are enabled.
+func newBalancer(cfg config.RouteConfig, server config.ServerConfig, log *zap.SugaredLogger) (loadbalancer.Balancer, *loadbalancer.Sticky, error) {
+	lb, err := loadbalancer.NewWithOptions(cfg.LBAlgorithm, cfg.Backends, loadbalancer.Options{
+		SlowStart:      cfg.SlowStart,
+		Hash:           cfg.Hash,
+		Locality:       cfg.Locality,
+		Zone:           server.Zone,
+		Region:         server.Region,
+		PanicThreshold: cfg.PanicThreshold,
+		Route:          cfg.PathPrefix,
+		Log:            log,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Sticky == nil {
+		return lb, nil, nil
+	}
+	sticky, err := loadbalancer.NewSticky(lb, cfg.Sticky)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sticky, sticky, nil
+}
+
 // serveProxy is the core proxy logic for one route.
 func (rt *route) serveProxy(w http.ResponseWriter, r *http.Request, log *zap.SugaredLogger) {
-	// Rate limiting
-	if err := rt.rl.Allow(r); err != nil {
+	// Rate limiting — quota headers go on every response, not just 429s
+	decision, err := rt.rl.Allow(r)
+	ratelimiter.SetHeaders(w.Header(), rt.rlStyle, decision)
+	if err != nil {
+		if errors.Is(err, ratelimiter.ErrKeyMissing) {
+			http.Error(w, "bad request — rate limit key missing", http.StatusBadRequest)
+			return
+		}
 		var rlErr *ratelimiter.ErrRateLimited
-		if errors.As(err, &rlErr) {
-			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", rlErr.RetryAfter.Seconds()))
-			w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(rlErr.RetryAfter).Unix()))
+		if !errors.As(err, &rlErr) {
+			http.Error(w, "service unavailable — rate limiter unavailable", http.StatusServiceUnavailable)
+			return
 		}
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", math.Ceil(rlErr.RetryAfter.Seconds())))
 		http.Error(w, "too many requests", http.StatusTooManyRequests)
 		return
 	}
 
+	// Route-wide concurrency limit; waits in the priority queue if configured
+	prio := rt.priority(r)
+	routeSlot, err := rt.inflight.Acquire(r.Context(), prio)
+	if err != nil {
+		shed(w)
+		return
+	}
+	// Only requests that reach a backend say anything about its latency
+	dropped, sent := false, false
+	defer func() {
+		if sent {
+			routeSlot.Done(dropped)
+		} else {
+			routeSlot.Release()
+		}
+	}()
+
 	// Pick backend
 	backend, err := rt.lb.Next(r)
 	if err != nil {
@@ -268,16 +975,37 @@ func (rt *route) serveProxy(w http.ResponseWriter, r *http.Request, log *zap.Sug
 		return
 	}
 
+	// The backend slot comes first: a half-open breaker hands out a limited
+	// number of probes, and one taken by a request shed here would never be
+	// recorded
+	backendSlot, err := rt.backendLimiter(backend.URL, log).Acquire(r.Context(), prio)
+	if err != nil {
+		shed(w)
+		return
+	}
+	defer func() {
+		if sent {
+			backendSlot.Done(dropped)
+		} else {
+			backendSlot.Release()
+		}
+	}()
+
 	// Circuit breaker check
-	cb := rt.breakers[backend.URL]
+	cb := rt.breaker(backend.URL, log)
 	if cbErr := cb.Allow(); cbErr != nil {
 		http.Error(w, "service unavailable — circuit open", http.StatusServiceUnavailable)
 		return
 	}
+	sent = true
 
-	// Track inflight for least_conn
+	// Track inflight for least_conn, p2c, peak_ewma and draining
 	backend.Inc()
-	defer backend.Dec()
+	defer func() {
+		if backend.Dec() {
+			rt.events.Publish(health.Event{Route: rt.prefix, Backend: backend.URL, Type: health.EventDrained})
+		}
+	}()
 
 	// Build target URL
 	targetURL, err := url.Parse(backend.URL)
@@ -287,6 +1015,7 @@ func (rt *route) serveProxy(w http.ResponseWriter, r *http.Request, log *zap.Sug
 	}
 
 	// Create a fresh reverse proxy per request (so we can set a per-request timeout)
+	start := time.Now()
 	proxy := &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
 			req.URL.Scheme = targetURL.Scheme
@@ -297,32 +1026,47 @@ func (rt *route) serveProxy(w http.ResponseWriter, r *http.Request, log *zap.Sug
 					req.URL.Path = "/"
 				}
 			}
-			// Propagate X-Forwarded-For
-			if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-				if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
-					clientIP = prior + ", " + clientIP
-				}
-				req.Header.Set("X-Forwarded-For", clientIP)
+			// X-Forwarded-For: ReverseProxy appends the peer address itself, so
+			// we only decide whether the incoming chain may be kept. A chain
+			// from an untrusted peer is client-controlled and is dropped.
+			if !clientip.FromTrustedProxy(req) {
+				req.Header.Del("X-Forwarded-For")
 			}
 			req.Header.Set("X-Forwarded-Host", req.Host)
 			req.Header.Set("X-Forwarded-Proto", scheme(req))
 		},
 		ModifyResponse: func(resp *http.Response) error {
-			// Record success / failure for circuit breaker based on HTTP status
+			// Record success / failure for circuit breaker based on HTTP status;
+			// outlier detection decides whether the backend leaves the pool.
+			latency := time.Since(start)
+			backend.ObserveLatency(latency)
+			rt.outliers.Record(backend, resp.StatusCode, latency)
 			if resp.StatusCode >= 500 {
-				cb.RecordFailure()
-				backend.SetAlive(false) // will be recovered by health checker
-			} else {
-				cb.RecordSuccess()
-				backend.SetAlive(true)
+				dropped = true
+			}
+			cb.Record(resp.StatusCode, latency)
+			if rt.costHdr != "" {
+				if n, err := strconv.Atoi(resp.Header.Get(rt.costHdr)); err == nil {
+					rt.rl.Settle(r, n)
+				}
+			}
+			if c := rt.sticky.Cookie(r, backend); c != nil {
+				resp.Header.Add("Set-Cookie", c.String())
 			}
 			resp.Header.Set("X-Gateway-Backend", backend.URL)
 			return nil
 		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			log.Errorw("upstream error", "backend", backend.URL, "err", err)
-			cb.RecordFailure()
-			backend.SetAlive(false)
+			if r.Context().Err() == nil { // a client hanging up is not the backend's fault
+				dropped = true
+				cb.RecordFailure()
+				latency := time.Since(start)
+				backend.ObserveLatency(latency) // timeouts count against peak_ewma
+				rt.outliers.Record(backend, 0, latency)
+			} else {
+				cb.Release()
+			}
 			http.Error(w, "bad gateway", http.StatusBadGateway)
 		},
 		// Per-request transport with configurable timeout
@@ -342,6 +1086,66 @@ func (rt *route) serveProxy(w http.ResponseWriter, r *http.Request, log *zap.Sug
 	proxy.ServeHTTP(w, r)
 }
 
+// shed rejects a request turned away by a concurrency limiter.
+func shed(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "service unavailable — overloaded", http.StatusServiceUnavailable)
+}
+
+// priority returns the priority class of r: from the JWT claim if one is
+// configured and present, else from the priority header if r comes from a
+// trusted proxy, else normal.
+func (rt *route) priority(r *http.Request) concurrency.Priority {
+	if rt.prioClaim != "" {
+		if v, ok := middleware.Claims(r)[rt.prioClaim].(string); ok {
+			return concurrency.ParsePriority(v)
+		}
+	}
+	if rt.prioHdr != "" && clientip.FromTrustedProxy(r) {
+		return concurrency.ParsePriority(r.Header.Get(rt.prioHdr))
+	}
+	return concurrency.PriorityNormal
+}
+
+// priorityHeader returns the priority header configured for a route's
+// concurrency limits, if any.
+func priorityHeader(cfg config.RouteConfig) string {
+	if cfg.Concurrency != nil && cfg.Concurrency.PriorityHeader != "" {
+		return cfg.Concurrency.PriorityHeader
+	}
+	if cfg.BackendConcurrency != nil {
+		return cfg.BackendConcurrency.PriorityHeader
+	}
+	return ""
+}
+
+// priorityClaim is priorityHeader for the priority claim.
+func priorityClaim(cfg config.RouteConfig) string {
+	if cfg.Concurrency != nil && cfg.Concurrency.PriorityClaim != "" {
+		return cfg.Concurrency.PriorityClaim
+	}
+	if cfg.BackendConcurrency != nil {
+		return cfg.BackendConcurrency.PriorityClaim
+	}
+	return ""
+}
+
+// rateLimitHeaders returns the header style for a route's rate limit config.
+func rateLimitHeaders(cfg *config.RateLimitConfig) string {
+	if cfg == nil || cfg.Headers == "" {
+		return ratelimiter.HeadersLegacy
+	}
+	return cfg.Headers
+}
+
+// costHeader returns the response header carrying the actual request cost.
+func costHeader(cfg *config.RateLimitConfig) string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.CostHeader
+}
+
 func scheme(r *http.Request) string {
 	if r.TLS != nil {
 		return "https"
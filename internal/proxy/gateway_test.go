@@ -0,0 +1,672 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/circuitbreaker"
+	"github.com/sneha4175/gateway-pro/internal/clientip"
+	"github.com/sneha4175/gateway-pro/internal/concurrency"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/health"
+	"github.com/sneha4175/gateway-pro/internal/middleware"
+	"go.uber.org/zap"
+)
+
+func TestBackendHealthAdmin(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{
+		{
+			PathPrefix:  "/api",
+			Backends:    []config.BackendConfig{{URL: backend.URL}},
+			HealthCheck: &config.HealthCheckConfig{Interval: "1h", Jitter: "0s"},
+		},
+		{PathPrefix: "/other", Backends: []config.BackendConfig{{URL: backend.URL}}},
+	}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	mux := http.NewServeMux()
+	gw.RegisterAdminHandlers(mux)
+
+	type result struct {
+		Route    string
+		Backends []backendHealth
+	}
+	var got []result
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec := serveAdmin(mux, "GET", "/backends/health?route=/api")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		got = nil
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(got) == 1 && len(got[0].Backends) == 1 && len(got[0].Backends[0].History) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("startup check never appeared in history: %+v", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	b := got[0].Backends[0]
+	if got[0].Route != "/api" || b.URL != backend.URL || !b.Alive || b.Ejected || b.History[0].Result != "pass" {
+		t.Fatalf("unexpected backend health: %+v", got)
+	}
+	if rec := serveAdmin(mux, "GET", "/backends/health?route=/missing"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown route, got %d", rec.Code)
+	}
+	if rec := serveAdmin(mux, "GET", "/backends/health"); rec.Code != http.StatusOK {
+		t.Fatalf("expected all routes, got %d", rec.Code)
+	}
+}
+
+func TestReload_SlowStartsAddedBackends(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+	added := backend.URL + "/b2"
+
+	routeCfg := func(urls ...string) config.RouteConfig {
+		rc := config.RouteConfig{PathPrefix: "/api", SlowStart: &config.SlowStartConfig{Window: "30s"}}
+		for _, u := range urls {
+			rc.Backends = append(rc.Backends, config.BackendConfig{URL: u, Weight: 1})
+		}
+		return rc
+	}
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{routeCfg(backend.URL)}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	if err := gw.Reload(&config.Config{Routes: []config.RouteConfig{
+		routeCfg(backend.URL, added),
+		{PathPrefix: "/new", Backends: []config.BackendConfig{{URL: backend.URL}}},
+	}}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	for _, rt := range gw.routes {
+		for _, b := range rt.lb.Backends() {
+			warming := !b.AvailableSince().IsZero()
+			if want := b.URL == added; warming != want {
+				t.Errorf("route %s backend %s: slow start %v, want %v", rt.prefix, b.URL, warming, want)
+			}
+		}
+	}
+}
+
+func TestStickySessions(t *testing.T) {
+	var backends []string
+	for i := 0; i < 3; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+		defer srv.Close()
+		backends = append(backends, srv.URL)
+	}
+	rc := config.RouteConfig{PathPrefix: "/app", Sticky: &config.StickyConfig{Secret: "s3cret"}}
+	for _, u := range backends {
+		rc.Backends = append(rc.Backends, config.BackendConfig{URL: u, Weight: 1})
+	}
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{rc}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+
+	get := func(cookies ...*http.Cookie) *http.Response {
+		r := httptest.NewRequest("GET", "/app/x", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, r)
+		return rec.Result()
+	}
+
+	first := get()
+	if len(first.Cookies()) != 1 {
+		t.Fatalf("expected a sticky cookie on the first response, got %v", first.Header["Set-Cookie"])
+	}
+	cookie := first.Cookies()[0]
+	pinned := first.Header.Get("X-Gateway-Backend")
+	for i := 0; i < 5; i++ {
+		resp := get(cookie)
+		if got := resp.Header.Get("X-Gateway-Backend"); got != pinned {
+			t.Fatalf("request %d went to %s, want pinned %s", i, got, pinned)
+		}
+		if len(resp.Cookies()) != 0 {
+			t.Fatal("a valid cookie should not be set again")
+		}
+	}
+
+	for _, b := range gw.routes[0].lb.Backends() {
+		if b.URL == pinned {
+			b.SetEjected(true) // not touched by the startup health check
+		}
+	}
+	resp := get(cookie)
+	if resp.Header.Get("X-Gateway-Backend") == pinned || len(resp.Cookies()) != 1 {
+		t.Fatal("expected failover to another backend with a rewritten cookie")
+	}
+}
+
+func TestReload_KeepsUnchangedBalancers(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+
+	routes := func(alg string, urls ...string) *config.Config {
+		rc := config.RouteConfig{PathPrefix: "/api", LBAlgorithm: alg}
+		for _, u := range urls {
+			rc.Backends = append(rc.Backends, config.BackendConfig{URL: u, Weight: 1})
+		}
+		return &config.Config{Routes: []config.RouteConfig{rc}}
+	}
+	gw, err := NewGateway(routes("weighted", backend.URL), zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	lb := gw.routes[0].lb
+	kept := lb.Backends()[0]
+	kept.Inc()
+
+	if err := gw.Reload(routes("weighted", backend.URL, backend.URL+"/b2")); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if gw.routes[0].lb != lb {
+		t.Fatal("balancer rebuilt although its settings did not change")
+	}
+	if bs := lb.Backends(); len(bs) != 2 || bs[0] != kept || kept.Inflight() != 1 {
+		t.Fatalf("backend state lost on reload: %v", bs)
+	}
+
+	if err := gw.Reload(routes("least_conn", backend.URL)); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if gw.routes[0].lb == lb {
+		t.Fatal("balancer kept although lb_algorithm changed")
+	}
+}
+
+func TestReload_KeepsHealthHistory(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+
+	cfg := func() *config.Config {
+		return &config.Config{Routes: []config.RouteConfig{{
+			PathPrefix:  "/api",
+			LBAlgorithm: "round_robin",
+			Backends:    []config.BackendConfig{{URL: backend.URL, Weight: 1}},
+			HealthCheck: &config.HealthCheckConfig{Interval: "1h", Jitter: "0s"},
+		}}}
+	}
+	gw, err := NewGateway(cfg(), zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	history := func() []health.ProbeResult {
+		rt := gw.routes[0]
+		return rt.checker.History(rt.lb.Backends()[0])
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(history()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no startup health check recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reloaded := time.Now()
+	if err := gw.Reload(cfg()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if h := history(); len(h) == 0 || !h[0].Time.Before(reloaded) {
+		t.Fatal("probe history lost on a reload that kept health_check")
+	}
+}
+
+func TestBackendWeightAdmin(t *testing.T) {
+	var urls []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	rc := config.RouteConfig{PathPrefix: "/api", LBAlgorithm: "weighted"}
+	for _, u := range urls {
+		rc.Backends = append(rc.Backends, config.BackendConfig{URL: u, Weight: 1})
+	}
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{rc}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	mux := http.NewServeMux()
+	gw.RegisterAdminHandlers(mux)
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"route=/api&backend=" + urls[0] + "&weight=-1", http.StatusBadRequest},
+		{"route=/api&backend=" + urls[0], http.StatusBadRequest},
+		{"route=/missing&backend=" + urls[0] + "&weight=1", http.StatusNotFound},
+		{"route=/api&backend=http://nowhere&weight=1", http.StatusNotFound},
+		{"route=/api&backend=" + urls[0] + "&weight=0", http.StatusNoContent},
+	} {
+		if rec := serveAdmin(mux, "PUT", "/backends/weight?"+tc.query); rec.Code != tc.code {
+			t.Fatalf("PUT ?%s: status %d, want %d", tc.query, rec.Code, tc.code)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+		if got := rec.Header().Get("X-Gateway-Backend"); got != urls[1] {
+			t.Fatalf("request %d went to %s after draining it", i, got)
+		}
+	}
+	if w := gw.routes[0].lb.Backends()[0].Weight(); w != 0 {
+		t.Fatalf("weight = %d, want 0", w)
+	}
+
+	// The override survives updates and reloads that rebuild the balancer
+	rc.Backends[0].Weight = 3
+	if err := gw.Reload(&config.Config{Routes: []config.RouteConfig{rc}}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	rc.LBAlgorithm = "least_conn"
+	if err := gw.Reload(&config.Config{Routes: []config.RouteConfig{rc}}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if w := gw.routes[0].lb.Backends()[0].Weight(); w != 0 {
+		t.Fatalf("weight = %d after reloads, want the override 0", w)
+	}
+	if rec := serveAdmin(mux, "DELETE", "/backends/weight?route=/api&backend="+urls[0]); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d", rec.Code)
+	}
+	if w := gw.routes[0].lb.Backends()[0].Weight(); w != 3 {
+		t.Fatalf("weight = %d after removing the override, want the configured 3", w)
+	}
+}
+
+func TestBreakerStateDoesNotCreateBreakers(t *testing.T) {
+	rt := &route{breakers: map[string]*circuitbreaker.Breaker{}, cbCfg: &config.CircuitBreakerConfig{}}
+	if got := rt.breakerState("http://discovered"); got != "none" || len(rt.breakers) != 0 {
+		t.Fatalf("breakerState = %q with %d breakers, want none and 0", got, len(rt.breakers))
+	}
+	rt.breaker("http://discovered", zap.NewNop().Sugar())
+	if got := rt.breakerState("http://discovered"); got != "closed" {
+		t.Fatalf("breakerState = %q, want closed", got)
+	}
+}
+
+func TestBackendStateAdmin(t *testing.T) {
+	var urls []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	routes := func(alg string) *config.Config {
+		rc := config.RouteConfig{PathPrefix: "/api", LBAlgorithm: alg}
+		for _, u := range urls {
+			rc.Backends = append(rc.Backends, config.BackendConfig{URL: u, Weight: 1})
+		}
+		return &config.Config{Routes: []config.RouteConfig{rc}}
+	}
+	gw, err := NewGateway(routes("round_robin"), zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	mux := http.NewServeMux()
+	gw.RegisterAdminHandlers(mux)
+
+	if rec := serveAdmin(mux, "PUT", "/backends/state?route=/api&backend="+urls[0]+"&state=drained"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("drained is not settable, got %d", rec.Code)
+	}
+	if rec := serveAdmin(mux, "PUT", "/backends/state?route=/api&backend=http://nowhere&state=draining"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown backend, got %d", rec.Code)
+	}
+
+	// Drain with one request in flight: drained once it completes
+	drained := gw.routes[0].lb.Backends()[0]
+	drained.Inc()
+	rec := serveAdmin(mux, "PUT", "/backends/state?route=/api&backend="+urls[0]+"&state=draining")
+	var st backendState
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil || st.State != "draining" || st.Inflight != 1 {
+		t.Fatalf("drain response %d %s", rec.Code, rec.Body)
+	}
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+		if got := rec.Header().Get("X-Gateway-Backend"); got != urls[1] {
+			t.Fatalf("request %d went to %s while it was draining", i, got)
+		}
+	}
+	if !drained.Dec() || drained.AdminState().String() != "drained" {
+		t.Fatalf("state after the last request = %v", drained.AdminState())
+	}
+
+	// A reload that rebuilds the balancer keeps the state
+	serveAdmin(mux, "PUT", "/backends/state?route=/api&backend="+urls[1]+"&state=maintenance")
+	if err := gw.Reload(routes("least_conn")); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	bs := gw.routes[0].lb.Backends()
+	if bs[0] == drained || bs[0].AdminState().String() != "drained" || bs[1].AdminState().String() != "maintenance" {
+		t.Fatalf("admin state lost on reload: %v, %v", bs[0].AdminState(), bs[1].AdminState())
+	}
+}
+
+func TestDiscoveredBackends(t *testing.T) {
+	old := discoveryWait
+	discoveryWait = 100 * time.Millisecond
+	t.Cleanup(func() { discoveryWait = old })
+
+	var urls []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{{
+		PathPrefix:     "/svc",
+		Backends:       []config.BackendConfig{{URL: urls[0], Weight: 1}},
+		CircuitBreaker: &config.CircuitBreakerConfig{},
+		// Nothing answers here; the static backend keeps serving
+		Discovery: &config.DiscoveryConfig{DNS: &config.DNSDiscoveryConfig{
+			Name: "svc.internal", Port: 80, Server: "127.0.0.1:1", Timeout: "50ms",
+		}},
+	}}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	defer gw.routes[0].discovery.Stop()
+	get := func() string {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest("GET", "/svc/x", nil))
+		return rec.Header().Get("X-Gateway-Backend")
+	}
+	if got := get(); got != urls[0] {
+		t.Fatalf("request went to %q before discovery, want the static backend", got)
+	}
+
+	rt := gw.routes[0]
+	rt.setBackends([]config.BackendConfig{{URL: urls[1], Weight: 1}})
+	if got := get(); got != urls[1] {
+		t.Fatalf("request went to %q, want the discovered backend", got)
+	}
+	if _, ok := rt.breakers[urls[1]]; !ok {
+		t.Fatal("no circuit breaker created for the discovered backend")
+	}
+	if _, ok := rt.breakers[urls[0]]; ok {
+		t.Fatal("circuit breaker of the removed backend kept")
+	}
+}
+
+func TestDiscovery_RoutesGoLiveWithBackends(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "svc.json")
+	data := fmt.Sprintf(`[{"url": %q}, {"url": %q}]`, srv.URL, srv.URL+"/b")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	routes := func(alg string) *config.Config {
+		return &config.Config{Routes: []config.RouteConfig{{
+			PathPrefix:  "/svc",
+			LBAlgorithm: alg,
+			SlowStart:   &config.SlowStartConfig{Window: "30s"},
+			Discovery:   &config.DiscoveryConfig{File: &config.FileDiscoveryConfig{Path: path}},
+		}}}
+	}
+	serving := func(gw *Gateway) {
+		t.Helper()
+		bs := gw.routes[0].lb.Backends()
+		if len(bs) != 2 {
+			t.Fatalf("route live with %d backends, want the 2 discovered", len(bs))
+		}
+		for _, b := range bs {
+			if !b.AvailableSince().IsZero() {
+				t.Errorf("backend %s in slow start, want full weight", b.URL)
+			}
+		}
+	}
+
+	gw, err := NewGateway(routes("round_robin"), zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	defer func() { gw.routes[0].discovery.Stop() }()
+	serving(gw)
+
+	// A reload that rebuilds the balancer keeps serving the same backends
+	if err := gw.Reload(routes("least_conn")); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	serving(gw)
+}
+
+func TestReload_IgnoresStaleDiscovery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "svc.json")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(`[{"url": %q}]`, srv.URL)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Routes: []config.RouteConfig{{
+		PathPrefix: "/svc",
+		Discovery:  &config.DiscoveryConfig{File: &config.FileDiscoveryConfig{Path: path}},
+	}}}
+	gw, err := NewGateway(cfg, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	defer func() { gw.routes[0].discovery.Stop() }()
+	old := gw.routes[0]
+	if err := gw.Reload(cfg); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if gw.routes[0].lb != old.lb {
+		t.Fatal("balancer rebuilt although its settings did not change")
+	}
+
+	// A lookup the old provider had in flight lands after the reload
+	old.setBackends([]config.BackendConfig{{URL: srv.URL + "/stale", Weight: 1}})
+	if bs := gw.routes[0].lb.Backends(); len(bs) != 1 || bs[0].URL != srv.URL {
+		t.Fatalf("stale update from the replaced route applied: %v", bs)
+	}
+}
+
+func TestDiscoverySources(t *testing.T) {
+	for name, d := range map[string]*config.DiscoveryConfig{
+		"none": {},
+		"both": {
+			DNS:        &config.DNSDiscoveryConfig{Name: "svc.internal", Port: 80},
+			Kubernetes: &config.KubernetesDiscoveryConfig{Service: "svc", APIServer: "http://127.0.0.1:1"},
+		},
+	} {
+		_, err := NewGateway(&config.Config{Routes: []config.RouteConfig{{PathPrefix: "/svc", Discovery: d}}}, zap.NewNop().Sugar(), nil, nil)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCircuitBreaker_FailureStatusCodes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer backend.Close()
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{{
+		PathPrefix: "/svc",
+		Backends:   []config.BackendConfig{{URL: backend.URL, Weight: 1}},
+		CircuitBreaker: &config.CircuitBreakerConfig{
+			ConsecutiveFailures: 2, FailureStatusCodes: []string{"5xx", "429"},
+		},
+	}}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	for i, want := range []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest("GET", "/svc/x", nil))
+		if rec.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	if state := gw.routes[0].breaker(backend.URL, zap.NewNop().Sugar()).State(); state != "open" {
+		t.Fatalf("breaker %s after two 429s in a row, want open", state)
+	}
+
+	// Bad settings fail the config load, before any route is built
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	data := "routes:\n  - path_prefix: /svc\n    backends: [{url: " + backend.URL + "}]\n" +
+		"    circuit_breaker: {failure_status_codes: [teapot]}\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := config.LoadAndWatch(path, zap.NewNop().Sugar()); err == nil || !strings.Contains(err.Error(), "failure_status_codes") {
+		t.Fatalf("expected an error for a bad failure status code, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_ShedRequestKeepsProbe(t *testing.T) {
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() && r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{{
+		PathPrefix:         "/svc",
+		Backends:           []config.BackendConfig{{URL: backend.URL, Weight: 1}},
+		CircuitBreaker:     &config.CircuitBreakerConfig{ConsecutiveFailures: 1, OpenDurationSeconds: 1, HalfOpenRequests: 1},
+		BackendConcurrency: &config.ConcurrencyConfig{Limit: 1},
+	}}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	get := func() int {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest("GET", "/svc/x", nil))
+		return rec.Code
+	}
+	if code := get(); code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", code)
+	}
+	time.Sleep(1100 * time.Millisecond) // open -> half-open
+
+	// The backend is at its limit: requests are shed without using probes
+	rt := gw.routes[0]
+	slot, err := rt.backendLimiter(backend.URL, zap.NewNop().Sugar()).Acquire(context.Background(), concurrency.PriorityNormal)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if code := get(); code != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want 503 from the backend limit", code)
+		}
+	}
+	slot.Done(false)
+
+	healthy.Store(true)
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("status %d, want the half-open probe to reach the backend", code)
+	}
+}
+
+func TestCircuitBreaker_IgnoresClientCancel(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			<-r.Context().Done()
+		}
+	}))
+	defer backend.Close()
+	gw, err := NewGateway(&config.Config{Routes: []config.RouteConfig{{
+		PathPrefix:     "/svc",
+		Backends:       []config.BackendConfig{{URL: backend.URL, Weight: 1}},
+		CircuitBreaker: &config.CircuitBreakerConfig{ConsecutiveFailures: 1},
+	}}}, zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	gw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/svc/x", nil).WithContext(ctx))
+
+	if state := gw.routes[0].breakerState(backend.URL); state != "closed" {
+		t.Fatalf("breaker %s after the client hung up, want closed", state)
+	}
+}
+
+func TestRoutePriority(t *testing.T) {
+	rt := &route{prioHdr: "X-Priority", prioClaim: "priority"}
+	resolver, err := clientip.New([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("clientip.New: %v", err)
+	}
+	req := func(peer string, claims map[string]any) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = peer + ":1234"
+		r.Header.Set("X-Priority", "high")
+		if claims != nil {
+			r = middleware.WithClaims(r, claims)
+		}
+		return resolver.WithClientIP(r)
+	}
+
+	if p := rt.priority(req("203.0.113.7", nil)); p != concurrency.PriorityNormal {
+		t.Errorf("client-set priority header honoured: %v", p)
+	}
+	if p := rt.priority(req("10.1.2.3", nil)); p != concurrency.PriorityHigh {
+		t.Errorf("priority header from a trusted proxy ignored: %v", p)
+	}
+	if p := rt.priority(req("203.0.113.7", map[string]any{"priority": "low"})); p != concurrency.PriorityLow {
+		t.Errorf("priority claim ignored: %v", p)
+	}
+}
+
+func TestBuildRoutes_StopsRoutesOnError(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+
+	before := runtime.NumGoroutine()
+	_, err := NewGateway(&config.Config{Routes: []config.RouteConfig{
+		{
+			PathPrefix:       "/a",
+			Backends:         []config.BackendConfig{{URL: backend.URL}},
+			OutlierDetection: &config.OutlierDetectionConfig{},
+		},
+		{
+			PathPrefix:  "/b",
+			Backends:    []config.BackendConfig{{URL: backend.URL}},
+			HealthCheck: &config.HealthCheckConfig{Interval: "often"},
+		},
+	}}, zap.NewNop().Sugar(), nil, nil)
+	if err == nil {
+		t.Fatal("expected an error for the bad health_check")
+	}
+
+	// The first route's health checker and outlier detector are stopped
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines = %d after a failed build, want at most %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/ratelimiter"
+)
+
+// ---------------------------------------------------------------------------
+// Rate-limit admin endpoints
+//
+// Every endpoint takes ?route=<path_prefix>&key=<key>, where key is in the
+// form the limiter builds from key_by, e.g. "ip:203.0.113.7" or
+// "claim:tenant_id:acme+method:POST".
+// ---------------------------------------------------------------------------
+
+func (gw *Gateway) registerRateLimitHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /ratelimit/key", gw.rateLimitKeyHandler)
+	mux.HandleFunc("DELETE /ratelimit/key", gw.rateLimitResetHandler)
+	mux.HandleFunc("GET /ratelimit/hot", gw.rateLimitHotHandler)
+	mux.HandleFunc("PUT /ratelimit/override", gw.rateLimitOverrideHandler)
+	mux.HandleFunc("DELETE /ratelimit/override", gw.rateLimitOverrideHandler)
+}
+
+// rateLimitKeyHandler reports the quota left for one key.
+func (gw *Gateway) rateLimitKeyHandler(w http.ResponseWriter, r *http.Request) {
+	insp, key, ok := gw.inspector(w, r, true)
+	if !ok {
+		return
+	}
+	st, err := insp.Inspect(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, st)
+}
+
+// rateLimitHotHandler lists the keys closest to their limit (?n=, default 20).
+func (gw *Gateway) rateLimitHotHandler(w http.ResponseWriter, r *http.Request) {
+	insp, _, ok := gw.inspector(w, r, false)
+	if !ok {
+		return
+	}
+	n := 20
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	states, err := insp.Hottest(r.Context(), n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, states)
+}
+
+// rateLimitResetHandler restores a key's full quota.
+func (gw *Gateway) rateLimitResetHandler(w http.ResponseWriter, r *http.Request) {
+	insp, key, ok := gw.inspector(w, r, true)
+	if !ok {
+		return
+	}
+	if err := insp.Reset(r.Context(), key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rateLimitOverrideHandler exempts or blocks a key (PUT with ?mode=exempt|block
+// &ttl=<duration>) or lifts an override (DELETE).
+func (gw *Gateway) rateLimitOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	insp, key, ok := gw.inspector(w, r, true)
+	if !ok {
+		return
+	}
+	var mode string
+	var ttl time.Duration
+	if r.Method == http.MethodPut {
+		mode = r.URL.Query().Get("mode")
+		if mode != ratelimiter.OverrideExempt && mode != ratelimiter.OverrideBlock {
+			http.Error(w, "mode must be exempt or block", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if ttl, err = time.ParseDuration(r.URL.Query().Get("ttl")); err != nil || ttl <= 0 {
+			http.Error(w, "ttl must be a positive duration, e.g. 15m", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := insp.Override(r.Context(), key, mode, ttl); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inspector resolves the route and key parameters, writing an error response
+// and returning ok=false if they are missing or the route has no rate limit.
+func (gw *Gateway) inspector(w http.ResponseWriter, r *http.Request, needKey bool) (insp ratelimiter.Inspector, key string, ok bool) {
+	prefix, key := r.URL.Query().Get("route"), r.URL.Query().Get("key")
+	if prefix == "" || (needKey && key == "") {
+		http.Error(w, "route and key parameters are required", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	gw.mu.RLock()
+	routes := gw.routes
+	gw.mu.RUnlock()
+	for _, rt := range routes {
+		if rt.prefix != prefix {
+			continue
+		}
+		if insp, ok := rt.rl.(ratelimiter.Inspector); ok {
+			return insp, key, true
+		}
+		http.Error(w, "route has no rate limit", http.StatusNotFound)
+		return nil, "", false
+	}
+	http.Error(w, "unknown route", http.StatusNotFound)
+	return nil, "", false
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/ratelimiter"
+	"go.uber.org/zap"
+)
+
+func newRateLimitAdmin(t *testing.T) (*Gateway, *http.ServeMux) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	t.Cleanup(backend.Close)
+
+	gw, err := NewGateway(rateLimitAdminConfig(backend.URL, 2), zap.NewNop().Sugar(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+	mux := http.NewServeMux()
+	gw.RegisterAdminHandlers(mux)
+	return gw, mux
+}
+
+func rateLimitAdminConfig(backend string, burst int) *config.Config {
+	return &config.Config{Routes: []config.RouteConfig{
+		{
+			PathPrefix: "/api",
+			Backends:   []config.BackendConfig{{URL: backend}},
+			RateLimit:  &config.RateLimitConfig{Algorithm: "token_bucket", Rate: 1, Burst: burst, KeyBy: "ip"},
+		},
+		{
+			PathPrefix: "/open",
+			Backends:   []config.BackendConfig{{URL: backend}},
+		},
+	}}
+}
+
+func serveAdmin(mux *http.ServeMux, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestRateLimitAdmin_InspectResetOverride(t *testing.T) {
+	gw, mux := newRateLimitAdmin(t)
+
+	proxied := func() int {
+		r := httptest.NewRequest("GET", "/api/x", nil)
+		r.RemoteAddr = "203.0.113.7:5000"
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	proxied()
+	proxied()
+	if code := proxied(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the burst is spent, got %d", code)
+	}
+
+	rec := serveAdmin(mux, "GET", "/ratelimit/key?route=/api&key=ip:203.0.113.7")
+	var st ratelimiter.KeyState
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expected key state, got %d: %v", rec.Code, err)
+	}
+	if st.Limit != 2 || st.Remaining != 0 {
+		t.Errorf("expected an exhausted bucket, got %+v", st)
+	}
+
+	rec = serveAdmin(mux, "GET", "/ratelimit/hot?route=/api&n=5")
+	var hot []ratelimiter.KeyState
+	if err := json.NewDecoder(rec.Body).Decode(&hot); err != nil || len(hot) != 1 || hot[0].Key != "ip:203.0.113.7" {
+		t.Errorf("expected the client among the hottest keys, got %+v, %v", hot, err)
+	}
+
+	if rec := serveAdmin(mux, "DELETE", "/ratelimit/key?route=/api&key=ip:203.0.113.7"); rec.Code != http.StatusNoContent {
+		t.Fatalf("reset: expected 204, got %d", rec.Code)
+	}
+	if code := proxied(); code == http.StatusTooManyRequests {
+		t.Fatal("expected the key to be allowed after a reset")
+	}
+
+	if rec := serveAdmin(mux, "PUT", "/ratelimit/override?route=/api&key=ip:203.0.113.7&mode=block&ttl=1m"); rec.Code != http.StatusNoContent {
+		t.Fatalf("block: expected 204, got %d", rec.Code)
+	}
+	if code := proxied(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected blocked key to get 429, got %d", code)
+	}
+	if rec := serveAdmin(mux, "DELETE", "/ratelimit/override?route=/api&key=ip:203.0.113.7"); rec.Code != http.StatusNoContent {
+		t.Fatalf("unblock: expected 204, got %d", rec.Code)
+	}
+	if code := proxied(); code == http.StatusTooManyRequests {
+		t.Fatal("expected unblocked key to be allowed")
+	}
+}
+
+func TestRateLimitAdmin_BadRequests(t *testing.T) {
+	_, mux := newRateLimitAdmin(t)
+
+	cases := []struct {
+		method, target string
+		want           int
+	}{
+		{"GET", "/ratelimit/key?route=/api", http.StatusBadRequest},
+		{"GET", "/ratelimit/key?route=/nope&key=ip:1.2.3.4", http.StatusNotFound},
+		{"GET", "/ratelimit/key?route=/open&key=ip:1.2.3.4", http.StatusNotFound},
+		{"GET", "/ratelimit/hot?route=/api&n=0", http.StatusBadRequest},
+		{"PUT", "/ratelimit/override?route=/api&key=ip:1.2.3.4&mode=allow&ttl=1m", http.StatusBadRequest},
+		{"PUT", "/ratelimit/override?route=/api&key=ip:1.2.3.4&mode=block", http.StatusBadRequest},
+		{"POST", "/ratelimit/key?route=/api&key=ip:1.2.3.4", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range cases {
+		if rec := serveAdmin(mux, tc.method, tc.target); rec.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.target, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestReload_KeepsUnchangedLimiters(t *testing.T) {
+	gw, mux := newRateLimitAdmin(t)
+	backend := gw.routes[0].backends[0].URL
+	inspect := func(key string) ratelimiter.KeyState {
+		t.Helper()
+		var st ratelimiter.KeyState
+		rec := serveAdmin(mux, "GET", "/ratelimit/key?route=/api&key="+key)
+		if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+			t.Fatalf("inspect %s: %d: %v", key, rec.Code, err)
+		}
+		return st
+	}
+
+	r := httptest.NewRequest("GET", "/api/x", nil)
+	r.RemoteAddr = "203.0.113.7:5000"
+	gw.ServeHTTP(httptest.NewRecorder(), r)
+	serveAdmin(mux, "PUT", "/ratelimit/override?route=/api&key=ip:198.51.100.1&mode=block&ttl=1m")
+
+	if err := gw.Reload(rateLimitAdminConfig(backend, 2)); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if st := inspect("ip:203.0.113.7"); st.Remaining != 1 {
+		t.Errorf("bucket lost on a reload that kept rate_limit: %+v", st)
+	}
+	if st := inspect("ip:198.51.100.1"); st.Override != ratelimiter.OverrideBlock {
+		t.Errorf("override lost on a reload that kept rate_limit: %+v", st)
+	}
+
+	if err := gw.Reload(rateLimitAdminConfig(backend, 3)); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if st := inspect("ip:203.0.113.7"); st.Limit != 3 || st.Remaining != 3 {
+		t.Errorf("expected a fresh limiter after rate_limit changed, got %+v", st)
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+// ---------------------------------------------------------------------------
+// Request cost
+//
+// Expensive endpoints can be weighted so one call consumes several tokens.
+// The first matching rule in rate_limit.costs wins; otherwise the route's
+// default cost applies.
+// ---------------------------------------------------------------------------
+
+type costRule struct {
+	method string // "" matches any
+	glob   string // path.Match pattern
+	prefix string // set when the pattern ends in "/**"
+	cost   int
+}
+
+type coster struct {
+	rules []costRule
+	def   int
+	max   int // largest cost the algorithm can admit
+}
+
+// newCoster validates the cost rules against the largest cost the algorithm
+// could ever admit, so misconfigured weights fail at load time instead of
+// rejecting every request.
+func newCoster(cfg *config.RateLimitConfig, maxCost int) (*coster, error) {
+	c := &coster{def: max(cfg.Cost, 1), max: maxCost}
+	if c.def > maxCost {
+		return nil, fmt.Errorf("cost %d exceeds the limit of %d", c.def, maxCost)
+	}
+	for i, rc := range cfg.Costs {
+		if rc.Cost < 1 || rc.Cost > maxCost {
+			return nil, fmt.Errorf("costs[%d]: cost must be between 1 and %d, got %d", i, maxCost, rc.Cost)
+		}
+		rule := costRule{method: strings.ToUpper(rc.Method), cost: rc.Cost}
+		if p, ok := strings.CutSuffix(rc.Path, "/**"); ok {
+			rule.prefix = p + "/"
+		} else {
+			if _, err := path.Match(rc.Path, "/"); err != nil {
+				return nil, fmt.Errorf("costs[%d]: bad path pattern %q: %w", i, rc.Path, err)
+			}
+			rule.glob = rc.Path
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c, nil
+}
+
+// cost returns the number of tokens r consumes.
+func (c *coster) cost(r *http.Request) int {
+	for _, rule := range c.rules {
+		if rule.method != "" && rule.method != r.Method {
+			continue
+		}
+		if rule.prefix != "" {
+			if strings.HasPrefix(r.URL.Path+"/", rule.prefix) {
+				return rule.cost
+			}
+			continue
+		}
+		if ok, _ := path.Match(rule.glob, r.URL.Path); ok {
+			return rule.cost
+		}
+	}
+	return c.def
+}
@@ -0,0 +1,163 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestCoster_FirstMatchWins(t *testing.T) {
+	c, err := newCoster(&config.RateLimitConfig{
+		Cost: 2,
+		Costs: []config.CostRule{
+			{Method: "post", Path: "/api/search", Cost: 10},
+			{Path: "/api/export/**", Cost: 50},
+			{Path: "/api/*/report", Cost: 5},
+			{Path: "/api/**", Cost: 3},
+		},
+	}, 100)
+	if err != nil {
+		t.Fatalf("newCoster: %v", err)
+	}
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{"POST", "/api/search", 10},
+		{"GET", "/api/search", 3},
+		{"GET", "/api/export", 50},
+		{"GET", "/api/export/csv/all", 50},
+		{"GET", "/api/users/report", 5},
+		{"GET", "/api/users/report/x", 3},
+		{"GET", "/health", 2},
+	}
+	for _, tc := range cases {
+		if got := c.cost(httptest.NewRequest(tc.method, tc.path, nil)); got != tc.want {
+			t.Errorf("%s %s: expected cost %d, got %d", tc.method, tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestNew_RejectsCostAboveBurst(t *testing.T) {
+	_, err := New(&config.RateLimitConfig{
+		Rate: 10, Burst: 10,
+		Costs: []config.CostRule{{Path: "/api/bulk", Cost: 11}},
+	}, "/api", zap.NewNop().Sugar())
+	if err == nil {
+		t.Fatal("expected error for a cost that can never be admitted")
+	}
+}
+
+func TestLocal_CostAndSettle(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "sliding_window"} {
+		t.Run(algo, func(t *testing.T) {
+			l, err := New(&config.RateLimitConfig{
+				Algorithm: algo, Rate: 10, Burst: 10, Window: "1m",
+				Costs: []config.CostRule{{Path: "/api/search", Cost: 4}},
+			}, "/api", zap.NewNop().Sugar())
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer l.Stop()
+			search := httptest.NewRequest("GET", "/api/search", nil)
+			search.RemoteAddr = "10.0.0.1:1234"
+
+			d, err := l.Allow(search)
+			if err != nil || d.Remaining != 6 {
+				t.Fatalf("expected allow with 6 remaining, got %+v, %v", d, err)
+			}
+			_, _ = l.Allow(search)
+			if _, err := l.Allow(search); !errors.As(err, new(*ErrRateLimited)) {
+				t.Fatalf("expected third search (12 > 10 tokens) to be limited, got %v", err)
+			}
+
+			// The backend reports the last search only cost 1: refund 3.
+			l.Settle(search, 1)
+			if d, err := l.Allow(search); err != nil || d.Remaining != 1 {
+				t.Fatalf("expected allow after refund with 1 remaining, got %+v, %v", d, err)
+			}
+		})
+	}
+}
+
+func TestSettle_ClampsReportedCost(t *testing.T) {
+	l, err := New(&config.RateLimitConfig{
+		Algorithm: "sliding_window", Rate: 10, Window: "1m",
+	}, "/api", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer l.Stop()
+	r := httptest.NewRequest("GET", "/api/export", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	if _, err := l.Allow(r); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	l.Settle(r, 5_000_000)
+	sw := l.(*keyedLimiter).quota.(*localSlidingWindow)
+	bucket, ok := sw.buckets.peek("ip:10.0.0.1")
+	if !ok {
+		t.Fatal("expected a bucket for the key")
+	}
+	if n := len(bucket.timestamps); n != 10 {
+		t.Fatalf("expected the window to hold 10 entries, got %d", n)
+	}
+	if _, err := l.Allow(r); !errors.As(err, new(*ErrRateLimited)) {
+		t.Fatalf("expected limit after the overcharge, got %v", err)
+	}
+}
+
+func TestRedis_AdjustClampsSlidingWindow(t *testing.T) {
+	rl, mr, _ := newTestRedisLimiter(t, config.RateLimitConfig{
+		Algorithm: "sliding_window", Rate: 10, Window: "1s",
+	})
+	ctx := context.Background()
+
+	rl.adjust(ctx, "ip:10.0.0.1", 5_000_000)
+	if rl.degraded.Load() {
+		t.Fatal("expected the adjust to succeed")
+	}
+	members, err := mr.ZMembers(rl.prefix + "ip:10.0.0.1")
+	if err != nil {
+		t.Fatalf("ZMembers: %v", err)
+	}
+	if len(members) != 10 {
+		t.Fatalf("expected 10 entries in the window, got %d", len(members))
+	}
+}
+
+func TestRedis_CostAndAdjust(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "gcra", "sliding_window"} {
+		t.Run(algo, func(t *testing.T) {
+			rl, _, _ := newTestRedisLimiter(t, config.RateLimitConfig{
+				Algorithm: algo, Rate: 10, Burst: 10, Window: "1s",
+			})
+			ctx := context.Background()
+
+			d, err := rl.take(ctx, "ip:10.0.0.1", 4)
+			if err != nil || d.Remaining != 6 {
+				t.Fatalf("expected allow with 6 remaining, got %+v, %v", d, err)
+			}
+			_, _ = rl.take(ctx, "ip:10.0.0.1", 4)
+			if _, err := rl.take(ctx, "ip:10.0.0.1", 4); !errors.As(err, new(*ErrRateLimited)) {
+				t.Fatalf("expected limit, got %v", err)
+			}
+
+			rl.adjust(ctx, "ip:10.0.0.1", -3)
+			if d, err := rl.take(ctx, "ip:10.0.0.1", 4); err != nil || d.Remaining != 1 {
+				t.Fatalf("expected allow after refund with 1 remaining, got %+v, %v", d, err)
+			}
+
+			// An overcharge is applied even though it exceeds what is left.
+			rl.adjust(ctx, "ip:10.0.0.1", 5)
+			if _, err := rl.take(ctx, "ip:10.0.0.1", 1); !errors.As(err, new(*ErrRateLimited)) {
+				t.Fatalf("expected limit after overcharge, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package ratelimiter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Header styles accepted by RateLimitConfig.Headers.
+const (
+	HeadersIETF   = "ietf"   // RateLimit-Limit / -Remaining / -Reset (draft-ietf-httpapi-ratelimit-headers)
+	HeadersLegacy = "legacy" // X-RateLimit-Limit / -Remaining / -Reset (Unix timestamp)
+	HeadersNone   = "none"
+)
+
+// SetHeaders writes the quota headers for d in the given style.
+// Nothing is written when the limiter reported no quota (e.g. no-op limiter
+// or Redis unavailable). Retry-After is written separately by the caller.
+func SetHeaders(h http.Header, style string, d Decision) {
+	if d.Limit <= 0 || style == HeadersNone {
+		return
+	}
+	remaining := strconv.Itoa(max(d.Remaining, 0))
+	limit := strconv.Itoa(d.Limit)
+
+	switch style {
+	case HeadersIETF:
+		h.Set("RateLimit-Limit", limit)
+		h.Set("RateLimit-Remaining", remaining)
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	default: // legacy
+		h.Set("X-RateLimit-Limit", limit)
+		h.Set("X-RateLimit-Remaining", remaining)
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(d.Reset).Unix(), 10))
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds so clients never retry too early.
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,289 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// Inspection and overrides for the admin API
+// ---------------------------------------------------------------------------
+
+// Override modes accepted by Inspector.Override.
+const (
+	OverrideExempt = "exempt" // never rate-limit the key
+	OverrideBlock  = "block"  // reject every request from the key
+)
+
+// Redis keys scanned at most by Hottest on a distributed limiter.
+const hotScanLimit = 10_000
+
+// KeyState is a snapshot of one key's quota.
+type KeyState struct {
+	Key       string `json:"key"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	ResetMs   int64  `json:"reset_ms"`
+
+	Override      string     `json:"override,omitempty"`
+	OverrideUntil *time.Time `json:"override_until,omitempty"`
+}
+
+// Inspector exposes per-key limiter state. Every Limiter returned by New for
+// a non-nil config implements it.
+type Inspector interface {
+	// Inspect returns the state of key, e.g. "ip:203.0.113.7". Keys that
+	// are not tracked report a full quota.
+	Inspect(ctx context.Context, key string) (KeyState, error)
+
+	// Hottest returns up to n keys with the least quota left. On Redis the
+	// ranking covers at most the first 10,000 keys scanned.
+	Hottest(ctx context.Context, n int) ([]KeyState, error)
+
+	// Reset forgets everything the key has consumed.
+	Reset(ctx context.Context, key string) error
+
+	// Override exempts or blocks key for ttl. An empty mode clears it.
+	Override(ctx context.Context, key, mode string, ttl time.Duration) error
+}
+
+// override is an exemption or block with an expiry.
+type override struct {
+	mode  string
+	until time.Time
+}
+
+func (l *keyedLimiter) Inspect(ctx context.Context, key string) (KeyState, error) {
+	d, err := l.peek(ctx, key)
+	if err != nil {
+		return KeyState{}, err
+	}
+	st := keyState(key, d)
+	ov, err := l.getOverride(ctx, key)
+	if err != nil {
+		return KeyState{}, err
+	}
+	if ov.mode != "" {
+		st.Override, st.OverrideUntil = ov.mode, &ov.until
+	}
+	return st, nil
+}
+
+func (l *keyedLimiter) Hottest(ctx context.Context, n int) ([]KeyState, error) {
+	keys, err := l.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]KeyState, 0, len(keys))
+	for _, k := range keys {
+		d, err := l.peek(ctx, k)
+		if err != nil {
+			continue // expired meanwhile, or not one of ours
+		}
+		states = append(states, keyState(k, d))
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Remaining != states[j].Remaining {
+			return states[i].Remaining < states[j].Remaining
+		}
+		return states[i].Key < states[j].Key
+	})
+	if len(states) > n {
+		states = states[:n]
+	}
+	return states, nil
+}
+
+func (l *keyedLimiter) Reset(ctx context.Context, key string) error {
+	return l.reset(ctx, key)
+}
+
+func (l *keyedLimiter) Override(ctx context.Context, key, mode string, ttl time.Duration) error {
+	switch mode {
+	case "", OverrideExempt, OverrideBlock:
+	default:
+		return fmt.Errorf("unknown override %q", mode)
+	}
+	if mode != "" && ttl <= 0 {
+		return errors.New("override ttl must be positive")
+	}
+	return l.setOverride(ctx, key, override{mode: mode, until: time.Now().Add(ttl)})
+}
+
+func keyState(key string, d Decision) KeyState {
+	return KeyState{Key: key, Limit: d.Limit, Remaining: d.Remaining, ResetMs: d.Reset.Milliseconds()}
+}
+
+// ---------------------------------------------------------------------------
+// In-process limiters
+// ---------------------------------------------------------------------------
+
+// overrideSet holds the active overrides of an in-process limiter.
+type overrideSet struct {
+	mu sync.RWMutex
+	m  map[string]override
+}
+
+// apply reports whether key is overridden and, if so, the outcome.
+func (s *overrideSet) apply(key string, limit int) (Decision, error, bool) {
+	ov := s.get(key)
+	switch ov.mode {
+	case OverrideExempt:
+		return Decision{Limit: limit, Remaining: limit}, nil, true
+	case OverrideBlock:
+		wait := time.Until(ov.until)
+		return Decision{Limit: limit, Reset: wait}, &ErrRateLimited{RetryAfter: wait}, true
+	}
+	return Decision{}, nil, false
+}
+
+func (s *overrideSet) get(key string) override {
+	s.mu.RLock()
+	ov, ok := s.m[key]
+	s.mu.RUnlock()
+	if !ok || time.Now().Before(ov.until) {
+		return ov
+	}
+	s.mu.Lock()
+	if cur, ok := s.m[key]; ok && cur == ov {
+		delete(s.m, key)
+	}
+	s.mu.Unlock()
+	return override{}
+}
+
+func (s *overrideSet) set(key string, ov override) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ov.mode == "" {
+		delete(s.m, key)
+		return
+	}
+	if s.m == nil {
+		s.m = make(map[string]override)
+	}
+	s.m[key] = ov
+}
+
+func (s *overrideSet) getOverride(_ context.Context, key string) (override, error) {
+	return s.get(key), nil
+}
+
+func (s *overrideSet) setOverride(_ context.Context, key string, ov override) error {
+	s.set(key, ov)
+	return nil
+}
+
+func (l *localTokenBucket) peek(_ context.Context, key string) (Decision, error) {
+	bucket, ok := l.buckets.peek(key)
+	if !ok {
+		return l.decision(float64(l.burst)), nil
+	}
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	l.refill(bucket)
+	return l.decision(bucket.tokens), nil
+}
+
+func (l *localTokenBucket) reset(_ context.Context, key string) error {
+	l.buckets.delete(key)
+	return nil
+}
+
+func (l *localTokenBucket) keys(context.Context) ([]string, error) {
+	return l.buckets.keys(), nil
+}
+
+func (l *localSlidingWindow) peek(_ context.Context, key string) (Decision, error) {
+	bucket, ok := l.buckets.peek(key)
+	if !ok {
+		return Decision{Limit: l.rate, Remaining: l.rate}, nil
+	}
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := time.Now()
+	l.evict(bucket, now)
+	d := Decision{Limit: l.rate, Remaining: max(l.rate-len(bucket.timestamps), 0)}
+	if len(bucket.timestamps) > 0 {
+		d.Reset = bucket.timestamps[0].Add(l.window).Sub(now)
+	}
+	return d, nil
+}
+
+func (l *localSlidingWindow) reset(_ context.Context, key string) error {
+	l.buckets.delete(key)
+	return nil
+}
+
+func (l *localSlidingWindow) keys(context.Context) ([]string, error) {
+	return l.buckets.keys(), nil
+}
+
+// ---------------------------------------------------------------------------
+// Redis limiter
+//
+// Overrides live in Redis next to the buckets, so every gateway replica
+// honours them; the scripts check them before touching the bucket.
+// ---------------------------------------------------------------------------
+
+// peek evaluates the script with a cost of zero, which reports the bucket
+// without consuming from it and ignores overrides.
+func (rl *redisLimiter) peek(ctx context.Context, key string) (Decision, error) {
+	res, err := rl.eval(ctx, key, 0, false)
+	if err != nil {
+		return Decision{}, err
+	}
+	return Decision{
+		Limit:     rl.limit,
+		Remaining: int(max(res[1], 0)),
+		Reset:     time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+func (rl *redisLimiter) reset(ctx context.Context, key string) error {
+	if rl.fallback != nil {
+		_ = rl.fallback.reset(ctx, key)
+	}
+	return rl.client.Del(ctx, rl.prefix+key).Err()
+}
+
+// keys scans the route's bucket namespace for its algorithm.
+func (rl *redisLimiter) keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	iter := rl.client.Scan(ctx, 0, globEscaper.Replace(rl.prefix)+"*", 1000).Iterator()
+	for len(keys) < hotScanLimit && iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), rl.prefix))
+	}
+	return keys, iter.Err()
+}
+
+// globEscaper quotes the SCAN pattern characters a route may contain.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (rl *redisLimiter) getOverride(ctx context.Context, key string) (override, error) {
+	pipe := rl.client.Pipeline()
+	get := pipe.Get(ctx, rl.overrides+key)
+	ttl := pipe.PTTL(ctx, rl.overrides+key)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return override{}, err
+	}
+	if get.Val() == "" {
+		return override{}, nil
+	}
+	return override{mode: get.Val(), until: time.Now().Add(ttl.Val())}, nil
+}
+
+func (rl *redisLimiter) setOverride(ctx context.Context, key string, ov override) error {
+	if ov.mode == "" {
+		return rl.client.Del(ctx, rl.overrides+key).Err()
+	}
+	return rl.client.Set(ctx, rl.overrides+key, ov.mode, time.Until(ov.until)).Err()
+}
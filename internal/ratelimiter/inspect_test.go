@@ -0,0 +1,186 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+func newTestInspector(t *testing.T, cfg config.RateLimitConfig) (Limiter, Inspector) {
+	t.Helper()
+	l, err := New(&cfg, "/api", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(l.Stop)
+	return l, l.(Inspector)
+}
+
+func TestInspector_Local(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "sliding_window"} {
+		t.Run(algo, func(t *testing.T) {
+			l, insp := newTestInspector(t, config.RateLimitConfig{Algorithm: algo, Rate: 5, Burst: 5, Window: "1m"})
+			ctx := context.Background()
+
+			st, err := insp.Inspect(ctx, "ip:10.0.0.9")
+			if err != nil || st.Remaining != 5 || st.Limit != 5 {
+				t.Fatalf("expected untracked key to report a full quota, got %+v, %v", st, err)
+			}
+
+			for i := 0; i < 3; i++ {
+				_, _ = l.Allow(newTestRequest("10.0.0.1:1"))
+			}
+			_, _ = l.Allow(newTestRequest("10.0.0.2:1"))
+
+			if st, _ := insp.Inspect(ctx, "ip:10.0.0.1"); st.Remaining != 2 {
+				t.Errorf("expected 2 remaining, got %+v", st)
+			}
+			hot, err := insp.Hottest(ctx, 1)
+			if err != nil || len(hot) != 1 || hot[0].Key != "ip:10.0.0.1" {
+				t.Errorf("expected ip:10.0.0.1 to be hottest, got %+v, %v", hot, err)
+			}
+
+			if err := insp.Reset(ctx, "ip:10.0.0.1"); err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			if st, _ := insp.Inspect(ctx, "ip:10.0.0.1"); st.Remaining != 5 {
+				t.Errorf("expected full quota after reset, got %+v", st)
+			}
+		})
+	}
+}
+
+func TestInspector_LocalOverrides(t *testing.T) {
+	l, insp := newTestInspector(t, config.RateLimitConfig{Rate: 1, Burst: 1})
+	ctx := context.Background()
+	r := newTestRequest("10.0.0.1:1")
+
+	if err := insp.Override(ctx, "ip:10.0.0.1", OverrideExempt, time.Minute); err != nil {
+		t.Fatalf("Override: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := l.Allow(r); err != nil {
+			t.Fatalf("expected exempt key to be allowed, got %v", err)
+		}
+	}
+	st, _ := insp.Inspect(ctx, "ip:10.0.0.1")
+	if st.Override != OverrideExempt || st.OverrideUntil == nil {
+		t.Errorf("expected exempt override in state, got %+v", st)
+	}
+
+	_ = insp.Override(ctx, "ip:10.0.0.1", OverrideBlock, 20*time.Millisecond)
+	var rlErr *ErrRateLimited
+	if _, err := l.Allow(r); !errors.As(err, &rlErr) || rlErr.RetryAfter <= 0 {
+		t.Fatalf("expected blocked key to be limited, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := l.Allow(r); err != nil {
+		t.Fatalf("expected block to expire, got %v", err)
+	}
+
+	if err := insp.Override(ctx, "ip:10.0.0.1", "allow", time.Minute); err == nil {
+		t.Error("expected unknown mode to be rejected")
+	}
+}
+
+func TestInspector_Redis(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "gcra", "sliding_window"} {
+		t.Run(algo, func(t *testing.T) {
+			rl, mr, _ := newTestRedisLimiter(t, config.RateLimitConfig{
+				Algorithm: algo, Rate: 5, Burst: 5, Window: "1s",
+			})
+			insp := &keyedLimiter{quota: rl}
+			ctx := context.Background()
+
+			for i := 0; i < 3; i++ {
+				_, _ = rl.take(ctx, "ip:10.0.0.1", 1)
+			}
+			_, _ = rl.take(ctx, "ip:10.0.0.2", 1)
+
+			st, err := insp.Inspect(ctx, "ip:10.0.0.1")
+			if err != nil || st.Remaining != 2 {
+				t.Fatalf("expected 2 remaining, got %+v, %v", st, err)
+			}
+			// Peeking must not consume.
+			if st, _ := insp.Inspect(ctx, "ip:10.0.0.1"); st.Remaining != 2 {
+				t.Fatalf("expected inspect to be read-only, got %+v", st)
+			}
+			hot, err := insp.Hottest(ctx, 10)
+			if err != nil || len(hot) != 2 || hot[0].Key != "ip:10.0.0.1" {
+				t.Errorf("expected both keys with ip:10.0.0.1 first, got %+v, %v", hot, err)
+			}
+
+			if err := insp.Reset(ctx, "ip:10.0.0.1"); err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			if st, _ := insp.Inspect(ctx, "ip:10.0.0.1"); st.Remaining != 5 {
+				t.Errorf("expected full quota after reset, got %+v", st)
+			}
+
+			_ = insp.Override(ctx, "ip:10.0.0.1", OverrideBlock, time.Minute)
+			if _, err := rl.take(ctx, "ip:10.0.0.1", 1); !errors.As(err, new(*ErrRateLimited)) {
+				t.Fatalf("expected blocked key to be limited, got %v", err)
+			}
+			if st, _ := insp.Inspect(ctx, "ip:10.0.0.1"); st.Override != OverrideBlock || st.Remaining != 5 {
+				t.Errorf("expected block override over an untouched bucket, got %+v", st)
+			}
+
+			_ = insp.Override(ctx, "ip:10.0.0.1", OverrideExempt, time.Minute)
+			for i := 0; i < 10; i++ {
+				if _, err := rl.take(ctx, "ip:10.0.0.1", 1); err != nil {
+					t.Fatalf("expected exempt key to be allowed, got %v", err)
+				}
+			}
+
+			mr.FastForward(2 * time.Minute)
+			if st, _ := insp.Inspect(ctx, "ip:10.0.0.1"); st.Override != "" {
+				t.Errorf("expected override to expire, got %+v", st)
+			}
+		})
+	}
+}
+
+func TestInspector_RedisRoutesAreSeparate(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newRoute := func(route, algo string) *keyedLimiter {
+		t.Helper()
+		rl, err := newRedisLimiter(&config.RateLimitConfig{
+			RedisURL: "redis://" + mr.Addr(), Algorithm: algo, Rate: 2, Burst: 2, Window: "1s",
+		}, route, zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatalf("newRedisLimiter: %v", err)
+		}
+		t.Cleanup(rl.Stop)
+		return &keyedLimiter{quota: rl}
+	}
+	ctx := context.Background()
+	a, b := newRoute("/a", "sliding_window"), newRoute("/b[*]", "sliding_window")
+	gcra := newRoute("/a", "gcra")
+
+	for i := 0; i < 2; i++ {
+		_, _ = a.take(ctx, "ip:10.0.0.1", 1)
+	}
+	_, _ = gcra.take(ctx, "ip:10.0.0.2", 1)
+	_ = a.Override(ctx, "ip:10.0.0.3", OverrideBlock, time.Minute)
+	if _, err := b.take(ctx, "ip:10.0.0.1", 1); err != nil {
+		t.Fatalf("expected another route's quota to be separate, got %v", err)
+	}
+	if st, _ := b.Inspect(ctx, "ip:10.0.0.3"); st.Override != "" {
+		t.Errorf("expected another route's override not to apply, got %+v", st)
+	}
+
+	// Hottest sees only the route's own buckets for its algorithm
+	hot, err := a.Hottest(ctx, 10)
+	if err != nil || len(hot) != 1 || hot[0].Key != "ip:10.0.0.1" || hot[0].Remaining != 0 {
+		t.Errorf("route /a hottest = %+v, %v", hot, err)
+	}
+	hot, err = b.Hottest(ctx, 10)
+	if err != nil || len(hot) != 1 || hot[0].Remaining != 1 {
+		t.Errorf("route /b[*] hottest = %+v, %v", hot, err)
+	}
+}
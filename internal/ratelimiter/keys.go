@@ -0,0 +1,184 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sneha4175/gateway-pro/internal/clientip"
+	"github.com/sneha4175/gateway-pro/internal/middleware"
+)
+
+// ---------------------------------------------------------------------------
+// Key expressions
+//
+// key_by is a "+"-separated list of sources, e.g. "claim:tenant_id+method":
+//
+//	ip             client IP (trusted-proxy aware)
+//	user           subject of the validated JWT; missing without one
+//	api_key        X-API-Key header
+//	header:<name>  any request header
+//	cookie:<name>  a cookie value
+//	query:<name>   a query parameter
+//	claim:<name>   a claim of the validated JWT; dots select nested fields
+//	path:<n>       n-th path segment after the route prefix (0-based)
+//	route          the route's path prefix
+//	method         the HTTP method
+//
+// Keys are computed in serveProxy, after the auth middleware, so claims come
+// from a verified token rather than from anything the client sent. Values
+// have "%" and "+" escaped, so one source cannot spill into the next.
+// ---------------------------------------------------------------------------
+
+// Policies for RateLimitConfig.OnMissingKey.
+const (
+	OnMissingKeyAnonymous = "anonymous" // share one bucket per missing source
+	OnMissingKeyReject    = "reject"    // refuse with ErrKeyMissing
+	OnMissingKeySkip      = "skip"      // do not rate-limit the request
+)
+
+var keyEscaper = strings.NewReplacer("%", "%25", "+", "%2B")
+
+// keyFunc returns the key for r and whether every source was present.
+// Missing sources are rendered as "anonymous".
+type keyFunc func(r *http.Request) (key string, complete bool)
+
+// keySource extracts one component of a key.
+type keySource struct {
+	label   string
+	extract func(r *http.Request) (string, bool)
+}
+
+// parseKeyExpr compiles a key_by expression for the route with the given prefix.
+func parseKeyExpr(expr, route string) (keyFunc, error) {
+	if expr == "" {
+		expr = "ip"
+	}
+	var sources []keySource
+	for _, part := range strings.Split(expr, "+") {
+		src, err := parseKeySource(strings.TrimSpace(part), route)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+
+	return func(r *http.Request) (string, bool) {
+		var b strings.Builder
+		complete := true
+		for i, src := range sources {
+			if i > 0 {
+				b.WriteByte('+')
+			}
+			v, ok := src.extract(r)
+			if !ok || v == "" {
+				v, complete = "anonymous", false
+			}
+			b.WriteString(src.label)
+			b.WriteByte(':')
+			b.WriteString(keyEscaper.Replace(v))
+		}
+		return b.String(), complete
+	}, nil
+}
+
+func parseKeySource(part, route string) (keySource, error) {
+	kind, arg, hasArg := strings.Cut(part, ":")
+	if hasArg && arg == "" {
+		return keySource{}, fmt.Errorf("key_by %q: missing name after %q", part, kind+":")
+	}
+
+	switch kind {
+	case "ip":
+		return keySource{"ip", func(r *http.Request) (string, bool) {
+			return clientip.FromRequest(r), true
+		}}, nil
+	case "user":
+		return keySource{"user", func(r *http.Request) (string, bool) {
+			// Never X-User-ID: without a validated token the client sets it
+			sub, _ := middleware.Claims(r)["sub"].(string)
+			return sub, sub != ""
+		}}, nil
+	case "api_key":
+		return keySource{"apikey", func(r *http.Request) (string, bool) {
+			v := r.Header.Get("X-API-Key")
+			return v, v != ""
+		}}, nil
+	case "route":
+		return keySource{"route", func(*http.Request) (string, bool) { return route, true }}, nil
+	case "method":
+		return keySource{"method", func(r *http.Request) (string, bool) { return r.Method, true }}, nil
+	}
+
+	if !hasArg {
+		return keySource{}, fmt.Errorf("unknown key_by source %q", part)
+	}
+	switch kind {
+	case "header":
+		name := http.CanonicalHeaderKey(arg)
+		return keySource{part, func(r *http.Request) (string, bool) {
+			v := r.Header.Get(name)
+			return v, v != ""
+		}}, nil
+	case "cookie":
+		return keySource{part, func(r *http.Request) (string, bool) {
+			c, err := r.Cookie(arg)
+			if err != nil {
+				return "", false
+			}
+			return c.Value, c.Value != ""
+		}}, nil
+	case "query":
+		return keySource{part, func(r *http.Request) (string, bool) {
+			v := r.URL.Query().Get(arg)
+			return v, v != ""
+		}}, nil
+	case "claim":
+		path := strings.Split(arg, ".")
+		return keySource{part, func(r *http.Request) (string, bool) {
+			return claimValue(middleware.Claims(r), path)
+		}}, nil
+	case "path":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return keySource{}, fmt.Errorf("key_by %q: segment must be a non-negative integer", part)
+		}
+		return keySource{part, func(r *http.Request) (string, bool) {
+			rest := strings.Trim(strings.TrimPrefix(r.URL.Path, route), "/")
+			segs := strings.Split(rest, "/")
+			if rest == "" || n >= len(segs) {
+				return "", false
+			}
+			return segs[n], segs[n] != ""
+		}}, nil
+	}
+	return keySource{}, fmt.Errorf("unknown key_by source %q", part)
+}
+
+// claimValue walks path through nested claim objects and renders the leaf.
+func claimValue(claims map[string]any, path []string) (string, bool) {
+	var v any = claims
+	for _, p := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[p]; !ok {
+			return "", false
+		}
+	}
+	switch t := v.(type) {
+	case string:
+		return t, t != ""
+	case json.Number: // exact, unlike float64, for large numeric IDs
+		return t.String(), true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	default:
+		return "", false
+	}
+}
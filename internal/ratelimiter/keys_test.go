@@ -0,0 +1,153 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"github.com/sneha4175/gateway-pro/internal/middleware"
+	"go.uber.org/zap"
+)
+
+func TestParseKeyExpr(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/orders/42/items?tenant=q-acme", nil)
+	r.RemoteAddr = "203.0.113.7:5000"
+	r.Header.Set("X-Tenant", "h-acme+x")
+	r.Header.Set("X-API-Key", "k1")
+	r.Header.Set("X-User-ID", "spoofed")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	r = middleware.WithClaims(r, map[string]any{
+		"sub":       "alice",
+		"tenant_id": "acme",
+		"org":       map[string]any{"id": float64(7)},
+		"account":   json.Number("12345678901234567891"),
+	})
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"", "ip:203.0.113.7"},
+		{"ip", "ip:203.0.113.7"},
+		{"user", "user:alice"},
+		{"api_key", "apikey:k1"},
+		{"header:x-tenant", "header:x-tenant:h-acme%2Bx"},
+		{"cookie:session", "cookie:session:s1"},
+		{"query:tenant", "query:tenant:q-acme"},
+		{"claim:tenant_id", "claim:tenant_id:acme"},
+		{"claim:org.id", "claim:org.id:7"},
+		{"claim:account", "claim:account:12345678901234567891"},
+		{"path:0", "path:0:42"},
+		{"path:1", "path:1:items"},
+		{"route", "route:/api/orders"},
+		{"claim:tenant_id+method", "claim:tenant_id:acme+method:POST"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			fn, err := parseKeyExpr(tc.expr, "/api/orders")
+			if err != nil {
+				t.Fatalf("parseKeyExpr: %v", err)
+			}
+			got, complete := fn(r)
+			if got != tc.want || !complete {
+				t.Errorf("expected %q (complete), got %q complete=%v", tc.want, got, complete)
+			}
+		})
+	}
+}
+
+func TestParseKeyExpr_MissingSource(t *testing.T) {
+	fn, err := parseKeyExpr("claim:tenant_id+method", "/api")
+	if err != nil {
+		t.Fatalf("parseKeyExpr: %v", err)
+	}
+	// No validated token: the claim is missing even if a header claims otherwise.
+	r := httptest.NewRequest("GET", "/api", nil)
+	r.Header.Set("X-Tenant-ID", "acme")
+	r.Header.Set("X-User-ID", "alice")
+	got, complete := fn(r)
+	if complete || got != "claim:tenant_id:anonymous+method:GET" {
+		t.Errorf("expected incomplete anonymous key, got %q complete=%v", got, complete)
+	}
+
+	fn, err = parseKeyExpr("user", "/api")
+	if err != nil {
+		t.Fatalf("parseKeyExpr: %v", err)
+	}
+	if got, complete := fn(r); complete || got != "user:anonymous" {
+		t.Errorf("user from X-User-ID without a token: got %q complete=%v", got, complete)
+	}
+}
+
+func TestKeyByUser_NeedsAuth(t *testing.T) {
+	load := func(auth string) error {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "gateway.yaml")
+		data := auth + "routes:\n  - path_prefix: /api\n    backends: [{url: http://127.0.0.1:1}]\n" +
+			"    rate_limit: {rate: 10, key_by: user+method}\n"
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, w, err := config.LoadAndWatch(path, zap.NewNop().Sugar())
+		if w != nil {
+			w.Close()
+		}
+		return err
+	}
+	if err := load(""); err == nil || !strings.Contains(err.Error(), "key_by") {
+		t.Errorf("without auth: expected a key_by error, got %v", err)
+	}
+	if err := load("auth: {enabled: true, public_key_path: key.pem, skip_paths: [/api]}\n"); err == nil {
+		t.Error("with the route skipped by auth: expected an error")
+	}
+	if err := load("auth: {enabled: true, public_key_path: key.pem, skip_paths: [/health]}\n"); err != nil {
+		t.Errorf("with auth: %v", err)
+	}
+}
+
+func TestParseKeyExpr_Invalid(t *testing.T) {
+	for _, expr := range []string{"tenant", "header:", "path:x", "path:-1", "ip+bogus"} {
+		if _, err := parseKeyExpr(expr, "/api"); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestOnMissingKey(t *testing.T) {
+	newLimiter := func(policy string) Limiter {
+		l, err := New(&config.RateLimitConfig{
+			Rate: 1, Burst: 1, KeyBy: "api_key", OnMissingKey: policy,
+		}, "/api", zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(l.Stop)
+		return l
+	}
+	anon := func() *http.Request { return httptest.NewRequest("GET", "/api", nil) }
+
+	l := newLimiter(OnMissingKeyReject)
+	if _, err := l.Allow(anon()); !errors.Is(err, ErrKeyMissing) {
+		t.Errorf("reject: expected ErrKeyMissing, got %v", err)
+	}
+
+	l = newLimiter(OnMissingKeySkip)
+	for i := 0; i < 3; i++ {
+		if _, err := l.Allow(anon()); err != nil {
+			t.Fatalf("skip: expected unlimited, got %v", err)
+		}
+	}
+
+	l = newLimiter(OnMissingKeyAnonymous)
+	_, _ = l.Allow(anon())
+	var rlErr *ErrRateLimited
+	if _, err := l.Allow(anon()); !errors.As(err, &rlErr) {
+		t.Errorf("anonymous: expected anonymous callers to share a bucket, got %v", err)
+	}
+}
@@ -1,19 +1,29 @@
 // Package ratelimiter provides per-key rate limiting using two algorithms:
 // token bucket (good for bursty traffic) and sliding window (precise).
-// Both algorithms work in-process (zero deps) or with Redis for distributed use.
+// Both algorithms work in-process (zero deps) or with Redis for distributed use;
+// the Redis limiter additionally offers GCRA, a constant-memory token bucket.
 package ratelimiter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
 )
 
+// ErrUnavailable is returned by a fail-closed Redis limiter while Redis is
+// unreachable.
+var ErrUnavailable = errors.New("rate limiter unavailable")
+
+// ErrKeyMissing is returned when on_missing_key is "reject" and the request
+// lacks a source used by key_by.
+var ErrKeyMissing = errors.New("rate limit key missing from request")
+
 // ErrRateLimited is returned when a key has exceeded its limit.
 type ErrRateLimited struct {
 	RetryAfter time.Duration
@@ -23,24 +33,146 @@ func (e *ErrRateLimited) Error() string {
 	return fmt.Sprintf("rate limit exceeded; retry after %s", e.RetryAfter)
 }
 
+// Decision describes the quota state of a key after a call to Allow.
+// It is filled in for both allowed and rejected requests so callers can
+// advertise the remaining quota on every response.
+type Decision struct {
+	// Limit is the maximum number of tokens the key may spend in one
+	// quota period (burst for token_bucket, rate for sliding_window).
+	// A request spends one token unless a cost is configured.
+	Limit int
+
+	// Remaining is the number of tokens still available right now.
+	Remaining int
+
+	// Reset is how long until the quota is fully replenished.
+	Reset time.Duration
+}
+
 // Limiter checks whether a request should be allowed.
+// The returned error is *ErrRateLimited when the request is rejected.
 type Limiter interface {
-	Allow(r *http.Request) error
+	Allow(r *http.Request) (Decision, error)
+
+	// Settle charges the difference between actual and the cost Allow
+	// deducted for r, e.g. from a backend-reported X-Request-Cost. A
+	// negative difference refunds tokens.
+	Settle(r *http.Request, actual int)
+
+	// Stop releases background resources. The limiter keeps answering
+	// Allow afterwards so requests still in flight on a replaced route
+	// are unaffected.
+	Stop()
 }
 
-// New constructs the appropriate limiter from config.
+// quota is a rate-limit algorithm operating on already-derived keys.
+type quota interface {
+	// take admits a request spending cost tokens, or rejects it.
+	take(ctx context.Context, key string, cost int) (Decision, error)
+
+	// adjust unconditionally spends delta tokens (refunds if negative).
+	adjust(ctx context.Context, key string, delta int)
+
+	// peek reports key's state without consuming from it.
+	peek(ctx context.Context, key string) (Decision, error)
+
+	// reset drops the state kept for key.
+	reset(ctx context.Context, key string) error
+
+	// keys lists tracked keys for Hottest.
+	keys(ctx context.Context) ([]string, error)
+
+	getOverride(ctx context.Context, key string) (override, error)
+	setOverride(ctx context.Context, key string, ov override) error
+
+	Stop()
+}
+
+// New constructs the appropriate limiter from config. route is the route's
+// path prefix; it labels metrics and log lines and feeds the "route" key.
 // If cfg is nil, a no-op limiter is returned.
-func New(cfg *config.RateLimitConfig) (Limiter, error) {
+func New(cfg *config.RateLimitConfig, route string, log *zap.SugaredLogger) (Limiter, error) {
 	if cfg == nil {
 		return noopLimiter{}, nil
 	}
 
-	keyFn := buildKeyFn(cfg.KeyBy)
+	keyFn, err := parseKeyExpr(cfg.KeyBy, route)
+	if err != nil {
+		return nil, err
+	}
+
+	maxCost := cfg.Burst
+	if maxCost <= 0 || cfg.Algorithm == "sliding_window" {
+		maxCost = cfg.Rate
+	}
+	costs, err := newCoster(cfg, maxCost)
+	if err != nil {
+		return nil, err
+	}
 
+	var q quota
 	if cfg.RedisURL != "" {
-		return newRedisLimiter(cfg, keyFn)
+		q, err = newRedisLimiter(cfg, route, log)
+	} else {
+		q, err = newLocal(cfg, route)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return &keyedLimiter{keyFn: keyFn, onMissing: cfg.OnMissingKey, costs: costs, quota: q}, nil
+}
 
+// keyedLimiter derives the key and cost for a request and applies the
+// missing-key policy before handing off to the algorithm.
+type keyedLimiter struct {
+	keyFn     keyFunc
+	onMissing string
+	costs     *coster
+	quota
+}
+
+func (l *keyedLimiter) Allow(r *http.Request) (Decision, error) {
+	key, ok, err := l.key(r)
+	if !ok {
+		return Decision{}, err
+	}
+	return l.take(r.Context(), key, l.costs.cost(r))
+}
+
+func (l *keyedLimiter) Settle(r *http.Request, actual int) {
+	key, ok, _ := l.key(r)
+	if !ok || actual < 0 {
+		return
+	}
+	// The backend's figure is untrusted: charging more than a full bucket
+	// only costs memory (and Redis calls for sliding_window)
+	actual = min(actual, l.costs.max)
+	if delta := actual - l.costs.cost(r); delta != 0 {
+		l.adjust(r.Context(), key, delta)
+	}
+}
+
+// key returns the request's key, or ok=false if the request must not be
+// charged (skip policy) or must be rejected (err set).
+func (l *keyedLimiter) key(r *http.Request) (key string, ok bool, err error) {
+	key, complete := l.keyFn(r)
+	if !complete {
+		switch l.onMissing {
+		case OnMissingKeySkip:
+			return "", false, nil
+		case OnMissingKeyReject:
+			return "", false, ErrKeyMissing
+		}
+	}
+	return key, true, nil
+}
+
+// newLocal builds an in-process limiter for cfg, ignoring RedisURL.
+// Keys are evicted once idle long enough for their bucket to be full again.
+func newLocal(cfg *config.RateLimitConfig, route string) (quota, error) {
+	if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %d", cfg.Rate)
+	}
 	switch cfg.Algorithm {
 	case "sliding_window":
 		window, err := time.ParseDuration(cfg.Window)
@@ -48,18 +180,21 @@ func New(cfg *config.RateLimitConfig) (Limiter, error) {
 			return nil, fmt.Errorf("invalid window %q: %w", cfg.Window, err)
 		}
 		return &localSlidingWindow{
-			rate:   cfg.Rate,
-			window: window,
-			keyFn:  keyFn,
-			buckets: make(map[string]*swBucket),
-		}, nil
-	default: // token_bucket
-		return &localTokenBucket{
-			rate:    float64(cfg.Rate),
-			burst:   cfg.Burst,
-			keyFn:   keyFn,
-			buckets: make(map[string]*tbBucket),
+			rate:    cfg.Rate,
+			window:  window,
+			buckets: newKeyStore(route, cfg.MaxKeys, window, func(*swBucket) {}),
 		}, nil
+	default: // token_bucket; gcra is equivalent in-process
+		l := &localTokenBucket{
+			rate:  float64(cfg.Rate),
+			burst: cfg.Burst,
+		}
+		refill := time.Duration(float64(cfg.Burst) / l.rate * float64(time.Second))
+		l.buckets = newKeyStore(route, cfg.MaxKeys, refill, func(b *tbBucket) {
+			b.tokens = float64(l.burst)
+			b.lastFill = time.Now()
+		})
+		return l, nil
 	}
 }
 
@@ -69,37 +204,9 @@ func New(cfg *config.RateLimitConfig) (Limiter, error) {
 
 type noopLimiter struct{}
 
-func (noopLimiter) Allow(_ *http.Request) error { return nil }
-
-// ---------------------------------------------------------------------------
-// Key extraction
-// ---------------------------------------------------------------------------
-
-func buildKeyFn(keyBy string) func(r *http.Request) string {
-	switch keyBy {
-	case "api_key":
-		return func(r *http.Request) string {
-			if k := r.Header.Get("X-API-Key"); k != "" {
-				return "apikey:" + k
-			}
-			return "apikey:anonymous"
-		}
-	case "user":
-		return func(r *http.Request) string {
-			if u := r.Header.Get("X-User-ID"); u != "" {
-				return "user:" + u
-			}
-			return "user:anonymous"
-		}
-	default: // ip
-		return func(r *http.Request) string {
-			if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-				return "ip:" + xff
-			}
-			return "ip:" + r.RemoteAddr
-		}
-	}
-}
+func (noopLimiter) Allow(_ *http.Request) (Decision, error) { return Decision{}, nil }
+func (noopLimiter) Settle(_ *http.Request, _ int)           {}
+func (noopLimiter) Stop()                                   {}
 
 // ---------------------------------------------------------------------------
 // Local Token Bucket
@@ -112,50 +219,64 @@ type tbBucket struct {
 }
 
 type localTokenBucket struct {
-	mu      sync.RWMutex
-	buckets map[string]*tbBucket
+	buckets *keyStore[tbBucket]
 	rate    float64 // tokens per second
 	burst   int
-	keyFn   func(r *http.Request) string
+	overrideSet
 }
 
-func (l *localTokenBucket) Allow(r *http.Request) error {
-	key := l.keyFn(r)
-	bucket := l.getOrCreate(key)
+func (l *localTokenBucket) take(_ context.Context, key string, cost int) (Decision, error) {
+	if d, err, ok := l.apply(key, l.burst); ok {
+		return d, err
+	}
+	bucket := l.buckets.get(key)
 
 	bucket.mu.Lock()
 	defer bucket.mu.Unlock()
 
+	l.refill(bucket)
+	if bucket.tokens < float64(cost) {
+		wait := time.Duration((float64(cost)-bucket.tokens)/l.rate*1e9) * time.Nanosecond
+		return l.decision(bucket.tokens), &ErrRateLimited{RetryAfter: wait}
+	}
+	bucket.tokens -= float64(cost)
+	return l.decision(bucket.tokens), nil
+}
+
+// adjust may leave the bucket in debt, down to -burst, so an underestimated
+// request delays the key's next ones instead of being forgiven.
+func (l *localTokenBucket) adjust(_ context.Context, key string, delta int) {
+	if l.get(key).mode != "" {
+		return
+	}
+	bucket := l.buckets.get(key)
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	l.refill(bucket)
+	bucket.tokens = max(-float64(l.burst), min(float64(l.burst), bucket.tokens-float64(delta)))
+}
+
+// refill adds the tokens earned since the last call. Caller holds bucket.mu.
+func (l *localTokenBucket) refill(bucket *tbBucket) {
 	now := time.Now()
 	elapsed := now.Sub(bucket.lastFill).Seconds()
 	bucket.tokens = min(float64(l.burst), bucket.tokens+elapsed*l.rate)
 	bucket.lastFill = now
-
-	if bucket.tokens < 1 {
-		wait := time.Duration((1-bucket.tokens)/l.rate*1e9) * time.Nanosecond
-		return &ErrRateLimited{RetryAfter: wait}
-	}
-	bucket.tokens--
-	return nil
 }
 
-func (l *localTokenBucket) getOrCreate(key string) *tbBucket {
-	l.mu.RLock()
-	b, ok := l.buckets[key]
-	l.mu.RUnlock()
-	if ok {
-		return b
-	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if b, ok = l.buckets[key]; ok {
-		return b
+// decision reports the bucket state; Reset is the time to refill to burst.
+func (l *localTokenBucket) decision(tokens float64) Decision {
+	return Decision{
+		Limit:     l.burst,
+		Remaining: max(int(tokens), 0),
+		Reset:     time.Duration((float64(l.burst) - tokens) / l.rate * 1e9),
 	}
-	b = &tbBucket{tokens: float64(l.burst), lastFill: time.Now()}
-	l.buckets[key] = b
-	return b
 }
 
+func (l *localTokenBucket) Stop() { l.buckets.close() }
+
 // ---------------------------------------------------------------------------
 // Local Sliding Window
 // ---------------------------------------------------------------------------
@@ -166,135 +287,71 @@ type swBucket struct {
 }
 
 type localSlidingWindow struct {
-	mu      sync.RWMutex
-	buckets map[string]*swBucket
+	buckets *keyStore[swBucket]
 	rate    int
 	window  time.Duration
-	keyFn   func(r *http.Request) string
+	overrideSet
 }
 
-func (l *localSlidingWindow) Allow(r *http.Request) error {
-	key := l.keyFn(r)
-	bucket := l.swGetOrCreate(key)
+// A request of cost n records n timestamps.
+func (l *localSlidingWindow) take(_ context.Context, key string, cost int) (Decision, error) {
+	if d, err, ok := l.apply(key, l.rate); ok {
+		return d, err
+	}
+	bucket := l.buckets.get(key)
 
 	bucket.mu.Lock()
 	defer bucket.mu.Unlock()
 
 	now := time.Now()
-	cutoff := now.Add(-l.window)
+	l.evict(bucket, now)
 
-	// Evict old entries
-	i := 0
-	for i < len(bucket.timestamps) && bucket.timestamps[i].Before(cutoff) {
-		i++
+	if used := len(bucket.timestamps); used+cost > l.rate {
+		// Wait until enough of the oldest entries have expired.
+		retryAfter := bucket.timestamps[used+cost-l.rate-1].Add(l.window).Sub(now)
+		return Decision{Limit: l.rate, Remaining: l.rate - used, Reset: bucket.timestamps[used-1].Add(l.window).Sub(now)},
+			&ErrRateLimited{RetryAfter: retryAfter}
 	}
-	bucket.timestamps = bucket.timestamps[i:]
-
-	if len(bucket.timestamps) >= l.rate {
-		oldest := bucket.timestamps[0]
-		retryAfter := oldest.Add(l.window).Sub(now)
-		return &ErrRateLimited{RetryAfter: retryAfter}
+	for i := 0; i < cost; i++ {
+		bucket.timestamps = append(bucket.timestamps, now)
 	}
-	bucket.timestamps = append(bucket.timestamps, now)
-	return nil
+	return Decision{
+		Limit:     l.rate,
+		Remaining: l.rate - len(bucket.timestamps),
+		Reset:     bucket.timestamps[0].Add(l.window).Sub(now),
+	}, nil
 }
 
-func (l *localSlidingWindow) swGetOrCreate(key string) *swBucket {
-	l.mu.RLock()
-	b, ok := l.buckets[key]
-	l.mu.RUnlock()
-	if ok {
-		return b
-	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if b, ok = l.buckets[key]; ok {
-		return b
+// adjust records delta more entries, up to a full window, or forgets the
+// newest -delta entries.
+func (l *localSlidingWindow) adjust(_ context.Context, key string, delta int) {
+	if l.get(key).mode != "" {
+		return
 	}
-	b = &swBucket{}
-	l.buckets[key] = b
-	return b
-}
-
-// ---------------------------------------------------------------------------
-// Redis-backed (distributed) limiter — uses Lua script for atomicity
-// ---------------------------------------------------------------------------
+	bucket := l.buckets.get(key)
 
-// Sliding window in Redis using a sorted set.
-// Each request adds current timestamp; expired entries are pruned atomically.
-const slidingWindowLua = `
-local key    = KEYS[1]
-local now    = tonumber(ARGV[1])
-local window = tonumber(ARGV[2])
-local limit  = tonumber(ARGV[3])
-local cutoff = now - window
-
-redis.call('ZREMRANGEBYSCORE', key, '-inf', cutoff)
-local count = redis.call('ZCARD', key)
-if count >= limit then
-  local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
-  return {0, oldest[2]}
-end
-redis.call('ZADD', key, now, now)
-redis.call('EXPIRE', key, math.ceil(window/1000))
-return {1, 0}
-`
-
-type redisLimiter struct {
-	client *redis.Client
-	script *redis.Script
-	cfg    *config.RateLimitConfig
-	window time.Duration
-	keyFn  func(r *http.Request) string
-}
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
 
-func newRedisLimiter(cfg *config.RateLimitConfig, keyFn func(r *http.Request) string) (*redisLimiter, error) {
-	opts, err := redis.ParseURL(cfg.RedisURL)
-	if err != nil {
-		return nil, fmt.Errorf("parse redis url: %w", err)
+	now := time.Now()
+	l.evict(bucket, now)
+	if delta < 0 {
+		bucket.timestamps = bucket.timestamps[:max(len(bucket.timestamps)+delta, 0)]
+		return
 	}
-	client := redis.NewClient(opts)
-
-	window, _ := time.ParseDuration(cfg.Window)
-	if window == 0 {
-		window = time.Second
+	for i := 0; i < min(delta, l.rate); i++ {
+		bucket.timestamps = append(bucket.timestamps, now)
 	}
-
-	return &redisLimiter{
-		client: client,
-		script: redis.NewScript(slidingWindowLua),
-		cfg:    cfg,
-		window: window,
-		keyFn:  keyFn,
-	}, nil
 }
 
-func (rl *redisLimiter) Allow(r *http.Request) error {
-	key := "rl:" + rl.keyFn(r)
-	nowMs := time.Now().UnixMilli()
-	windowMs := rl.window.Milliseconds()
-
-	ctx, cancel := context.WithTimeout(r.Context(), 50*time.Millisecond)
-	defer cancel()
-
-	res, err := rl.script.Run(ctx, rl.client, []string{key},
-		nowMs, windowMs, rl.cfg.Rate).Int64Slice()
-	if err != nil {
-		// Redis unavailable — fail open (allow the request)
-		return nil
-	}
-
-	if res[0] == 0 {
-		oldestMs := res[1]
-		retryAfter := time.Duration(oldestMs+windowMs-nowMs) * time.Millisecond
-		return &ErrRateLimited{RetryAfter: retryAfter}
+// evict drops entries older than the window. Caller holds bucket.mu.
+func (l *localSlidingWindow) evict(bucket *swBucket, now time.Time) {
+	cutoff := now.Add(-l.window)
+	i := 0
+	for i < len(bucket.timestamps) && bucket.timestamps[i].Before(cutoff) {
+		i++
 	}
-	return nil
+	bucket.timestamps = bucket.timestamps[i:]
 }
 
-func min(a, b float64) float64 {
-	if a < b {
-		return a
-	}
-	return b
-}
+func (l *localSlidingWindow) Stop() { l.buckets.close() }
@@ -0,0 +1,96 @@
+package ratelimiter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+func newTestRequest(remoteAddr string) *http.Request {
+	r := httptest.NewRequest("GET", "/api", nil)
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+func TestTokenBucket_DecisionCountsDown(t *testing.T) {
+	l, err := New(&config.RateLimitConfig{Algorithm: "token_bucket", Rate: 1, Burst: 3}, "/api", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r := newTestRequest("10.0.0.1:1234")
+
+	for want := 2; want >= 0; want-- {
+		d, err := l.Allow(r)
+		if err != nil {
+			t.Fatalf("expected allow, got %v", err)
+		}
+		if d.Limit != 3 || d.Remaining != want {
+			t.Errorf("expected limit=3 remaining=%d, got %+v", want, d)
+		}
+	}
+
+	d, err := l.Allow(r)
+	var rlErr *ErrRateLimited
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if d.Remaining != 0 || d.Reset <= 0 {
+		t.Errorf("expected exhausted decision with positive reset, got %+v", d)
+	}
+}
+
+func TestSlidingWindow_DecisionCountsDown(t *testing.T) {
+	l, err := New(&config.RateLimitConfig{Algorithm: "sliding_window", Rate: 2, Window: "1m"}, "/api", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r := newTestRequest("10.0.0.1:1234")
+
+	d, _ := l.Allow(r)
+	if d.Limit != 2 || d.Remaining != 1 {
+		t.Errorf("expected limit=2 remaining=1, got %+v", d)
+	}
+	_, _ = l.Allow(r)
+	d, err = l.Allow(r)
+	if err == nil {
+		t.Fatal("expected third request to be limited")
+	}
+	if d.Remaining != 0 || d.Reset <= 0 {
+		t.Errorf("expected exhausted decision with positive reset, got %+v", d)
+	}
+}
+
+func TestSetHeaders_Styles(t *testing.T) {
+	d := Decision{Limit: 10, Remaining: 4, Reset: 1500 * time.Millisecond}
+
+	h := http.Header{}
+	SetHeaders(h, HeadersIETF, d)
+	if h.Get("RateLimit-Limit") != "10" || h.Get("RateLimit-Remaining") != "4" || h.Get("RateLimit-Reset") != "2" {
+		t.Errorf("unexpected ietf headers: %v", h)
+	}
+	if h.Get("X-RateLimit-Limit") != "" {
+		t.Error("ietf style must not emit legacy headers")
+	}
+
+	h = http.Header{}
+	SetHeaders(h, HeadersLegacy, d)
+	if h.Get("X-RateLimit-Limit") != "10" || h.Get("X-RateLimit-Remaining") != "4" {
+		t.Errorf("unexpected legacy headers: %v", h)
+	}
+	if _, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err != nil {
+		t.Errorf("legacy reset should be a Unix timestamp: %v", err)
+	}
+
+	h = http.Header{}
+	SetHeaders(h, HeadersNone, d)
+	SetHeaders(h, HeadersIETF, Decision{})
+	if len(h) != 0 {
+		t.Errorf("expected no headers, got %v", h)
+	}
+}
@@ -0,0 +1,406 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+// ---------------------------------------------------------------------------
+// Redis-backed (distributed) limiter — uses Lua scripts for atomicity
+//
+// Every script takes the bucket and override keys, a per-call unique id, the
+// cost in tokens and a force flag, and returns {allowed, remaining,
+// retry_after_ms, reset_ms} in a single round-trip. Time comes from the
+// Redis server's clock, so replicas with skewed clocks agree. Forced calls
+// always apply the cost, which may be negative, to settle a request's actual
+// cost after the fact. Zero-cost calls only read.
+// ---------------------------------------------------------------------------
+
+// overrideLua short-circuits keys exempted or blocked through the admin API
+// (KEYS[2]). It runs ahead of every script, whose ARGV[5] is its limit, and
+// is skipped for zero-cost peeks so they report the real bucket. It then
+// reads the server clock in milliseconds into now; TIME needs effect
+// replication on Redis versions before 5.
+const overrideLua = `
+if tonumber(ARGV[2]) ~= 0 then
+  local override = redis.call('GET', KEYS[2])
+  if override == 'exempt' then
+    return {1, tonumber(ARGV[5]), 0, 0}
+  elseif override == 'block' then
+    local ttl = redis.call('PTTL', KEYS[2])
+    return {0, 0, ttl, ttl}
+  end
+end
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now  = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+`
+
+// Sliding window in Redis using a sorted set.
+// Each request adds current timestamp; expired entries are pruned atomically.
+// The member carries the call id so requests in the same millisecond are not
+// collapsed into one entry.
+// Memory is O(rate) per key — prefer token_bucket or gcra for large limits.
+const slidingWindowLua = overrideLua + `
+local key    = KEYS[1]
+local id     = ARGV[1]
+local cost   = tonumber(ARGV[2])
+local force  = ARGV[3] == '1'
+local window = tonumber(ARGV[4])
+local limit  = tonumber(ARGV[5])
+local cutoff = now - window
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', cutoff)
+local count = redis.call('ZCARD', key)
+if cost == 0 then
+  if count == 0 then
+    return {1, limit, 0, 0}
+  end
+  local first = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+  return {1, math.max(0, limit - count), 0, tonumber(first[2]) + window - now}
+end
+if cost < 0 then
+  redis.call('ZPOPMAX', key, -cost)
+  return {1, math.max(0, limit - count - cost), 0, 0}
+end
+if not force and count + cost > limit then
+  local oldest = redis.call('ZRANGE', key, count + cost - limit - 1, count + cost - limit - 1, 'WITHSCORES')
+  local first  = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+  return {0, limit - count, tonumber(oldest[2]) + window - now, tonumber(first[2]) + window - now}
+end
+cost = math.min(cost, limit)
+for i = 1, cost do
+  redis.call('ZADD', key, now, now .. '-' .. id .. '-' .. i)
+end
+redis.call('EXPIRE', key, math.ceil(window/1000))
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {1, math.max(0, limit - count - cost), 0, tonumber(oldest[2]) + window - now}
+`
+
+// Token bucket in Redis using a hash of {tokens, ts}.
+// Tokens are refilled lazily from the elapsed time on each call, so memory is
+// constant per key. The key expires once the bucket would be full again.
+// Forced charges may leave the bucket in debt, down to -burst.
+const tokenBucketLua = overrideLua + `
+local key   = KEYS[1]
+local cost  = tonumber(ARGV[2])
+local force = ARGV[3] == '1'
+local rate  = tonumber(ARGV[4])
+local burst = tonumber(ARGV[5])
+
+local state  = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts     = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+if cost == 0 then
+  return {1, math.max(0, math.floor(tokens)), 0, math.ceil((burst - tokens) * 1000 / rate)}
+end
+
+local allowed = 0
+local retry = 0
+if force then
+  tokens = math.min(burst, math.max(tokens - cost, -burst))
+  allowed = 1
+elseif tokens >= cost then
+  tokens = tokens - cost
+  allowed = 1
+else
+  retry = math.ceil((cost - tokens) * 1000 / rate)
+end
+
+local reset = math.ceil((burst - tokens) * 1000 / rate)
+redis.call('HSET', key, 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', key, math.max(reset, 1))
+return {allowed, math.max(0, math.floor(tokens)), retry, reset}
+`
+
+// GCRA (generic cell rate algorithm) stores a single "theoretical arrival
+// time" per key. A request is admitted if it does not arrive earlier than
+// tat - burst*interval; each admitted request pushes tat forward by cost
+// emission intervals. Behaviour matches a token bucket of size burst.
+const gcraLua = overrideLua + `
+local key       = KEYS[1]
+local cost      = tonumber(ARGV[2])
+local force     = ARGV[3] == '1'
+local interval  = tonumber(ARGV[4])
+local burst     = tonumber(ARGV[5])
+local tolerance = interval * burst
+
+local tat = tonumber(redis.call('GET', key))
+if tat == nil or tat < now then
+  tat = now
+end
+
+local new_tat  = tat + interval * cost
+if force then
+  new_tat = math.max(new_tat, now)
+end
+local allow_at = new_tat - tolerance
+if cost == 0 then
+  return {1, math.max(0, math.floor((now - allow_at) / interval)), 0, math.ceil(tat - now)}
+end
+if not force and allow_at > now then
+  return {0, 0, math.ceil(allow_at - now), math.ceil(tat - now)}
+end
+
+local reset = math.ceil(new_tat - now)
+redis.call('SET', key, new_tat, 'PX', math.max(reset, 1))
+return {1, math.max(0, math.floor((now - allow_at) / interval)), 0, reset}
+`
+
+// How often a degraded limiter lets one request through to Redis to check
+// whether it has come back.
+const redisProbeInterval = time.Second
+
+// Policies for RateLimitConfig.OnRedisError.
+const (
+	OnRedisErrorOpen   = "open"   // allow every request
+	OnRedisErrorClosed = "closed" // reject every request with ErrUnavailable
+	OnRedisErrorLocal  = "local"  // enforce rate/instances in-process
+)
+
+var (
+	redisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Name:      "ratelimit_redis_errors_total",
+		Help:      "Redis rate limiter calls that failed or timed out.",
+	}, []string{"route"})
+
+	redisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gateway",
+		Name:      "ratelimit_redis_duration_seconds",
+		Help:      "Latency of Redis rate limiter calls.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1},
+	}, []string{"route"})
+
+	redisDegraded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Name:      "ratelimit_redis_degraded",
+		Help:      "1 while a route's Redis limiter is unreachable and its on_redis_error policy applies.",
+	}, []string{"route"})
+)
+
+type redisLimiter struct {
+	client    *redis.Client
+	script    *redis.Script
+	prefix    string // bucket namespace, one per route and algorithm
+	overrides string // override namespace, one per route
+	limit     int    // reported as Decision.Limit
+	args      []any  // script arguments after the call id, cost and force flag
+
+	// instance + seq make call ids unique across gateway replicas.
+	instance string
+	seq      atomic.Uint64
+
+	// Failure handling
+	route       string
+	onError     string
+	fallback    quota // set when onError is "local"
+	fallbackMax int   // largest cost the fallback can admit
+	log         *zap.SugaredLogger
+	degraded    atomic.Bool
+	probeAt     atomic.Int64 // unix nanos of the next Redis attempt while degraded
+}
+
+func newRedisLimiter(cfg *config.RateLimitConfig, route string, log *zap.SugaredLogger) (*redisLimiter, error) {
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %d", cfg.Rate)
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.Rate
+	}
+	var window time.Duration
+	if cfg.Algorithm == "sliding_window" {
+		if window, err = time.ParseDuration(cfg.Window); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", cfg.Window, err)
+		}
+	}
+
+	rl := &redisLimiter{
+		client:   redis.NewClient(opts),
+		instance: uuid.NewString(),
+		route:    route,
+		onError:  cfg.OnRedisError,
+		log:      log,
+	}
+
+	switch rl.onError {
+	case "":
+		rl.onError = OnRedisErrorOpen
+	case OnRedisErrorLocal:
+		share := localShare(cfg)
+		fb, err := newLocal(share, route)
+		if err != nil {
+			return nil, fmt.Errorf("local fallback: %w", err)
+		}
+		rl.fallback = fb
+		rl.fallbackMax = share.Burst
+		if cfg.Algorithm == "sliding_window" {
+			rl.fallbackMax = share.Rate
+		}
+	}
+	redisDegraded.WithLabelValues(route).Set(0)
+
+	// Every key carries the route as a hash tag, so routes sharing a key_by
+	// expression don't share buckets and a script's keys stay in one
+	// Redis Cluster slot.
+	ns := "rl:{" + route + "}:"
+	rl.overrides = ns + "override:"
+
+	switch cfg.Algorithm {
+	case "sliding_window":
+		rl.script = redis.NewScript(slidingWindowLua)
+		rl.prefix = ns + "sw:"
+		rl.limit = cfg.Rate
+		rl.args = []any{window.Milliseconds(), cfg.Rate}
+	case "gcra":
+		rl.script = redis.NewScript(gcraLua)
+		rl.prefix = ns + "gcra:"
+		rl.limit = burst
+		rl.args = []any{1000 / float64(cfg.Rate), burst}
+	default: // token_bucket
+		rl.script = redis.NewScript(tokenBucketLua)
+		rl.prefix = ns + "tb:"
+		rl.limit = burst
+		rl.args = []any{cfg.Rate, burst}
+	}
+	return rl, nil
+}
+
+func (rl *redisLimiter) take(ctx context.Context, key string, cost int) (Decision, error) {
+	if rl.degraded.Load() && !rl.shouldProbe() {
+		return rl.unavailable(ctx, key, cost)
+	}
+
+	res, err := rl.eval(ctx, key, cost, false)
+	if err != nil {
+		rl.markDown(err)
+		return rl.unavailable(ctx, key, cost)
+	}
+	rl.markUp()
+
+	d := Decision{
+		Limit:     rl.limit,
+		Remaining: int(max(res[1], 0)),
+		Reset:     time.Duration(res[3]) * time.Millisecond,
+	}
+	if res[0] == 0 {
+		return d, &ErrRateLimited{RetryAfter: time.Duration(res[2]) * time.Millisecond}
+	}
+	return d, nil
+}
+
+// adjust charges delta more tokens to key. While Redis is down the charge
+// goes to the local fallback, if any, and is otherwise dropped.
+func (rl *redisLimiter) adjust(ctx context.Context, key string, delta int) {
+	if rl.degraded.Load() {
+		if rl.fallback != nil {
+			rl.fallback.adjust(ctx, key, delta)
+		}
+		return
+	}
+	if _, err := rl.eval(ctx, key, delta, true); err != nil {
+		rl.markDown(err)
+	}
+}
+
+// Stop closes the Redis connection pool and the local fallback, if any.
+func (rl *redisLimiter) Stop() {
+	if rl.fallback != nil {
+		rl.fallback.Stop()
+	}
+	_ = rl.client.Close()
+}
+
+// eval runs the algorithm's script for key and records its latency.
+func (rl *redisLimiter) eval(ctx context.Context, key string, cost int, force bool) ([]int64, error) {
+	keys := []string{rl.prefix + key, rl.overrides + key}
+	id := rl.instance + ":" + strconv.FormatUint(rl.seq.Add(1), 10)
+	flag := "0"
+	if force {
+		flag = "1"
+	}
+	args := append([]any{id, cost, flag}, rl.args...)
+
+	// A client hanging up mid-call is not a Redis failure, so only the
+	// timeout may cut the call short
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	res, err := rl.script.Run(ctx, rl.client, keys, args...).Int64Slice()
+	redisDuration.WithLabelValues(rl.route).Observe(time.Since(start).Seconds())
+	if err == nil && len(res) != 4 {
+		err = fmt.Errorf("unexpected script result %v", res)
+	}
+	return res, err
+}
+
+// unavailable applies the on_redis_error policy.
+func (rl *redisLimiter) unavailable(ctx context.Context, key string, cost int) (Decision, error) {
+	switch rl.onError {
+	case OnRedisErrorClosed:
+		return Decision{}, ErrUnavailable
+	case OnRedisErrorLocal:
+		return rl.fallback.take(ctx, key, min(cost, rl.fallbackMax))
+	default:
+		return Decision{}, nil
+	}
+}
+
+// shouldProbe lets exactly one caller per probe interval retry Redis.
+func (rl *redisLimiter) shouldProbe() bool {
+	next := rl.probeAt.Load()
+	now := time.Now().UnixNano()
+	if now < next {
+		return false
+	}
+	return rl.probeAt.CompareAndSwap(next, now+int64(redisProbeInterval))
+}
+
+func (rl *redisLimiter) markDown(err error) {
+	redisErrors.WithLabelValues(rl.route).Inc()
+	rl.probeAt.Store(time.Now().Add(redisProbeInterval).UnixNano())
+	if rl.degraded.CompareAndSwap(false, true) {
+		redisDegraded.WithLabelValues(rl.route).Set(1)
+		rl.log.Warnw("redis rate limiter unavailable",
+			"route", rl.route, "policy", rl.onError, "err", err)
+	}
+}
+
+func (rl *redisLimiter) markUp() {
+	if rl.degraded.CompareAndSwap(true, false) {
+		redisDegraded.WithLabelValues(rl.route).Set(0)
+		rl.log.Infow("redis rate limiter recovered", "route", rl.route)
+	}
+}
+
+// localShare returns a copy of cfg scaled to one gateway instance's share of
+// the global limit, for use as the in-process fallback.
+func localShare(cfg *config.RateLimitConfig) *config.RateLimitConfig {
+	n := max(cfg.Instances, 1)
+	share := *cfg
+	share.RedisURL = ""
+	share.Rate = max((cfg.Rate+n-1)/n, 1)
+	share.Burst = max((cfg.Burst+n-1)/n, 1)
+	return &share
+}
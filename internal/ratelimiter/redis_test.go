@@ -0,0 +1,235 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/sneha4175/gateway-pro/internal/config"
+	"go.uber.org/zap"
+)
+
+// newTestRedisLimiter starts a miniredis instance and returns a limiter
+// bound to it, and a function that moves the server's clock forward.
+func newTestRedisLimiter(t *testing.T, cfg config.RateLimitConfig) (*redisLimiter, *miniredis.Miniredis, func(time.Duration)) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cfg.RedisURL = "redis://" + mr.Addr()
+	rl, err := newRedisLimiter(&cfg, "/test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("newRedisLimiter: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	mr.SetTime(now)
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		mr.SetTime(now)
+	}
+	return rl, mr, advance
+}
+
+func TestRedis_BurstThenReject(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "gcra", "sliding_window"} {
+		t.Run(algo, func(t *testing.T) {
+			rl, _, _ := newTestRedisLimiter(t, config.RateLimitConfig{
+				Algorithm: algo, Rate: 5, Burst: 5, Window: "1s",
+			})
+			ctx := context.Background()
+
+			for want := 4; want >= 0; want-- {
+				d, err := rl.take(ctx, "ip:10.0.0.1", 1)
+				if err != nil {
+					t.Fatalf("request %d: expected allow, got %v", 5-want, err)
+				}
+				if d.Limit != 5 || d.Remaining != want {
+					t.Errorf("expected limit=5 remaining=%d, got %+v", want, d)
+				}
+			}
+
+			_, err := rl.take(ctx, "ip:10.0.0.1", 1)
+			var rlErr *ErrRateLimited
+			if !errors.As(err, &rlErr) {
+				t.Fatalf("expected ErrRateLimited, got %v", err)
+			}
+			if rlErr.RetryAfter <= 0 || rlErr.RetryAfter > time.Second {
+				t.Errorf("unexpected retry-after %s", rlErr.RetryAfter)
+			}
+
+			// A different key has its own quota.
+			if _, err := rl.take(ctx, "ip:10.0.0.2", 1); err != nil {
+				t.Errorf("expected other key to be allowed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRedis_RefillOverTime(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "gcra"} {
+		t.Run(algo, func(t *testing.T) {
+			rl, _, advance := newTestRedisLimiter(t, config.RateLimitConfig{
+				Algorithm: algo, Rate: 10, Burst: 2,
+			})
+			ctx := context.Background()
+
+			_, _ = rl.take(ctx, "ip:10.0.0.1", 1)
+			_, _ = rl.take(ctx, "ip:10.0.0.1", 1)
+			if _, err := rl.take(ctx, "ip:10.0.0.1", 1); err == nil {
+				t.Fatal("expected bucket to be exhausted")
+			}
+
+			// 10 req/s → one token every 100ms.
+			advance(100 * time.Millisecond)
+			if _, err := rl.take(ctx, "ip:10.0.0.1", 1); err != nil {
+				t.Fatalf("expected refill after 100ms, got %v", err)
+			}
+			if _, err := rl.take(ctx, "ip:10.0.0.1", 1); err == nil {
+				t.Fatal("expected only one token to have refilled")
+			}
+		})
+	}
+}
+
+func TestRedis_ConstantMemoryPerKey(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "gcra"} {
+		t.Run(algo, func(t *testing.T) {
+			rl, mr, advance := newTestRedisLimiter(t, config.RateLimitConfig{
+				Algorithm: algo, Rate: 1000, Burst: 1000,
+			})
+			ctx := context.Background()
+			for i := 0; i < 500; i++ {
+				advance(time.Millisecond)
+				_, _ = rl.take(ctx, "ip:10.0.0.1", 1)
+			}
+			keys := mr.Keys()
+			if len(keys) != 1 {
+				t.Fatalf("expected exactly one key, got %v", keys)
+			}
+			if ttl := mr.TTL(keys[0]); ttl <= 0 {
+				t.Errorf("expected key to carry a TTL, got %s", ttl)
+			}
+		})
+	}
+}
+
+func TestRedis_RejectsBadWindow(t *testing.T) {
+	for _, window := range []string{"", "soon"} {
+		_, err := newRedisLimiter(&config.RateLimitConfig{
+			Algorithm: "sliding_window", Rate: 5, Window: window, RedisURL: "redis://127.0.0.1:1",
+		}, "/test", zap.NewNop().Sugar())
+		if err == nil || !strings.Contains(err.Error(), "invalid window") {
+			t.Errorf("window %q: expected an invalid window error, got %v", window, err)
+		}
+	}
+}
+
+func TestRedis_FailOpenWhenUnavailable(t *testing.T) {
+	rl, mr, _ := newTestRedisLimiter(t, config.RateLimitConfig{Rate: 1, Burst: 1})
+	mr.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := rl.take(context.Background(), "ip:10.0.0.1", 1); err != nil {
+			t.Fatalf("expected fail-open, got %v", err)
+		}
+	}
+}
+
+func TestRedis_FailClosedWhenUnavailable(t *testing.T) {
+	rl, mr, _ := newTestRedisLimiter(t, config.RateLimitConfig{Rate: 100, Burst: 100, OnRedisError: OnRedisErrorClosed})
+	mr.Close()
+
+	if _, err := rl.take(context.Background(), "ip:10.0.0.1", 1); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if !rl.degraded.Load() {
+		t.Error("expected limiter to be marked degraded")
+	}
+}
+
+func TestRedis_LocalFallbackEnforcesInstanceShare(t *testing.T) {
+	rl, mr, _ := newTestRedisLimiter(t, config.RateLimitConfig{
+		Rate: 9, Burst: 9, Instances: 3, OnRedisError: OnRedisErrorLocal,
+	})
+	mr.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := rl.take(ctx, "ip:10.0.0.1", 1); err != nil {
+			t.Fatalf("request %d: expected allow from local share, got %v", i+1, err)
+		}
+	}
+	var rlErr *ErrRateLimited
+	if _, err := rl.take(ctx, "ip:10.0.0.1", 1); !errors.As(err, &rlErr) {
+		t.Fatalf("expected local fallback to limit at 9/3, got %v", err)
+	}
+}
+
+func TestRedis_RecoversWhenRedisReturns(t *testing.T) {
+	rl, mr, _ := newTestRedisLimiter(t, config.RateLimitConfig{Rate: 100, Burst: 100, OnRedisError: OnRedisErrorClosed})
+	addr := mr.Addr()
+	mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.take(ctx, "ip:10.0.0.1", 1); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+
+	// Bring Redis back on the same address and force the next probe.
+	mr2 := miniredis.NewMiniRedis()
+	if err := mr2.StartAddr(addr); err != nil {
+		t.Skipf("cannot rebind %s: %v", addr, err)
+	}
+	defer mr2.Close()
+	rl.probeAt.Store(0)
+
+	if _, err := rl.take(ctx, "ip:10.0.0.1", 1); err != nil {
+		t.Fatalf("expected recovery, got %v", err)
+	}
+	if rl.degraded.Load() {
+		t.Error("expected limiter to leave degraded mode")
+	}
+}
+
+func TestRedis_ClientCancelIsNotAnOutage(t *testing.T) {
+	rl, _, _ := newTestRedisLimiter(t, config.RateLimitConfig{
+		Algorithm: "token_bucket", Rate: 5, OnRedisError: OnRedisErrorClosed,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // the client hung up
+	if _, err := rl.take(ctx, "ip:10.0.0.1", 1); err != nil {
+		t.Fatalf("take with a cancelled request: %v", err)
+	}
+	rl.adjust(ctx, "ip:10.0.0.1", 1)
+	if rl.degraded.Load() {
+		t.Fatal("a cancelled request marked Redis down")
+	}
+}
+
+func TestRedis_PeekDoesNotWrite(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "gcra", "sliding_window"} {
+		t.Run(algo, func(t *testing.T) {
+			rl, mr, _ := newTestRedisLimiter(t, config.RateLimitConfig{
+				Algorithm: algo, Rate: 5, Burst: 5, Window: "1s",
+			})
+			ctx := context.Background()
+			d, err := rl.take(ctx, "ip:10.0.0.1", 0)
+			if err != nil || d.Remaining != 5 {
+				t.Fatalf("expected a full quota, got %+v, %v", d, err)
+			}
+			if keys := mr.Keys(); len(keys) != 0 {
+				t.Fatalf("a zero-cost peek wrote %v", keys)
+			}
+
+			_, _ = rl.take(ctx, "ip:10.0.0.1", 2)
+			before := mr.Dump()
+			if d, err := rl.take(ctx, "ip:10.0.0.1", 0); err != nil || d.Remaining != 3 {
+				t.Fatalf("expected remaining=3, got %+v, %v", d, err)
+			}
+			if after := mr.Dump(); after != before {
+				t.Fatalf("a zero-cost peek changed the bucket:\n%s\n%s", before, after)
+			}
+		})
+	}
+}
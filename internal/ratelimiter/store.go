@@ -0,0 +1,207 @@
+package ratelimiter
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ---------------------------------------------------------------------------
+// Sharded, memory-bounded bucket store shared by the in-process limiters
+// ---------------------------------------------------------------------------
+
+const (
+	numShards = 64
+
+	// DefaultMaxKeys caps the keys tracked by one in-process limiter when
+	// RateLimitConfig.MaxKeys is unset.
+	DefaultMaxKeys = 1_000_000
+
+	// Number of random entries inspected when a full shard needs a victim.
+	evictionSamples = 5
+)
+
+var trackedKeys = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gateway",
+	Name:      "ratelimit_tracked_keys",
+	Help:      "Keys currently tracked by in-process rate limiters.",
+}, []string{"route"})
+
+// keyStore maps rate-limit keys to buckets. Keys are spread over numShards
+// independently locked maps to keep lock contention low, and a background
+// sweeper removes keys that have been idle for longer than idle — by then
+// their bucket is back to its initial state, so dropping it is invisible.
+// When a shard reaches its share of maxKeys, an approximately
+// least-recently-used entry is evicted to make room.
+type keyStore[B any] struct {
+	shards      [numShards]keyShard[B]
+	seed        maphash.Seed
+	initBucket  func(b *B)
+	maxPerShard int
+	idle        time.Duration
+	route       string
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+type keyShard[B any] struct {
+	mu sync.RWMutex
+	m  map[string]*storeEntry[B]
+}
+
+type storeEntry[B any] struct {
+	bucket   B
+	lastSeen atomic.Int64 // unix nanos
+}
+
+// newKeyStore creates a store and starts its sweeper.
+// Call close to release the sweeper goroutine.
+func newKeyStore[B any](route string, maxKeys int, idle time.Duration, initBucket func(b *B)) *keyStore[B] {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	s := &keyStore[B]{
+		seed:        maphash.MakeSeed(),
+		initBucket:  initBucket,
+		maxPerShard: max(maxKeys/numShards, 1),
+		idle:        max(idle, time.Second),
+		route:       route,
+		stop:        make(chan struct{}),
+	}
+	for i := range s.shards {
+		s.shards[i].m = make(map[string]*storeEntry[B])
+	}
+	go s.sweepLoop()
+	return s
+}
+
+// get returns the bucket for key, creating it if needed.
+func (s *keyStore[B]) get(key string) *B {
+	now := time.Now().UnixNano()
+	sh := &s.shards[maphash.String(s.seed, key)%numShards]
+
+	sh.mu.RLock()
+	e, ok := sh.m[key]
+	sh.mu.RUnlock()
+	if ok {
+		e.lastSeen.Store(now)
+		return &e.bucket
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if e, ok = sh.m[key]; ok {
+		e.lastSeen.Store(now)
+		return &e.bucket
+	}
+	if len(sh.m) >= s.maxPerShard {
+		sh.evictOne()
+	}
+	e = &storeEntry[B]{}
+	s.initBucket(&e.bucket)
+	e.lastSeen.Store(now)
+	sh.m[key] = e
+	return &e.bucket
+}
+
+// peek returns the bucket for key without creating or touching it.
+func (s *keyStore[B]) peek(key string) (*B, bool) {
+	sh := &s.shards[maphash.String(s.seed, key)%numShards]
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	if e, ok := sh.m[key]; ok {
+		return &e.bucket, true
+	}
+	return nil, false
+}
+
+// delete forgets key; its next request starts from a fresh bucket.
+func (s *keyStore[B]) delete(key string) {
+	sh := &s.shards[maphash.String(s.seed, key)%numShards]
+	sh.mu.Lock()
+	delete(sh.m, key)
+	sh.mu.Unlock()
+}
+
+// keys returns every tracked key.
+func (s *keyStore[B]) keys() []string {
+	var keys []string
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for k := range sh.m {
+			keys = append(keys, k)
+		}
+		sh.mu.RUnlock()
+	}
+	return keys
+}
+
+// len returns the number of tracked keys.
+func (s *keyStore[B]) len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		n += len(sh.m)
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// evictOne removes the stalest of a few randomly sampled entries.
+// Map iteration order is randomised, which gives us the sample for free.
+// Caller must hold sh.mu for writing.
+func (sh *keyShard[B]) evictOne() {
+	var victim string
+	oldest := int64(-1)
+	n := 0
+	for k, e := range sh.m {
+		if seen := e.lastSeen.Load(); oldest < 0 || seen < oldest {
+			victim, oldest = k, seen
+		}
+		if n++; n >= evictionSamples {
+			break
+		}
+	}
+	delete(sh.m, victim)
+}
+
+func (s *keyStore[B]) sweepLoop() {
+	ticker := time.NewTicker(min(s.idle, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sweep(time.Now())
+		}
+	}
+}
+
+// sweep drops entries not seen since now-idle and refreshes the key gauge.
+func (s *keyStore[B]) sweep(now time.Time) {
+	cutoff := now.Add(-s.idle).UnixNano()
+	total := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for k, e := range sh.m {
+			if e.lastSeen.Load() < cutoff {
+				delete(sh.m, k)
+			}
+		}
+		total += len(sh.m)
+		sh.mu.Unlock()
+	}
+	trackedKeys.WithLabelValues(s.route).Set(float64(total))
+}
+
+func (s *keyStore[B]) close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
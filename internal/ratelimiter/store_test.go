@@ -0,0 +1,144 @@
+package ratelimiter
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sneha4175/gateway-pro/internal/config"
+)
+
+type counterBucket struct{ n int }
+
+func newTestStore(t testing.TB, maxKeys int, idle time.Duration) *keyStore[counterBucket] {
+	s := newKeyStore("/test", maxKeys, idle, func(*counterBucket) {})
+	t.Cleanup(s.close)
+	return s
+}
+
+func TestKeyStore_ReturnsSameBucketForKey(t *testing.T) {
+	s := newTestStore(t, 0, time.Minute)
+	s.get("a").n++
+	s.get("a").n++
+	if got := s.get("a").n; got != 2 {
+		t.Errorf("expected bucket state to persist, got n=%d", got)
+	}
+	if s.len() != 1 {
+		t.Errorf("expected 1 key, got %d", s.len())
+	}
+}
+
+func TestKeyStore_SweepEvictsIdleKeys(t *testing.T) {
+	s := newTestStore(t, 0, time.Second)
+	for i := 0; i < 1000; i++ {
+		s.get("idle-" + strconv.Itoa(i))
+	}
+
+	s.sweep(time.Now())
+	if s.len() != 1000 {
+		t.Fatalf("expected fresh keys to survive a sweep, got %d", s.len())
+	}
+
+	s.get("active")
+	s.sweep(time.Now().Add(2 * time.Second))
+	if s.len() != 0 {
+		t.Errorf("expected all keys idle for >1s to be evicted, got %d", s.len())
+	}
+}
+
+func TestKeyStore_MaxKeysBound(t *testing.T) {
+	const maxKeys = numShards * 4
+	s := newTestStore(t, maxKeys, time.Hour)
+	for i := 0; i < 100_000; i++ {
+		s.get("k-" + strconv.Itoa(i))
+	}
+	if n := s.len(); n > maxKeys {
+		t.Errorf("expected at most %d keys, got %d", maxKeys, n)
+	}
+}
+
+func TestTokenBucket_EvictedKeyStartsFull(t *testing.T) {
+	l, err := newLocal(&config.RateLimitConfig{Rate: 1, Burst: 1}, "/test")
+	if err != nil {
+		t.Fatalf("newLocal: %v", err)
+	}
+	defer l.Stop()
+	tb := l.(*localTokenBucket)
+	ctx := context.Background()
+
+	_, _ = tb.take(ctx, "k", 1)
+	if _, err := tb.take(ctx, "k", 1); err == nil {
+		t.Fatal("expected second request to be limited")
+	}
+
+	// After the refill time the bucket is full again, so eviction is lossless.
+	tb.buckets.sweep(time.Now().Add(2 * time.Second))
+	if _, err := tb.take(ctx, "k", 1); err != nil {
+		t.Errorf("expected evicted key to start with a full bucket, got %v", err)
+	}
+}
+
+// BenchmarkTokenBucket_DistinctKeys simulates a scan from millions of source
+// addresses: every iteration uses a new key.
+func BenchmarkTokenBucket_DistinctKeys(b *testing.B) {
+	l, err := newLocal(&config.RateLimitConfig{Rate: 10, Burst: 10}, "/bench")
+	if err != nil {
+		b.Fatalf("newLocal: %v", err)
+	}
+	defer l.Stop()
+
+	var seq atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		for pb.Next() {
+			_, _ = l.take(ctx, strconv.FormatUint(seq.Add(1), 10), 1)
+		}
+	})
+	b.ReportMetric(float64(l.(*localTokenBucket).buckets.len()), "keys")
+}
+
+// BenchmarkTokenBucket_HotKeys measures contention on a small key set that
+// is already populated, the common steady-state case.
+func BenchmarkTokenBucket_HotKeys(b *testing.B) {
+	l, err := newLocal(&config.RateLimitConfig{Rate: 1_000_000, Burst: 1_000_000}, "/bench")
+	if err != nil {
+		b.Fatalf("newLocal: %v", err)
+	}
+	defer l.Stop()
+
+	var seq atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		key := strconv.FormatUint(seq.Add(1)%16, 10)
+		for pb.Next() {
+			_, _ = l.take(ctx, key, 1)
+		}
+	})
+}
+
+// BenchmarkSlidingWindow_DistinctKeys is the sliding-window counterpart of
+// BenchmarkTokenBucket_DistinctKeys.
+func BenchmarkSlidingWindow_DistinctKeys(b *testing.B) {
+	l, err := newLocal(&config.RateLimitConfig{Algorithm: "sliding_window", Rate: 10, Window: "1m"}, "/bench")
+	if err != nil {
+		b.Fatalf("newLocal: %v", err)
+	}
+	defer l.Stop()
+
+	var seq atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		for pb.Next() {
+			_, _ = l.take(ctx, strconv.FormatUint(seq.Add(1), 10), 1)
+		}
+	})
+	b.ReportMetric(float64(l.(*localSlidingWindow).buckets.len()), "keys")
+}